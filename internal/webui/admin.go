@@ -0,0 +1,56 @@
+package webui
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
+)
+
+var adminTemplate = template.Must(template.New("admin").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/admin.html"))
+
+// The page template variable
+type AdminPage struct {
+	User *model.User
+	// Quota, Cache and Breaker are nil when the navitia client does not report its api usage
+	Quota   *navitia_api_client.QuotaStats
+	Cache   *navitia_api_client.CacheStats
+	Breaker *navitia_api_client.BreakerStats
+}
+
+// The admin handler of the webui, it shows how close we are to exhausting the navitia api quota
+func adminHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path == "/admin" {
+		user, err := tryAndResumeSession(e, r)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return nil
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Cache-Control", "no-store, no-cache")
+			p := AdminPage{
+				User: user,
+			}
+			if m, ok := e.navitia.(navitia_api_client.Monitored); ok {
+				quota := m.QuotaStats()
+				cache := m.CacheStats()
+				breaker := m.BreakerStats()
+				p.Quota = &quota
+				p.Cache = &cache
+				p.Breaker = &breaker
+			}
+			err = adminTemplate.ExecuteTemplate(w, "admin.html", p)
+			if err != nil {
+				return newStatusError(http.StatusInternalServerError, err)
+			}
+			return nil
+		default:
+			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	} else {
+		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in adminHandler"))
+	}
+}
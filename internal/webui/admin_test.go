@@ -0,0 +1,157 @@
+package webui
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
+	"github.com/stretchr/testify/require"
+)
+
+type NavitiaMonitoredMockClient struct {
+	NavitiaMockClient
+	cacheStats   navitia_api_client.CacheStats
+	quotaStats   navitia_api_client.QuotaStats
+	breakerStats navitia_api_client.BreakerStats
+}
+
+func (c *NavitiaMonitoredMockClient) CacheStats() navitia_api_client.CacheStats { return c.cacheStats }
+func (c *NavitiaMonitoredMockClient) QuotaStats() navitia_api_client.QuotaStats { return c.quotaStats }
+func (c *NavitiaMonitoredMockClient) BreakerStats() navitia_api_client.BreakerStats {
+	return c.breakerStats
+}
+
+func TestAdminHandler(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	_, err = dbEnv.Login(context.Background(), &model.UserLogin{Username: "user1", Password: "password1"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: &NavitiaMockClient{},
+	}
+	// test GET requests
+	runHttpTest(t, &e, adminHandler, &httpTestCase{
+		name: "a simple get when not logged in should redirect to the login page",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/admin",
+		},
+		expect: httpTestExpect{
+			code:     http.StatusFound,
+			location: "/login",
+		},
+	})
+	runHttpTest(t, &e, adminHandler, &httpTestCase{
+		name: "an invalid path should 404",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/admin/stats",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, adminHandler, &httpTestCase{
+		name: "a client without statistics should say so",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/admin",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Aucune statistique",
+		},
+	})
+	e.navitia = &NavitiaMonitoredMockClient{
+		cacheStats: navitia_api_client.CacheStats{Hits: 42, Entries: 3},
+		quotaStats: navitia_api_client.QuotaStats{Day: "2021-05-03", Requests: 1234, DailyBudget: 5000, Rate: 5, Burst: 10},
+	}
+	runHttpTest(t, &e, adminHandler, &httpTestCase{
+		name: "a simple get when logged in should display the api usage",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/admin",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "1234 / 5000",
+		},
+	})
+	e.navitia = &NavitiaMonitoredMockClient{
+		quotaStats: navitia_api_client.QuotaStats{Day: "2021-05-03", Requests: 5000, DailyBudget: 5000, Rate: 5, Burst: 10},
+	}
+	runHttpTest(t, &e, adminHandler, &httpTestCase{
+		name: "an exhausted budget should be highlighted",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/admin",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Le budget quotidien est épuisé",
+		},
+	})
+	e.navitia = &NavitiaMonitoredMockClient{
+		quotaStats: navitia_api_client.QuotaStats{Day: "2021-05-03", Requests: 2000, DailyBudget: 10000, Rate: 5, Burst: 10, Tokens: []navitia_api_client.TokenStats{
+			navitia_api_client.TokenStats{Id: "0a1b2c3d", Requests: 2000, DailyBudget: 5000, Healthy: true},
+			navitia_api_client.TokenStats{Id: "4e5f6a7b", DailyBudget: 5000, UnhealthyUntil: time.Date(2021, 5, 3, 13, 0, 0, 0, time.Local), LastStatus: http.StatusUnauthorized, Rejections: 1},
+		}},
+	}
+	runHttpTest(t, &e, adminHandler, &httpTestCase{
+		name: "a rejected token should be displayed with its last error",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/admin",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "écarté jusqu'à 13:00:00 (erreur 401)",
+		},
+	})
+	e.navitia = &NavitiaMonitoredMockClient{
+		breakerStats: navitia_api_client.BreakerStats{State: navitia_api_client.CircuitOpen, ConsecutiveFailures: 5, OpenUntil: time.Date(2021, 5, 3, 12, 34, 56, 0, time.Local)},
+	}
+	runHttpTest(t, &e, adminHandler, &httpTestCase{
+		name: "an open circuit should display when the api will be probed again",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/admin",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "12:34:56",
+		},
+	})
+	// test other methods
+	runHttpTest(t, &e, adminHandler, &httpTestCase{
+		name: "a post should fail",
+		input: httpTestInput{
+			method: http.MethodPost,
+			path:   "/admin",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+		},
+	})
+}
@@ -0,0 +1,70 @@
+package webui
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/gtfs"
+)
+
+// defaultWatchedFor is how long the trains of a stop are published after a user last viewed it, when the boards are
+// not limited to a time window
+const defaultWatchedFor = 2 * time.Hour
+
+// watchedFor returns how long the trains of a stop are published after a user last viewed it, the window of its board
+// since the trains displayed then have left by its end
+func watchedFor(e *env) time.Duration {
+	if e.conf.Board.Window > 0 {
+		return e.conf.Board.Window
+	}
+	return defaultWatchedFor
+}
+
+// The GTFS-RT feed of the webui, publishing the delays, cancellations and disruptions of the trains leaving the stops
+// users watch. Their boards are fetched like the stop pages do, sharing the client cache, and the last good ones are
+// published when that fails. Reading the feed does not watch stops. The json format is meant for debugging.
+func gtfsRealtimeHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path == "/gtfs-rt" {
+		if !authorizeFeed(e, r) {
+			return newStatusError(http.StatusUnauthorized, fmt.Errorf(http.StatusText(http.StatusUnauthorized)))
+		}
+		switch r.Method {
+		case http.MethodGet:
+			now := time.Now()
+			stops, err := e.dbEnv.GetWatchedStops(r.Context(), now.Add(-watchedFor(e)))
+			if err != nil {
+				return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get watched stops"))
+			}
+			var boards []gtfs.Board
+			for _, stop := range stops {
+				departures, err := e.navitia.GetDepartures(r.Context(), stop.Coverage, stop.Id, boardOptions(e))
+				if err != nil {
+					log.Printf("Could not get departures of %s from navitia : %+v", stop.Id, err)
+					if departures, _, err = e.dbEnv.GetDepartures(r.Context(), stop.Id); err != nil {
+						continue
+					}
+				}
+				boards = append(boards, gtfs.Board{StopId: stop.Id, Departures: departures})
+			}
+			// the trains which already left are dropped, the last good boards can be old
+			m := gtfs.NewFeedMessage(now, boards)
+			w.Header().Set("Cache-Control", "no-store, no-cache")
+			if r.URL.Query().Get("format") == "json" {
+				w.Header().Set("Content-Type", "application/json")
+				encoder := json.NewEncoder(w)
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(m)
+			}
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			_, err = w.Write(m.Marshal())
+			return err
+		default:
+			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	} else {
+		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in gtfsRealtimeHandler"))
+	}
+}
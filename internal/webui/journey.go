@@ -0,0 +1,108 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
+)
+
+// the layout of html datetime-local inputs
+const datetimeLocalLayout = "2006-01-02T15:04"
+
+var journeyTemplate = template.Must(template.New("journey").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/journey.html"))
+
+// The page template variable
+type JourneyPage struct {
+	User *model.User
+	// FromQuery and ToQuery are the stops typed in, kept to fill the form back
+	FromQuery string
+	ToQuery   string
+	From      *model.Stop
+	To        *model.Stop
+	Datetime  string
+	ArrivalBy bool
+	Journeys  []model.Journey
+}
+
+// resolveStop finds the stop typed in a journey form field, either an id or a name resolved to the best match of the
+// stop search
+func resolveStop(e *env, ctx context.Context, q string) (*model.Stop, error) {
+	if validStopId.MatchString(q) {
+		return e.dbEnv.GetStop(ctx, q)
+	}
+	stops, err := searchStops(e, ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	if len(stops) == 0 {
+		return nil, fmt.Errorf("No stop matches %q", q)
+	}
+	return &stops[0], nil
+}
+
+// The journey handler of the webui
+func journeyHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path == "/journey" {
+		user, err := tryAndResumeSession(e, r)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return nil
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Cache-Control", "no-store, no-cache")
+			p := JourneyPage{
+				User:      user,
+				FromQuery: strings.TrimSpace(r.URL.Query().Get("from")),
+				ToQuery:   strings.TrimSpace(r.URL.Query().Get("to")),
+				ArrivalBy: r.URL.Query().Get("represents") == "arrival",
+			}
+			// the empty form leaves the datetime blank, journeys are then planned from the current minute
+			if p.FromQuery != "" || p.ToQuery != "" {
+				if p.From, err = resolveStop(e, r.Context(), p.FromQuery); err != nil {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Departure stop not found"))
+				}
+				if p.To, err = resolveStop(e, r.Context(), p.ToQuery); err != nil {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Arrival stop not found"))
+				}
+				p.FromQuery = p.From.Name
+				p.ToQuery = p.To.Name
+				// journeys are planned in the timezone of the departure stop, by default from the current minute so
+				// that the requests made during the same minute share their cache entries
+				loc := p.From.Location()
+				datetime := time.Now().In(loc).Truncate(time.Minute)
+				if d := r.URL.Query().Get("datetime"); d != "" {
+					if datetime, err = time.ParseInLocation(datetimeLocalLayout, d, loc); err != nil {
+						return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid datetime"))
+					}
+				}
+				p.Datetime = datetime.Format(datetimeLocalLayout)
+				// a journey between coverages is planned in the default one, usually the national sncf network
+				coverage := ""
+				if p.From.Coverage == p.To.Coverage {
+					coverage = p.From.Coverage
+				}
+				if p.Journeys, err = e.navitia.GetJourneys(r.Context(), coverage, p.From.Id, p.To.Id, datetime, navitia_api_client.JourneyOptions{ArrivalBy: p.ArrivalBy}); err != nil {
+					log.Printf("Could not get journeys from %s to %s from navitia : %+v", p.From.Id, p.To.Id, err)
+					return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get journeys"))
+				}
+			}
+			err = journeyTemplate.ExecuteTemplate(w, "journey.html", p)
+			if err != nil {
+				return newStatusError(http.StatusInternalServerError, err)
+			}
+			return nil
+		default:
+			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	} else {
+		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in journeyHandler"))
+	}
+}
@@ -0,0 +1,196 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJourneyHandler(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "first", Timezone: "Europe/Paris"},
+		model.Stop{Id: "stop_area:test:02", Name: "second"},
+		model.Stop{Id: "stop_area:test:04", Name: "third", City: "Lyon (69003)"},
+	})
+	require.Nil(t, err)
+	e := env{
+		dbEnv: dbEnv,
+		conf:  &config.Config{},
+	}
+	departure := time.Date(2021, 5, 3, 15, 4, 0, 0, time.UTC)
+	journeys1 := []model.Journey{
+		model.Journey{
+			Departure: departure,
+			Arrival:   departure.Add(75 * time.Minute),
+			Duration:  75 * time.Minute,
+			Sections: []model.Section{
+				model.Section{
+					Type:           model.PublicTransportSection,
+					From:           "first",
+					To:             "second",
+					Departure:      departure,
+					Arrival:        departure.Add(75 * time.Minute),
+					Duration:       75 * time.Minute,
+					TrainNumber:    "886823",
+					CommercialMode: "TER",
+				},
+			},
+		},
+	}
+	mock := &NavitiaMockClient{journeys: journeys1, err: nil}
+	e.navitia = mock
+	cookie := &http.Cookie{Name: sessionCookieName, Value: *token1}
+	// test GET requests
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "a simple get when not logged in should redirect to the login page",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey",
+		},
+		expect: httpTestExpect{
+			code:     http.StatusFound,
+			location: "/login",
+		},
+	})
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "a simple get when logged in should display the stop inputs without listing the stops",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<input type="text" id="from" name="from" value="" list="from-stops"`,
+		},
+	})
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "stop names should be resolved to the best match of the stop search",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey?from=First&to=thi",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<input type="text" id="to" name="to" value="third"`,
+		},
+	})
+	require.Equal(t, "stop_area:test:01", mock.from)
+	require.Equal(t, "stop_area:test:04", mock.to)
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "a get with two stops should display the journeys",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey?from=stop_area:test:01&to=stop_area:test:02&represents=departure&datetime=2021-05-03T15:00",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "TER 886823 de first à second",
+		},
+	})
+	// the datetime is read in the timezone of the departure stop
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.Nil(t, err)
+	require.True(t, time.Date(2021, 5, 3, 15, 0, 0, 0, paris).Equal(mock.date))
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "a get without datetime should plan journeys from now",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey?from=stop_area:test:01&to=stop_area:test:02",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "TER 886823 de first à second",
+		},
+	})
+	// truncated to the minute so that the requests of the same minute share their cache entries
+	require.Equal(t, paris, mock.date.Location())
+	require.Equal(t, 0, mock.date.Second())
+	require.WithinDuration(t, time.Now(), mock.date, time.Minute)
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "a stop name matching no stop should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey?from=nowhere&to=stop_area:test:02",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "an unknown stop id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey?from=stop_area:test:01&to=stop_area:test:03",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "an invalid datetime should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey?from=stop_area:test:01&to=stop_area:test:02&datetime=invalid",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	e.navitia = &NavitiaMockClient{err: fmt.Errorf("navitia error")}
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "a navitia error should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey?from=stop_area:test:01&to=stop_area:test:02",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusInternalServerError, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "a post should fail",
+		input: httpTestInput{
+			method: http.MethodPost,
+			path:   "/journey",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, journeyHandler, &httpTestCase{
+		name: "an invalid path should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/journey/invalid",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+}
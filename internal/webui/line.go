@@ -0,0 +1,76 @@
+package webui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// validLineId accepts the line ids of any navitia coverage, like line:OCE:199
+var validLineId = regexp.MustCompile(`^line(:[\w.-]+)+$`)
+
+var lineTemplate = template.Must(template.New("line").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/lineBadge.html", "html/line.html"))
+
+// The page template variable
+type LinePage struct {
+	User *model.User
+	Line model.Line
+	// StopId is the stop the line was looked up from, highlighted in the list of stops
+	StopId string
+	Routes []model.Route
+}
+
+// The line handler of the webui
+func lineHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	if path.Dir(r.URL.Path) == "/line" {
+		user, err := tryAndResumeSession(e, r)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return nil
+		}
+		switch r.Method {
+		case http.MethodGet:
+			id := path.Base(r.URL.Path)
+			if ok := validLineId.MatchString(id); !ok {
+				return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid line id"))
+			}
+			p := LinePage{
+				User: user,
+				Line: model.Line{Id: id},
+			}
+			// lines belong to the coverage of the stop they were looked up from
+			var coverage string
+			if p.StopId = r.URL.Query().Get("stop"); p.StopId != "" {
+				if ok := validStopId.MatchString(p.StopId); !ok {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid stop id"))
+				}
+				stop, err := e.dbEnv.GetStop(r.Context(), p.StopId)
+				if err != nil {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Stop id not found in database"))
+				}
+				coverage = stop.Coverage
+			}
+			if p.Routes, err = e.navitia.GetRoutes(r.Context(), coverage, id); err != nil {
+				log.Printf("Could not get routes of %s from navitia : %+v", id, err)
+				return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get routes"))
+			}
+			if len(p.Routes) > 0 {
+				p.Line = p.Routes[0].Line
+			}
+			err = lineTemplate.ExecuteTemplate(w, "line.html", p)
+			if err != nil {
+				return newStatusError(http.StatusInternalServerError, err)
+			}
+			return nil
+		default:
+			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	} else {
+		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in lineHandler"))
+	}
+}
@@ -0,0 +1,166 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineHandler(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:02", Name: "Crépieux-la-Pape", Coverage: "fr-se"},
+	})
+	require.Nil(t, err)
+	line := model.Line{Id: "line:test:01", Name: "Lyon - Bourg-en-Bresse", Code: "L30", Color: "FFB612", TextColor: "000000", Network: "SNCF", CommercialMode: "TER"}
+	mock := &NavitiaMockClient{routes: []model.Route{
+		model.Route{
+			Id:        "route:test:01",
+			Direction: "Bourg-en-Bresse",
+			Line:      line,
+			Stops: []model.Stop{
+				model.Stop{Id: "stop_area:test:01", Name: "Lyon Part-Dieu"},
+				model.Stop{Id: "stop_area:test:02", Name: "Crépieux-la-Pape"},
+				model.Stop{Id: "stop_area:test:03", Name: "Bourg-en-Bresse"},
+			},
+		},
+	}}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: mock,
+	}
+	cookie := &http.Cookie{Name: sessionCookieName, Value: *token1}
+	// test GET requests
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "a simple get when not logged in should redirect to the login page",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/line:test:01",
+		},
+		expect: httpTestExpect{
+			code:     http.StatusFound,
+			location: "/login",
+		},
+	})
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "an invalid path should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/line:test:01/other",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "an invalid line id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/stop_area:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "an invalid stop id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/line:test:01?stop=invalid",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "an unknown stop id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/line:test:01?stop=stop_area:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "a line should list the ordered stops of its routes",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/line:test:01?stop=stop_area:test:02",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "<li><a href=\"/stop/stop_area:test:01\">Lyon Part-Dieu</a></li>\n\t\t\n\t\t<li><b>Crépieux-la-Pape</b></li>",
+		},
+	})
+	require.Equal(t, "fr-se", mock.coverage)
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "a line should be displayed with its colors",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/line:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<span class="line-badge" style="background-color:#FFB612;color:#000000;">TER L30</span> Lyon - Bourg-en-Bresse`,
+		},
+	})
+	require.Equal(t, "", mock.coverage)
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "a post should fail",
+		input: httpTestInput{
+			method: http.MethodPost,
+			path:   "/line/line:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+		},
+	})
+	mock.routes = nil
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "a line without trains should say so",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/line:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Aucun train ne circule sur cette ligne dans les prochaines 24 heures.",
+		},
+	})
+	mock.err = fmt.Errorf("navitia error")
+	runHttpTest(t, &e, lineHandler, &httpTestCase{
+		name: "a navitia error should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/line/line:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusInternalServerError, simpleErrorMessage},
+		},
+	})
+}
@@ -54,7 +54,7 @@ func loginHandler(e *env, w http.ResponseWriter, r *http.Request) error {
 				return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid password field in POST"))
 			}
 			// try to login
-			user, err := e.dbEnv.Login(&model.UserLogin{Username: username[0], Password: password[0]})
+			user, err := e.dbEnv.Login(r.Context(), &model.UserLogin{Username: username[0], Password: password[0]})
 			if err != nil {
 				switch e := err.(type) {
 				case database.PasswordError:
@@ -69,7 +69,7 @@ func loginHandler(e *env, w http.ResponseWriter, r *http.Request) error {
 				}
 				// TODO display login form with error
 			}
-			token, err := e.dbEnv.CreateSession(user)
+			token, err := e.dbEnv.CreateSession(r.Context(), user)
 			if err != nil {
 				return newStatusError(http.StatusInternalServerError, err)
 			}
@@ -1,6 +1,7 @@
 package webui
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"testing"
@@ -14,13 +15,13 @@ func TestLoginHandler(t *testing.T) {
 	// test environment setup
 	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.Nil(t, err)
-	err = dbEnv.Migrate()
+	err = dbEnv.Migrate(context.Background())
 	require.Nil(t, err)
-	user1, err := dbEnv.CreateUser(&model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
 	require.Nil(t, err)
-	_, err = dbEnv.Login(&model.UserLogin{Username: "user1", Password: "password1"})
+	_, err = dbEnv.Login(context.Background(), &model.UserLogin{Username: "user1", Password: "password1"})
 	require.Nil(t, err)
-	token1, err := dbEnv.CreateSession(user1)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
 	require.Nil(t, err)
 	e := &env{dbEnv: dbEnv}
 	// test GET requests
@@ -0,0 +1,62 @@
+package webui
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// nearbyStopsLimit is the number of stops listed around a location
+const nearbyStopsLimit = 10
+
+var nearbyTemplate = template.Must(template.New("nearby").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/nearby.html"))
+
+// The page template variable
+type NearbyPage struct {
+	User  *model.User
+	Lat   string
+	Lon   string
+	Stops []model.NearbyStop
+}
+
+// The nearby stops handler of the webui
+func nearbyHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path == "/nearby" {
+		user, err := tryAndResumeSession(e, r)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return nil
+		}
+		switch r.Method {
+		case http.MethodGet:
+			query := r.URL.Query()
+			p := NearbyPage{
+				User: user,
+				Lat:  query.Get("lat"),
+				Lon:  query.Get("lon"),
+			}
+			if p.Lat != "" || p.Lon != "" {
+				coord, err := model.ParseCoord(p.Lat, p.Lon)
+				if err != nil {
+					return newStatusError(http.StatusBadRequest, err)
+				}
+				p.Stops, err = e.dbEnv.GetNearbyStops(r.Context(), *coord, nearbyStopsLimit)
+				if err != nil {
+					return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get train stops"))
+				}
+			}
+			w.Header().Set("Cache-Control", "no-store, no-cache")
+			err = nearbyTemplate.ExecuteTemplate(w, "nearby.html", p)
+			if err != nil {
+				return newStatusError(http.StatusInternalServerError, err)
+			}
+			return nil
+		default:
+			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	} else {
+		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in nearbyHandler"))
+	}
+}
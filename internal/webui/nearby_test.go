@@ -0,0 +1,150 @@
+package webui
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNearbyHandler(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "Lyon Perrache", Coverage: "sncf", Coord: &model.Coord{Lat: 45.748439, Lon: 4.825781}},
+		model.Stop{Id: "stop_area:test:02", Name: "Lyon Part-Dieu", Coverage: "sncf", Coord: &model.Coord{Lat: 45.760593, Lon: 4.859666}},
+		model.Stop{Id: "stop_area:test:03", Name: "Somewhere", Coverage: "sncf"},
+	})
+	require.Nil(t, err)
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: &NavitiaMockClient{},
+	}
+	// test GET requests
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "a simple get when not logged in should redirect to the login page",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby",
+		},
+		expect: httpTestExpect{
+			code:     http.StatusFound,
+			location: "/login",
+		},
+	})
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "a simple get when logged in should display the location form",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Me localiser",
+		},
+	})
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "a location should list the closest stops with their distance",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby?lat=45.757814&lon=4.832011",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<a href="/stop/stop_area:test:01">Lyon Perrache</a> à 1,1 km`,
+		},
+	})
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "a location very close to a stop should display the distance in meters",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby?lat=45.76&lon=4.86",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<a href="/stop/stop_area:test:02">Lyon Part-Dieu</a> à 70 m`,
+		},
+	})
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "an invalid latitude should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby?lat=north&lon=4.832011",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "a latitude which is not a number should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby?lat=NaN&lon=4.832011",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "an infinite longitude should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby?lat=45.757814&lon=-Inf",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "an out of range longitude should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby?lat=45.757814&lon=200",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	// test other methods
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "a post should fail",
+		input: httpTestInput{
+			method: http.MethodPost,
+			path:   "/nearby",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, nearbyHandler, &httpTestCase{
+		name: "an invalid path should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/nearby/test",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+}
@@ -1,7 +1,9 @@
 package webui
 
 import (
+	"crypto/subtle"
 	"net/http"
+	"strings"
 
 	"git.adyxax.org/adyxax/trains/pkg/model"
 )
@@ -11,9 +13,30 @@ func tryAndResumeSession(e *env, r *http.Request) (*model.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	user, err := e.dbEnv.ResumeSession(cookie.Value)
+	user, err := e.dbEnv.ResumeSession(r.Context(), cookie.Value)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
+
+// authorizeFeed returns true when the feeds can be read: by a logged in user, or by another tool giving one of the
+// configured feed tokens as a bearer token or in the token query parameter
+func authorizeFeed(e *env, r *http.Request) bool {
+	if _, err := tryAndResumeSession(e, r); err == nil {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token == "" {
+		return false
+	}
+	for _, t := range e.conf.FeedTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package webui
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// siriProducerRef identifies this service in the SIRI deliveries
+const siriProducerRef = "trains"
+
+// SIRI-Lite encodes the strings and references of the SIRI xml schema as objects with a value
+type siriValue struct {
+	Value string `json:"value"`
+}
+
+type siriResponse struct {
+	Siri struct {
+		ServiceDelivery siriServiceDelivery
+	}
+}
+
+type siriServiceDelivery struct {
+	ResponseTimestamp      string
+	ProducerRef            siriValue
+	StopMonitoringDelivery []siriStopMonitoringDelivery
+}
+
+type siriStopMonitoringDelivery struct {
+	ResponseTimestamp  string
+	Version            string
+	Status             bool
+	ErrorCondition     *siriErrorCondition `json:",omitempty"`
+	MonitoringRef      []siriValue
+	MonitoredStopVisit []siriMonitoredStopVisit
+}
+
+type siriErrorCondition struct {
+	ServiceNotAvailableError siriError
+}
+
+type siriError struct {
+	ErrorText string
+}
+
+type siriMonitoredStopVisit struct {
+	RecordedAtTime          string
+	ItemIdentifier          string
+	MonitoringRef           siriValue
+	MonitoredVehicleJourney siriMonitoredVehicleJourney
+}
+
+type siriMonitoredVehicleJourney struct {
+	LineRef                 siriValue
+	FramedVehicleJourneyRef siriFramedVehicleJourneyRef
+	PublishedLineName       []siriValue `json:",omitempty"`
+	DirectionName           []siriValue `json:",omitempty"`
+	DestinationName         []siriValue `json:",omitempty"`
+	VehicleMode             []string
+	TrainNumbers            *siriTrainNumbers `json:",omitempty"`
+	MonitoredCall           siriMonitoredCall
+}
+
+type siriFramedVehicleJourneyRef struct {
+	DataFrameRef           siriValue
+	DatedVehicleJourneyRef string
+}
+
+type siriTrainNumbers struct {
+	TrainNumberRef []siriValue
+}
+
+type siriMonitoredCall struct {
+	StopPointRef          siriValue
+	StopPointName         []siriValue
+	AimedArrivalTime      string
+	ExpectedArrivalTime   string `json:",omitempty"`
+	AimedDepartureTime    string
+	ExpectedDepartureTime string `json:",omitempty"`
+	DepartureStatus       string
+}
+
+// newSiriMonitoredStopVisit converts a departure to SIRI, the expected times are only given with real-time information
+func newSiriMonitoredStopVisit(stop *model.Stop, d model.Departure, recordedAt time.Time) siriMonitoredStopVisit {
+	vehicleJourney := d.VehicleJourney
+	if vehicleJourney == "" {
+		vehicleJourney = d.TrainNumber
+	}
+	v := siriMonitoredStopVisit{
+		RecordedAtTime: recordedAt.Format(time.RFC3339),
+		ItemIdentifier: fmt.Sprintf("%s:%s:%s", vehicleJourney, d.BaseDeparture.Format("2006-01-02"), stop.Id),
+		MonitoringRef:  siriValue{stop.Id},
+		MonitoredVehicleJourney: siriMonitoredVehicleJourney{
+			LineRef: siriValue{d.Line},
+			FramedVehicleJourneyRef: siriFramedVehicleJourneyRef{
+				DataFrameRef:           siriValue{d.BaseDeparture.Format("2006-01-02")},
+				DatedVehicleJourneyRef: vehicleJourney,
+			},
+			VehicleMode: []string{"rail"},
+			MonitoredCall: siriMonitoredCall{
+				StopPointRef:       siriValue{stop.Id},
+				StopPointName:      []siriValue{siriValue{stop.Name}},
+				AimedArrivalTime:   d.BaseArrival.Format(time.RFC3339),
+				AimedDepartureTime: d.BaseDeparture.Format(time.RFC3339),
+			},
+		},
+	}
+	j := &v.MonitoredVehicleJourney
+	if d.LineName != "" {
+		j.PublishedLineName = []siriValue{siriValue{d.LineName}}
+	}
+	if d.Direction != "" {
+		j.DirectionName = []siriValue{siriValue{d.Direction}}
+		j.DestinationName = []siriValue{siriValue{d.Direction}}
+	}
+	if d.TrainNumber != "" {
+		j.TrainNumbers = &siriTrainNumbers{TrainNumberRef: []siriValue{siriValue{d.TrainNumber}}}
+	}
+	c := &j.MonitoredCall
+	switch {
+	case d.Cancelled:
+		c.DepartureStatus = "cancelled"
+	case !d.RealTime:
+		c.DepartureStatus = "noReport"
+	default:
+		c.ExpectedArrivalTime = d.Arrival.Format(time.RFC3339)
+		c.ExpectedDepartureTime = d.Departure.Format(time.RFC3339)
+		if d.Delayed() {
+			c.DepartureStatus = "delayed"
+		} else {
+			c.DepartureStatus = "onTime"
+		}
+	}
+	return v
+}
+
+// The SIRI-Lite stop monitoring endpoint of the webui, for displays and third party applications to follow the
+// departures of a stop area. Departures are fetched like the stop pages do, sharing the client cache, and the last good
+// board is served when that fails. Reading it does not watch the stop.
+func siriStopMonitoringHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path == "/siri/stop-monitoring.json" {
+		if !authorizeFeed(e, r) {
+			return newStatusError(http.StatusUnauthorized, fmt.Errorf(http.StatusText(http.StatusUnauthorized)))
+		}
+		switch r.Method {
+		case http.MethodGet:
+			id := r.URL.Query().Get("MonitoringRef")
+			if id == "" {
+				return newStatusError(http.StatusBadRequest, fmt.Errorf("No MonitoringRef in query string"))
+			}
+			if ok := validStopId.MatchString(id); !ok {
+				return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid MonitoringRef"))
+			}
+			maximum := -1
+			if s := r.URL.Query().Get("MaximumStopVisits"); s != "" {
+				var err error
+				if maximum, err = strconv.Atoi(s); err != nil || maximum < 0 {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid MaximumStopVisits"))
+				}
+			}
+			stop, err := e.dbEnv.GetStop(r.Context(), id)
+			if err != nil {
+				return newStatusError(http.StatusBadRequest, fmt.Errorf("Stop id not found in database"))
+			}
+			now := time.Now()
+			delivery := siriStopMonitoringDelivery{
+				ResponseTimestamp:  now.Format(time.RFC3339),
+				Version:            "2.0",
+				Status:             true,
+				MonitoringRef:      []siriValue{siriValue{stop.Id}},
+				MonitoredStopVisit: []siriMonitoredStopVisit{},
+			}
+			recordedAt := now
+			departures, err := e.navitia.GetDepartures(r.Context(), stop.Coverage, stop.Id, boardOptions(e))
+			if err != nil {
+				log.Printf("Could not get departures of %s from navitia : %+v", stop.Id, err)
+				var updatedAt *time.Time
+				if departures, updatedAt, err = e.dbEnv.GetDepartures(r.Context(), stop.Id); err == nil {
+					recordedAt = *updatedAt
+				}
+			}
+			if err != nil {
+				delivery.Status = false
+				delivery.ErrorCondition = &siriErrorCondition{ServiceNotAvailableError: siriError{ErrorText: "Could not get departures"}}
+			}
+			loc := stop.Location()
+			for _, d := range departures {
+				if len(delivery.MonitoredStopVisit) == maximum {
+					break
+				}
+				// the last good board can be old, the trains which already left are not visits anymore
+				if d.Departure.Before(now) {
+					continue
+				}
+				delivery.MonitoredStopVisit = append(delivery.MonitoredStopVisit, newSiriMonitoredStopVisit(stop, d.In(loc), recordedAt.In(loc)))
+			}
+			var resp siriResponse
+			resp.Siri.ServiceDelivery = siriServiceDelivery{
+				ResponseTimestamp:      delivery.ResponseTimestamp,
+				ProducerRef:            siriValue{siriProducerRef},
+				StopMonitoringDelivery: []siriStopMonitoringDelivery{delivery},
+			}
+			w.Header().Set("Cache-Control", "no-store, no-cache")
+			w.Header().Set("Content-Type", "application/json")
+			return json.NewEncoder(w).Encode(resp)
+		default:
+			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	} else {
+		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in siriStopMonitoringHandler"))
+	}
+}
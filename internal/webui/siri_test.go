@@ -0,0 +1,223 @@
+package webui
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// siriTestToken is the feed token of the tests
+const siriTestToken = "0123456789abcdef0123456789abcdef"
+
+// siriStopMonitoring runs a stop monitoring request, checks the response against the SIRI-Lite schema and decodes its
+// delivery. The schema is hand-written, not the official one, see its $comment
+// TODO vendor the official SIRI-Lite StopMonitoring json schema, with its source url and version, and validate against it
+func siriStopMonitoring(t *testing.T, e *env, path string) (delivery siriStopMonitoringDelivery) {
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat = true
+	schema, err := compiler.Compile("test_data/siri-lite-stop-monitoring.schema.json")
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+siriTestToken)
+	rr := httptest.NewRecorder()
+	require.NoError(t, siriStopMonitoringHandler(e, rr, req))
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(rr.Body.Bytes()))
+	decoder.UseNumber()
+	require.NoError(t, decoder.Decode(&v))
+	require.NoError(t, schema.Validate(v))
+	var resp siriResponse
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Len(t, resp.Siri.ServiceDelivery.StopMonitoringDelivery, 1)
+	return resp.Siri.ServiceDelivery.StopMonitoringDelivery[0]
+}
+
+func TestSiriStopMonitoringHandler(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "Crépieux-la-Pape", Coverage: "sncf", Timezone: "Europe/Paris"},
+		model.Stop{Id: "stop_area:test:02", Name: "never displayed", Coverage: "sncf"},
+	})
+	require.Nil(t, err)
+	// the trains leave in the future so that they are not dropped as already left
+	at := func(hour int, min int) time.Time { return time.Date(2099, time.May, 3, hour, min, 0, 0, time.UTC) }
+	left := time.Date(2021, time.May, 3, 11, 8, 0, 0, time.UTC)
+	departures := []model.Departure{
+		model.Departure{Direction: "Lyon Part-Dieu (Lyon)", TrainNumber: "886821", Line: "line:OCE:199", BaseArrival: left, Arrival: left, BaseDeparture: left, Departure: left},
+		model.Departure{
+			Direction:      "Ambérieu-en-Bugey (Ambérieu-en-Bugey)",
+			TrainNumber:    "886823",
+			CommercialMode: "TER",
+			Line:           "line:OCE:199",
+			LineName:       "St-Etienne - Lyon - Ambérieu",
+			VehicleJourney: "vehicle_journey:OCE:SN886823F29029_dst_1",
+			BaseArrival:    at(11, 17),
+			Arrival:        at(11, 22),
+			BaseDeparture:  at(11, 18),
+			Departure:      at(11, 23),
+			Delay:          5 * time.Minute,
+			RealTime:       true,
+		},
+		model.Departure{Direction: "Lyon Part-Dieu (Lyon)", TrainNumber: "886825", Line: "line:OCE:199", BaseArrival: at(11, 47), Arrival: at(11, 47), BaseDeparture: at(11, 48), Departure: at(11, 48)},
+		model.Departure{Direction: "Lyon Part-Dieu (Lyon)", TrainNumber: "886827", Line: "line:OCE:199", BaseArrival: at(12, 17), Arrival: at(12, 17), BaseDeparture: at(12, 18), Departure: at(12, 18), RealTime: true, Cancelled: true},
+	}
+	mock := &NavitiaMockClient{departures: departures}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{Board: config.BoardConfig{Count: 20, Window: 2 * time.Hour}, FeedTokens: []string{siriTestToken}},
+		navitia: mock,
+	}
+	// test GET requests, the departures are fetched like the stop pages do and the trains which already left dropped
+	delivery := siriStopMonitoring(t, &e, "/siri/stop-monitoring.json?MonitoringRef=stop_area:test:01")
+	require.True(t, delivery.Status)
+	require.Equal(t, []siriValue{siriValue{"stop_area:test:01"}}, delivery.MonitoringRef)
+	require.Len(t, delivery.MonitoredStopVisit, 3)
+	require.Equal(t, "sncf", mock.coverage)
+	require.Equal(t, boardOptions(&e), mock.boardOptions)
+	recordedAt, err := time.Parse(time.RFC3339, delivery.MonitoredStopVisit[0].RecordedAtTime)
+	require.Nil(t, err)
+	require.WithinDuration(t, time.Now(), recordedAt, time.Minute)
+	v := delivery.MonitoredStopVisit[0]
+	require.Equal(t, siriValue{"stop_area:test:01"}, v.MonitoringRef)
+	require.Equal(t, siriMonitoredVehicleJourney{
+		LineRef: siriValue{"line:OCE:199"},
+		FramedVehicleJourneyRef: siriFramedVehicleJourneyRef{
+			DataFrameRef:           siriValue{"2099-05-03"},
+			DatedVehicleJourneyRef: "vehicle_journey:OCE:SN886823F29029_dst_1",
+		},
+		PublishedLineName: []siriValue{siriValue{"St-Etienne - Lyon - Ambérieu"}},
+		DirectionName:     []siriValue{siriValue{"Ambérieu-en-Bugey (Ambérieu-en-Bugey)"}},
+		DestinationName:   []siriValue{siriValue{"Ambérieu-en-Bugey (Ambérieu-en-Bugey)"}},
+		VehicleMode:       []string{"rail"},
+		TrainNumbers:      &siriTrainNumbers{TrainNumberRef: []siriValue{siriValue{"886823"}}},
+		MonitoredCall: siriMonitoredCall{
+			StopPointRef:          siriValue{"stop_area:test:01"},
+			StopPointName:         []siriValue{siriValue{"Crépieux-la-Pape"}},
+			AimedArrivalTime:      "2099-05-03T13:17:00+02:00",
+			ExpectedArrivalTime:   "2099-05-03T13:22:00+02:00",
+			AimedDepartureTime:    "2099-05-03T13:18:00+02:00",
+			ExpectedDepartureTime: "2099-05-03T13:23:00+02:00",
+			DepartureStatus:       "delayed",
+		},
+	}, v.MonitoredVehicleJourney)
+	// without real-time information there is no expected time
+	c := delivery.MonitoredStopVisit[1].MonitoredVehicleJourney.MonitoredCall
+	require.Equal(t, "noReport", c.DepartureStatus)
+	require.Equal(t, "", c.ExpectedDepartureTime)
+	require.Equal(t, "886825", delivery.MonitoredStopVisit[1].MonitoredVehicleJourney.FramedVehicleJourneyRef.DatedVehicleJourneyRef)
+	require.Equal(t, "cancelled", delivery.MonitoredStopVisit[2].MonitoredVehicleJourney.MonitoredCall.DepartureStatus)
+	delivery = siriStopMonitoring(t, &e, "/siri/stop-monitoring.json?MonitoringRef=stop_area:test:01&MaximumStopVisits=1")
+	require.Len(t, delivery.MonitoredStopVisit, 1)
+	require.Equal(t, "886823", delivery.MonitoredStopVisit[0].MonitoredVehicleJourney.TrainNumbers.TrainNumberRef[0].Value)
+	// the last good board is served when navitia fails
+	updatedAt := time.Date(2021, time.May, 3, 11, 10, 0, 0, time.UTC)
+	require.Nil(t, dbEnv.SaveDepartures(context.Background(), "stop_area:test:01", departures, updatedAt))
+	e.navitia = &NavitiaMockClient{err: fmt.Errorf("navitia error")}
+	delivery = siriStopMonitoring(t, &e, "/siri/stop-monitoring.json?MonitoringRef=stop_area:test:01")
+	require.True(t, delivery.Status)
+	require.Len(t, delivery.MonitoredStopVisit, 3)
+	require.Equal(t, "2021-05-03T13:10:00+02:00", delivery.MonitoredStopVisit[0].RecordedAtTime)
+	// a stop without saved board has no departures then
+	delivery = siriStopMonitoring(t, &e, "/siri/stop-monitoring.json?MonitoringRef=stop_area:test:02")
+	require.False(t, delivery.Status)
+	require.NotNil(t, delivery.ErrorCondition)
+	require.Empty(t, delivery.MonitoredStopVisit)
+	// reading stops does not watch them
+	watched, err := dbEnv.GetWatchedStops(context.Background(), time.Time{})
+	require.Nil(t, err)
+	require.Empty(t, watched)
+	// test errors
+	testCases := []httpTestCase{
+		{
+			name: "a missing token should fail",
+			input: httpTestInput{
+				method: http.MethodGet,
+				path:   "/siri/stop-monitoring.json?MonitoringRef=stop_area:test:01",
+			},
+			expect: httpTestExpect{
+				err: &statusError{http.StatusUnauthorized, simpleErrorMessage},
+			},
+		},
+		{
+			name: "a missing MonitoringRef should fail",
+			input: httpTestInput{
+				method: http.MethodGet,
+				path:   "/siri/stop-monitoring.json?token=" + siriTestToken,
+			},
+			expect: httpTestExpect{
+				err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+			},
+		},
+		{
+			name: "an invalid MonitoringRef should fail",
+			input: httpTestInput{
+				method: http.MethodGet,
+				path:   "/siri/stop-monitoring.json?MonitoringRef=%3Cinvalid%3E&token=" + siriTestToken,
+			},
+			expect: httpTestExpect{
+				err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+			},
+		},
+		{
+			name: "an unknown MonitoringRef should fail",
+			input: httpTestInput{
+				method: http.MethodGet,
+				path:   "/siri/stop-monitoring.json?MonitoringRef=stop_area:test:03&token=" + siriTestToken,
+			},
+			expect: httpTestExpect{
+				err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+			},
+		},
+		{
+			name: "an invalid MaximumStopVisits should fail",
+			input: httpTestInput{
+				method: http.MethodGet,
+				path:   "/siri/stop-monitoring.json?MonitoringRef=stop_area:test:01&MaximumStopVisits=-1&token=" + siriTestToken,
+			},
+			expect: httpTestExpect{
+				err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+			},
+		},
+		{
+			name: "a post should fail",
+			input: httpTestInput{
+				method: http.MethodPost,
+				path:   "/siri/stop-monitoring.json?MonitoringRef=stop_area:test:01&token=" + siriTestToken,
+			},
+			expect: httpTestExpect{
+				err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+			},
+		},
+		{
+			name: "an invalid path should fail",
+			input: httpTestInput{
+				method: http.MethodGet,
+				path:   "/siri/stop-monitoring.xml?MonitoringRef=stop_area:test:01",
+			},
+			expect: httpTestExpect{
+				err: &statusError{http.StatusNotFound, simpleErrorMessage},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		runHttpTest(t, &e, siriStopMonitoringHandler, &tc)
+	}
+}
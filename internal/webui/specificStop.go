@@ -1,25 +1,114 @@
 package webui
 
 import (
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"path"
 	"regexp"
+	"time"
 
+	"git.adyxax.org/adyxax/trains/pkg/gtfs"
 	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
 )
 
-var validStopId = regexp.MustCompile(`^stop_area:[a-zA-Z]+:\d+$`)
+// validStopId accepts the stop area ids of any navitia coverage, like stop_area:SNCF:87723197 or stop_area:TCL:SA:30101
+var validStopId = regexp.MustCompile(`^stop_area(:[\w.-]+)+$`)
 
-var specificStopTemplate = template.Must(template.New("specificStop").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/specificStop.html"))
+// validTrainKey accepts the vehicle journey ids and train numbers identifying the trains already shown on a board
+var validTrainKey = regexp.MustCompile(`^[\w.:-]+$`)
+
+var specificStopTemplate = template.Must(template.New("specificStop").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/lineBadge.html", "html/specificStop.html"))
 
 // The page template variable
 type SpecificStopPage struct {
-	User       *model.User
-	Stop       string
-	Departures []model.Departure
+	User         *model.User
+	Stop         string
+	StopId       string
+	City         string
+	ShowArrivals bool
+	// NavitiaBackend is set when the backend knows the arrivals and timetables of the stop, the gtfs one only knows its
+	// departures
+	NavitiaBackend bool
+	// Timezone is the timezone of the stop the times are displayed in, when known
+	Timezone string
+	// From is the datetime of the first train when browsing later trains, in the datetime-local input layout
+	From string
+	// Later is the From datetime of the next trains, empty when there are none
+	Later string
+	// LaterShown identifies the trains of the Later minute already shown, so that the next page does not repeat them
+	LaterShown []string
+	// StaleSince is set when the navitia api is unavailable and we display the last good board we got
+	StaleSince *time.Time
+	// StaleDate is set when the last good board is not from today, its date is then displayed too
+	StaleDate   bool
+	Departures  []model.Departure
+	Arrivals    []model.Arrival
+	Disruptions []model.Disruption
+	// Lines are the lines serving the stop
+	Lines []model.Line
+}
+
+// stopDisruptions gathers the disruptions affecting a list of trains, without duplicates nor past ones
+func stopDisruptions(lists ...[]model.Disruption) (disruptions []model.Disruption) {
+	seen := make(map[string]bool)
+	for _, list := range lists {
+		for _, d := range list {
+			if seen[d.Id] || d.Status == "past" {
+				continue
+			}
+			seen[d.Id] = true
+			disruptions = append(disruptions, d)
+		}
+	}
+	return
+}
+
+// displayedDisruptions returns the disruptions of a train that are displayed on the page, so that its markers only link
+// to existing anchors
+func displayedDisruptions(list []model.Disruption, displayed []model.Disruption) (disruptions []model.Disruption) {
+	for _, d := range list {
+		for _, shown := range displayed {
+			if d.Id == shown.Id {
+				disruptions = append(disruptions, d)
+				break
+			}
+		}
+	}
+	return
+}
+
+// trainKey identifies a train on a board, by its vehicle journey or by its number when navitia does not give it
+func trainKey(vehicleJourney string, trainNumber string) string {
+	if vehicleJourney != "" {
+		return vehicleJourney
+	}
+	return trainNumber
+}
+
+// laterCursor returns where the next page of a board starts: at the minute of its last train, along with the trains of
+// that minute already shown. Starting a minute later would skip the other trains scheduled at the same time. The
+// trains of that minute shown on the previous pages are carried along when the board did not move past it.
+func laterCursor(times []time.Time, keys []string, from time.Time, shown []string) (later string, laterShown []string) {
+	last := times[len(times)-1].Truncate(time.Minute)
+	if last.Equal(from) {
+		laterShown = append(laterShown, shown...)
+	}
+	for i, t := range times {
+		if t.Truncate(time.Minute).Equal(last) && keys[i] != "" {
+			laterShown = append(laterShown, keys[i])
+		}
+	}
+	return last.Format(datetimeLocalLayout), laterShown
+}
+
+// boardOptions returns the options of the boards of the next trains, the requests made with the same options share
+// their entries in the navitia client cache
+func boardOptions(e *env) navitia_api_client.BoardOptions {
+	return navitia_api_client.BoardOptions{Count: e.conf.Board.Count, Duration: e.conf.Board.Window}
 }
 
 // The stop handler of the webui
@@ -39,29 +128,141 @@ func specificStopHandler(e *env, w http.ResponseWriter, r *http.Request) error {
 			if ok := validStopId.MatchString(id); !ok {
 				return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid stop id"))
 			}
-			stop, err := e.dbEnv.GetStop(id)
+			stop, err := e.dbEnv.GetStop(r.Context(), id)
 			if err != nil {
 				return newStatusError(http.StatusBadRequest, fmt.Errorf("Stop id not found in database")) // TODO do better
 			}
-			if departures, err := e.navitia.GetDepartures(stop.Id); err != nil {
-				log.Printf("%s; data returned: %+v\n", err, departures)
-				return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get departures"))
+			p := SpecificStopPage{
+				User:           user,
+				Stop:           stop.Name,
+				StopId:         stop.Id,
+				City:           stop.City,
+				ShowArrivals:   r.URL.Query().Get("board") == "arrivals",
+				NavitiaBackend: e.conf.Backend != "gtfs",
+				Timezone:       stop.Timezone,
+			}
+			loc := stop.Location()
+			options := boardOptions(e)
+			if p.From = r.URL.Query().Get("from"); p.From != "" {
+				if options.From, err = time.ParseInLocation(datetimeLocalLayout, p.From, loc); err != nil {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid from datetime"))
+				}
+			}
+			// the trains of the from minute already shown on the previous page
+			shownList := r.URL.Query()["shown"]
+			shown := make(map[string]bool)
+			for _, key := range shownList {
+				if ok := validTrainKey.MatchString(key); !ok || p.From == "" {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid shown train"))
+				}
+				shown[key] = true
+			}
+			// only the boards of the next trains are kept for when the navitia api is unavailable, the client saves them
+			// each time it fetches them
+			live := options.From.IsZero()
+			now := time.Now()
+			// the trains of the stops users watch are published in the GTFS-RT feed
+			if live {
+				if err := e.dbEnv.WatchStop(r.Context(), stop.Id, now); err != nil {
+					log.Printf("Could not watch stop %s : %+v", stop.Id, err)
+				}
+			}
+			var disruptions [][]model.Disruption
+			if p.ShowArrivals {
+				if p.Arrivals, err = e.navitia.GetArrivals(r.Context(), stop.Coverage, stop.Id, options); err != nil {
+					if errors.As(err, &gtfs.NotSupportedError{}) {
+						return newStatusError(http.StatusNotFound, fmt.Errorf("Arrivals are not supported by the backend"))
+					}
+					log.Printf("Could not get arrivals of %s from navitia : %+v", stop.Id, err)
+					if !live {
+						return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get arrivals"))
+					}
+					if p.Arrivals, p.StaleSince, err = e.dbEnv.GetArrivals(r.Context(), stop.Id); err != nil {
+						return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get arrivals"))
+					}
+				}
+				// the board is shared with the navitia client cache, it is copied before being converted for display
+				arrivals := p.Arrivals
+				p.Arrivals = nil
+				var times []time.Time
+				var keys []string
+				for _, arrival := range arrivals {
+					key := trainKey(arrival.VehicleJourney, arrival.TrainNumber)
+					if shown[key] && arrival.BaseArrival.Truncate(time.Minute).Equal(options.From) {
+						continue
+					}
+					// the last good board can be old, the trains which already arrived are not displayed
+					if p.StaleSince != nil && arrival.Arrival.Before(now) {
+						continue
+					}
+					p.Arrivals = append(p.Arrivals, arrival.In(loc))
+					disruptions = append(disruptions, arrival.Disruptions)
+					times = append(times, arrival.BaseArrival)
+					keys = append(keys, key)
+				}
+				if len(p.Arrivals) > 0 && p.StaleSince == nil {
+					p.Later, p.LaterShown = laterCursor(times, keys, options.From, shownList)
+				}
 			} else {
-				w.Header().Set("Cache-Control", "no-store, no-cache")
-				p := SpecificStopPage{
-					User:       user,
-					Stop:       stop.Name,
-					Departures: departures,
+				if p.Departures, err = e.navitia.GetDepartures(r.Context(), stop.Coverage, stop.Id, options); err != nil {
+					log.Printf("Could not get departures of %s from navitia : %+v", stop.Id, err)
+					if !live {
+						return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get departures"))
+					}
+					if p.Departures, p.StaleSince, err = e.dbEnv.GetDepartures(r.Context(), stop.Id); err != nil {
+						return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get departures"))
+					}
+				}
+				// the board is shared with the navitia client cache, it is copied before being converted for display
+				departures := p.Departures
+				p.Departures = nil
+				var times []time.Time
+				var keys []string
+				for _, departure := range departures {
+					key := trainKey(departure.VehicleJourney, departure.TrainNumber)
+					if shown[key] && departure.BaseDeparture.Truncate(time.Minute).Equal(options.From) {
+						continue
+					}
+					// the last good board can be old, the trains which already left are not displayed
+					if p.StaleSince != nil && departure.Departure.Before(now) {
+						continue
+					}
+					p.Departures = append(p.Departures, departure.In(loc))
+					disruptions = append(disruptions, departure.Disruptions)
+					times = append(times, departure.BaseDeparture)
+					keys = append(keys, key)
 				}
-				err = specificStopTemplate.ExecuteTemplate(w, "specificStop.html", p)
-				if err != nil {
-					return newStatusError(http.StatusInternalServerError, err)
+				if len(p.Departures) > 0 && p.StaleSince == nil {
+					p.Later, p.LaterShown = laterCursor(times, keys, options.From, shownList)
 				}
-				return nil
 			}
+			p.Disruptions = stopDisruptions(disruptions...)
+			for i := range p.Departures {
+				p.Departures[i].Disruptions = displayedDisruptions(p.Departures[i].Disruptions, p.Disruptions)
+			}
+			for i := range p.Arrivals {
+				p.Arrivals[i].Disruptions = displayedDisruptions(p.Arrivals[i].Disruptions, p.Disruptions)
+			}
+			// the gtfs backend does not know the lines, which is not worth a log on every view
+			if p.Lines, err = e.navitia.GetLines(r.Context(), stop.Coverage, stop.Id); err != nil && !errors.As(err, &gtfs.NotSupportedError{}) {
+				log.Printf("Could not get lines of %s from navitia : %+v", stop.Id, err)
+			}
+			if p.StaleSince != nil {
+				staleSince := p.StaleSince.In(loc)
+				p.StaleSince = &staleSince
+				p.StaleDate = staleSince.Format("2006-01-02") != now.In(loc).Format("2006-01-02")
+			}
+			w.Header().Set("Cache-Control", "no-store, no-cache")
+			err = specificStopTemplate.ExecuteTemplate(w, "specificStop.html", p)
+			if err != nil {
+				return newStatusError(http.StatusInternalServerError, err)
+			}
+			return nil
 		default:
 			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
 		}
+	} else if path.Base(r.URL.Path) == "timetable" && path.Dir(path.Dir(r.URL.Path)) == "/stop" {
+		return timetableHandler(e, w, r)
 	} else {
 		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in specificStopHandler"))
 	}
@@ -1,12 +1,21 @@
 package webui
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
 	"git.adyxax.org/adyxax/trains/pkg/config"
 	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/gtfs"
 	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
 	"github.com/stretchr/testify/require"
 )
 
@@ -14,15 +23,15 @@ func TestSpecificStopHandler(t *testing.T) {
 	// test environment setup
 	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.Nil(t, err)
-	err = dbEnv.Migrate()
+	err = dbEnv.Migrate(context.Background())
 	require.Nil(t, err)
-	user1, err := dbEnv.CreateUser(&model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
 	require.Nil(t, err)
-	_, err = dbEnv.Login(&model.UserLogin{Username: "user1", Password: "password1"})
+	_, err = dbEnv.Login(context.Background(), &model.UserLogin{Username: "user1", Password: "password1"})
 	require.Nil(t, err)
-	token1, err := dbEnv.CreateSession(user1)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
 	require.Nil(t, err)
-	err = dbEnv.ReplaceAndImportStops([]model.Stop{model.Stop{Id: "stop_area:test:01", Name: "test"}})
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{model.Stop{Id: "stop_area:test:01", Name: "test"}})
 	require.Nil(t, err)
 	e := env{
 		dbEnv: dbEnv,
@@ -30,8 +39,9 @@ func TestSpecificStopHandler(t *testing.T) {
 	}
 	departures1 := []model.Departure{
 		model.Departure{
-			Direction: "test direction",
-			Arrival:   "20210503T150405",
+			Direction:     "test direction",
+			BaseDeparture: time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC),
+			Departure:     time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC),
 		},
 	}
 	e.navitia = &NavitiaMockClient{departures: departures1, err: nil}
@@ -59,4 +69,737 @@ func TestSpecificStopHandler(t *testing.T) {
 			bodyString: "Horaires des prochains trains à test",
 		},
 	})
+	mock := &NavitiaMockClient{departures: departures1}
+	e.navitia = mock
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{model.Stop{Id: "stop_area:TCL:SA:30101", Name: "Part-Dieu", Coverage: "fr-se"}})
+	require.Nil(t, err)
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a stop from another coverage should be queried from its coverage",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:TCL:SA:30101",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Horaires des prochains trains à Part-Dieu",
+		},
+	})
+	require.Equal(t, "fr-se", mock.coverage)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:TCL:SA:30101", Name: "Part-Dieu", Coverage: "fr-se"},
+		model.Stop{Id: "stop_area:SNCF:87722025", Name: "Lyon Part-Dieu", Coverage: "sncf", City: "Lyon (69003)", Timezone: "Europe/Paris"},
+	})
+	require.Nil(t, err)
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a stop with metadata should display its city and its times in its timezone",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:SNCF:87722025",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Lyon (69003) — heures locales (Europe/Paris)",
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "departure times should be displayed in the stop timezone",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:SNCF:87722025",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: " 17:04</td>",
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "an invalid stop id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:TCL:SA:30101%20OR%201=1",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+}
+
+func TestSpecificStopHandlerRealTime(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{model.Stop{Id: "stop_area:test:01", Name: "test"}})
+	require.Nil(t, err)
+	e := env{
+		dbEnv: dbEnv,
+		conf:  &config.Config{},
+	}
+	base := time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC)
+	e.navitia = &NavitiaMockClient{departures: []model.Departure{
+		model.Departure{
+			Direction:     "delayed direction",
+			BaseDeparture: base,
+			Departure:     base.Add(12 * time.Minute),
+			Delay:         12 * time.Minute,
+			RealTime:      true,
+		},
+	}}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a delayed train should display its delay",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Retard 12 min",
+		},
+	})
+	e.navitia = &NavitiaMockClient{departures: []model.Departure{
+		model.Departure{
+			Direction:     "cancelled direction",
+			BaseDeparture: base,
+			Departure:     base,
+			RealTime:      true,
+			Cancelled:     true,
+		},
+	}}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a cancelled train should be displayed as such",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Supprimé",
+		},
+	})
+	disruption := model.Disruption{
+		Id:       "disruption-test",
+		Status:   "active",
+		Cause:    "Mouvement social",
+		Severity: model.Severity{Name: "trip canceled", Effect: "NO_SERVICE"},
+		Messages: []string{"Train supprimé en raison d'un mouvement social"},
+	}
+	e.navitia = &NavitiaMockClient{departures: []model.Departure{
+		model.Departure{
+			Direction:     "cancelled direction",
+			BaseDeparture: base,
+			Departure:     base,
+			Cancelled:     true,
+			Disruptions:   []model.Disruption{disruption},
+		},
+		model.Departure{
+			Direction:     "other cancelled direction",
+			BaseDeparture: base,
+			Departure:     base,
+			Cancelled:     true,
+			Disruptions:   []model.Disruption{disruption},
+		},
+	}}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "disruptions should be displayed in a banner",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Train supprimé en raison d&#39;un mouvement social",
+		},
+	})
+	past := model.Disruption{Id: "disruption-past", Status: "past", Messages: []string{"Travaux terminés"}}
+	mock := &NavitiaMockClient{departures: []model.Departure{
+		model.Departure{
+			Direction:     "disrupted direction",
+			BaseDeparture: base,
+			Departure:     base,
+			Disruptions:   []model.Disruption{past, disruption},
+		},
+	}}
+	e.navitia = mock
+	req, err := http.NewRequest(http.MethodGet, "/stop/stop_area:test:01", nil)
+	require.Nil(t, err)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: *token1})
+	rr := httptest.NewRecorder()
+	require.Nil(t, specificStopHandler(&e, rr, req))
+	// trains only link to the disruptions displayed in the banner
+	require.Contains(t, rr.Body.String(), `href="#disruption-disruption-test"`)
+	require.NotContains(t, rr.Body.String(), `href="#disruption-disruption-past"`)
+	// the board of the navitia client cache is left untouched
+	require.Len(t, mock.departures[0].Disruptions, 2)
+}
+
+func TestStopDisruptions(t *testing.T) {
+	d1 := model.Disruption{Id: "1", Status: "active"}
+	d2 := model.Disruption{Id: "2", Status: "future"}
+	past := model.Disruption{Id: "3", Status: "past"}
+	departures := []model.Departure{
+		model.Departure{Disruptions: []model.Disruption{d1, past}},
+		model.Departure{},
+		model.Departure{Disruptions: []model.Disruption{d2, d1}},
+	}
+	var lists [][]model.Disruption
+	for _, departure := range departures {
+		lists = append(lists, departure.Disruptions)
+	}
+	require.Equal(t, []model.Disruption{d1, d2}, stopDisruptions(lists...))
+	require.Nil(t, stopDisruptions())
+}
+
+func TestDisplayedDisruptions(t *testing.T) {
+	d1 := model.Disruption{Id: "1", Status: "active"}
+	d2 := model.Disruption{Id: "2", Status: "future"}
+	past := model.Disruption{Id: "3", Status: "past"}
+	require.Equal(t, []model.Disruption{d2, d1}, displayedDisruptions([]model.Disruption{d2, past, d1}, []model.Disruption{d1, d2}))
+	require.Nil(t, displayedDisruptions([]model.Disruption{past}, []model.Disruption{d1, d2}))
+}
+
+func TestSpecificStopHandlerArrivals(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "test"},
+		model.Stop{Id: "stop_area:test:02", Name: "test2"},
+	})
+	require.Nil(t, err)
+	e := env{
+		dbEnv: dbEnv,
+		conf:  &config.Config{},
+	}
+	base := time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC)
+	e.navitia = &NavitiaMockClient{arrivals: []model.Arrival{
+		model.Arrival{
+			Origin:      "test origin",
+			BaseArrival: base,
+			Arrival:     base.Add(4 * time.Minute),
+			Delay:       4 * time.Minute,
+			RealTime:    true,
+		},
+	}}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "the arrivals board should display the origin of trains",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?board=arrivals",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "<td>test origin</td>",
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "the arrivals board should display delays",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?board=arrivals",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Retard 4 min",
+		},
+	})
+	// the navitia client saves the arrivals it fetches, the last good ones are served when it fails
+	err = dbEnv.SaveArrivals(context.Background(), "stop_area:test:01", []model.Arrival{model.Arrival{Origin: "test origin", BaseArrival: base, Arrival: base}}, base)
+	require.Nil(t, err)
+	e.navitia = &NavitiaMockClient{err: fmt.Errorf("navitia error")}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a navitia error should display the last good arrivals",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?board=arrivals",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "service en direct indisponible",
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a navitia error without any saved arrivals should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:02?board=arrivals",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusInternalServerError, simpleErrorMessage},
+		},
+	})
+}
+
+func TestSpecificStopHandlerTimezone(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "test", Coverage: "sncf"},
+		model.Stop{Id: "stop_area:test:02", Name: "test2", Coverage: "sncf", Timezone: "Europe/Paris"},
+	})
+	require.Nil(t, err)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.Nil(t, err)
+	mock := &NavitiaMockClient{departures: []model.Departure{
+		model.Departure{
+			Direction:     "test direction",
+			BaseDeparture: time.Date(2021, 5, 3, 13, 18, 0, 0, time.UTC),
+			Departure:     time.Date(2021, 5, 3, 13, 18, 0, 0, time.UTC),
+		},
+	}}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: mock,
+	}
+	// a stop without timezone is displayed in the timezone of its coverage
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "times should be displayed in the timezone of the coverage",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?from=2021-05-03T15:00",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "<td> 15:18</td>",
+		},
+	})
+	require.True(t, time.Date(2021, 5, 3, 15, 0, 0, 0, paris).Equal(mock.boardOptions.From))
+}
+
+func TestSpecificStopHandlerStale(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "test"},
+		model.Stop{Id: "stop_area:test:02", Name: "test2"},
+	})
+	require.Nil(t, err)
+	e := env{
+		dbEnv: dbEnv,
+		conf:  &config.Config{},
+	}
+	// the last good departures survive restarts since they are stored in the database, the stop has no timezone so
+	// they are displayed in UTC whatever the timezone of the server
+	now := time.Now().UTC()
+	updatedAt := now.Add(-10 * time.Minute)
+	err = dbEnv.SaveDepartures(context.Background(), "stop_area:test:01", []model.Departure{
+		model.Departure{
+			Direction:     "departed direction",
+			BaseDeparture: now.Add(-5 * time.Minute),
+			Departure:     now.Add(-5 * time.Minute),
+		},
+		model.Departure{
+			Direction:     "saved direction",
+			BaseDeparture: now.Add(10 * time.Minute),
+			Departure:     now.Add(10 * time.Minute),
+		},
+	}, updatedAt)
+	require.Nil(t, err)
+	e.navitia = &NavitiaMockClient{err: fmt.Errorf("navitia error")}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a navitia error should display the last good departures",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "saved direction",
+		},
+	})
+	req, err := http.NewRequest(http.MethodGet, "/stop/stop_area:test:01", nil)
+	require.Nil(t, err)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: *token1})
+	rr := httptest.NewRecorder()
+	require.Nil(t, specificStopHandler(&e, rr, req))
+	require.NotContains(t, rr.Body.String(), "departed direction")
+	if updatedAt.Day() == now.Day() {
+		require.Contains(t, rr.Body.String(), "Données de "+updatedAt.Format("15:04")+", service en direct indisponible")
+	}
+	// a board saved on another day displays its date
+	updatedAt = time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC)
+	err = dbEnv.SaveDepartures(context.Background(), "stop_area:test:01", []model.Departure{
+		model.Departure{
+			Direction:     "saved direction",
+			BaseDeparture: now.Add(10 * time.Minute),
+			Departure:     now.Add(10 * time.Minute),
+		},
+	}, updatedAt)
+	require.Nil(t, err)
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a last good board from another day should display its date",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Données du 03/05 à 15:04, service en direct indisponible",
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a navitia error without any saved departures should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:02",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusInternalServerError, simpleErrorMessage},
+		},
+	})
+	// a successful request does not save the departures, the navitia client does it when it fetches them
+	e.navitia = &NavitiaMockClient{departures: []model.Departure{model.Departure{Direction: "live direction"}}}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a successful request should not display the stale banner",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:02",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "live direction",
+		},
+	})
+	_, _, err = dbEnv.GetDepartures(context.Background(), "stop_area:test:02")
+	require.Error(t, err)
+	// viewing the stops watches them for the GTFS-RT feed
+	watched, err := dbEnv.GetWatchedStops(context.Background(), now.Add(-time.Minute))
+	require.Nil(t, err)
+	require.Len(t, watched, 2)
+}
+
+func TestSpecificStopLaterTrains(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{model.Stop{Id: "stop_area:test:01", Name: "test", Timezone: "Europe/Paris"}})
+	require.Nil(t, err)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.Nil(t, err)
+	departures1 := []model.Departure{
+		model.Departure{
+			Direction:      "first direction",
+			TrainNumber:    "886823",
+			CommercialMode: "TER",
+			VehicleJourney: "vehicle_journey:test:01",
+			BaseDeparture:  time.Date(2021, 5, 3, 15, 4, 0, 0, paris),
+			Departure:      time.Date(2021, 5, 3, 15, 4, 0, 0, paris),
+		},
+		model.Departure{
+			Direction:      "same minute direction",
+			VehicleJourney: "vehicle_journey:test:03",
+			BaseDeparture:  time.Date(2021, 5, 3, 16, 30, 0, 0, paris),
+			Departure:      time.Date(2021, 5, 3, 16, 30, 0, 0, paris),
+		},
+		model.Departure{
+			Direction:      "last direction",
+			VehicleJourney: "vehicle_journey:test:02",
+			BaseDeparture:  time.Date(2021, 5, 3, 16, 30, 0, 0, paris),
+			Departure:      time.Date(2021, 5, 3, 16, 38, 0, 0, paris),
+			Delay:          8 * time.Minute,
+		},
+	}
+	mock := &NavitiaMockClient{departures: departures1, arrivals: []model.Arrival{
+		model.Arrival{
+			Origin:      "origin",
+			BaseArrival: time.Date(2021, 5, 3, 17, 0, 0, 0, paris),
+			Arrival:     time.Date(2021, 5, 3, 17, 0, 0, 0, paris),
+		},
+	}}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{Board: config.BoardConfig{Count: 20, Window: 2 * time.Hour}},
+		navitia: mock,
+	}
+	cookie := &http.Cookie{Name: sessionCookieName, Value: *token1}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "the next trains should link to the later trains, from the last scheduled one",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<a href="/stop/stop_area:test:01?from=2021-05-03T16%3a30&amp;shown=vehicle_journey%3atest%3a03&amp;shown=vehicle_journey%3atest%3a02">Trains suivants</a>`,
+		},
+	})
+	require.Equal(t, navitia_api_client.BoardOptions{Count: 20, Duration: 2 * time.Hour}, mock.boardOptions)
+	mock.lines = []model.Line{model.Line{Id: "line:test:01", Name: "Lyon - Bourg-en-Bresse", Code: "L30", Network: "SNCF", CommercialMode: "TER"}}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "the lines serving the stop should be listed",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<li><a href="/line/line:test:01?stop=stop_area%3atest%3a01"><span class="line-badge">TER L30</span></a> Lyon - Bourg-en-Bresse <small>SNCF</small></li>`,
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "trains should link to their journey",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<a href="/train/vehicle_journey:test:01?stop=stop_area%3atest%3a01&amp;date=2021-05-03">TER 886823</a>`,
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "later trains should be requested from the given datetime in the stop timezone",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?from=2021-05-03T16:31",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<a href="/stop/stop_area:test:01">Prochains trains</a>`,
+		},
+	})
+	require.Equal(t, navitia_api_client.BoardOptions{Count: 20, From: time.Date(2021, 5, 3, 16, 31, 0, 0, paris), Duration: 2 * time.Hour}, mock.boardOptions)
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "later arrivals should stay on the arrivals board",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?board=arrivals&from=2021-05-03T16:31",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<a href="/stop/stop_area:test:01?board=arrivals&amp;from=2021-05-03T17%3a00">Trains suivants</a>`,
+		},
+	})
+	// the trains of the from minute already shown are not repeated, the others of the same minute are
+	req, err := http.NewRequest(http.MethodGet, "/stop/stop_area:test:01?from=2021-05-03T16:30&shown=vehicle_journey:test:03", nil)
+	require.Nil(t, err)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	require.Nil(t, specificStopHandler(&e, rr, req))
+	require.NotContains(t, rr.Body.String(), "same minute direction")
+	require.Contains(t, rr.Body.String(), "last direction")
+	require.Contains(t, rr.Body.String(), "first direction")
+	require.Contains(t, rr.Body.String(), `from=2021-05-03T16%3a30&amp;shown=vehicle_journey%3atest%3a03&amp;shown=vehicle_journey%3atest%3a02">Trains suivants</a>`)
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "an invalid shown train should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?from=2021-05-03T16:30&shown=%3Cinvalid%3E",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "shown trains without a from datetime should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?shown=vehicle_journey:test:03",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "an invalid from datetime should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?from=tomorrow",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	// later trains are never served from the last good board
+	require.Nil(t, dbEnv.SaveDepartures(context.Background(), "stop_area:test:01", departures1, time.Now()))
+	mock.err = fmt.Errorf("navitia error")
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "later trains should fail when the navitia api is unavailable",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?from=2021-05-03T16:31",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusInternalServerError, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "the next trains should still be served from the last good board",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "service en direct indisponible",
+		},
+	})
+}
+
+func TestSpecificStopHandlerLinesNotSupported(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{model.Stop{Id: "stop_area:test:01", Name: "test"}})
+	require.Nil(t, err)
+	mock := &NavitiaMockClient{departures: []model.Departure{model.Departure{Direction: "live direction"}}, linesErr: gtfs.NotSupportedError{}}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: mock,
+	}
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "the gtfs backend not knowing the lines should not be logged",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "live direction",
+		},
+	})
+	require.Empty(t, logs.String())
+	// other errors still are
+	mock.linesErr = fmt.Errorf("navitia error")
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a navitia error on the lines should be logged",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "live direction",
+		},
+	})
+	require.Contains(t, logs.String(), "Could not get lines of stop_area:test:01 from navitia")
+}
+
+func TestSpecificStopHandlerGtfsBackend(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{model.Stop{Id: "stop_area:test:01", Name: "test"}})
+	require.Nil(t, err)
+	mock := &NavitiaMockClient{departures: []model.Departure{model.Departure{Direction: "live direction"}}, linesErr: gtfs.NotSupportedError{}}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{Backend: "gtfs"},
+		navitia: mock,
+	}
+	cookie := &http.Cookie{Name: sessionCookieName, Value: *token1}
+	// the gtfs backend only knows the departures, the links to the arrivals and the timetable are hidden
+	req, err := http.NewRequest(http.MethodGet, "/stop/stop_area:test:01", nil)
+	require.Nil(t, err)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	require.Nil(t, specificStopHandler(&e, rr, req))
+	require.Contains(t, rr.Body.String(), "live direction")
+	require.NotContains(t, rr.Body.String(), "board=arrivals")
+	require.NotContains(t, rr.Body.String(), "/timetable")
+	e.conf.Backend = "navitia"
+	rr = httptest.NewRecorder()
+	require.Nil(t, specificStopHandler(&e, rr, req))
+	require.Contains(t, rr.Body.String(), "board=arrivals")
+	require.Contains(t, rr.Body.String(), "/timetable")
+	e.conf.Backend = "gtfs"
+	// and reaching them anyway is not found rather than an error
+	mock.err = gtfs.NotSupportedError{}
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "arrivals not supported by the backend should not be found",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01?board=arrivals",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "timetables not supported by the backend should not be found",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01/timetable",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
 }
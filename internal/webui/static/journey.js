@@ -0,0 +1,37 @@
+// Autocompletes the stops of the journey form as you type, using the stop search api
+(function() {
+	for (const id of ["from", "to"]) {
+		const input = document.getElementById(id);
+		const list = document.getElementById(input.getAttribute("list"));
+		let controller = null;
+		let timer = null;
+		function search() {
+			if (controller !== null) {
+				controller.abort();
+			}
+			const q = input.value.trim();
+			if (q === "") {
+				list.replaceChildren();
+				return;
+			}
+			controller = new AbortController();
+			fetch("/api/stops?q=" + encodeURIComponent(q), {signal: controller.signal})
+				.then(response => response.ok ? response.json() : [])
+				.then(stops => {
+					list.replaceChildren(...stops.map(stop => {
+						const option = document.createElement("option");
+						option.value = stop.name;
+						if (stop.city) {
+							option.label = stop.city;
+						}
+						return option;
+					}));
+				})
+				.catch(() => {});
+		}
+		input.addEventListener("input", () => {
+			clearTimeout(timer);
+			timer = setTimeout(search, 200);
+		});
+	}
+})();
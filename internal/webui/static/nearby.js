@@ -0,0 +1,17 @@
+// Fills the nearby stops form from the browser geolocation
+(function() {
+	if (!("geolocation" in navigator)) {
+		return;
+	}
+	const button = document.getElementById("locate");
+	button.hidden = false;
+	button.addEventListener("click", () => {
+		navigator.geolocation.getCurrentPosition(position => {
+			document.getElementById("lat").value = position.coords.latitude.toFixed(6);
+			document.getElementById("lon").value = position.coords.longitude.toFixed(6);
+			document.getElementById("nearby").submit();
+		}, () => {
+			document.getElementById("locate-error").hidden = false;
+		});
+	});
+})();
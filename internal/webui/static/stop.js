@@ -0,0 +1,47 @@
+// Autocompletes the stop search as you type, using the stop search api
+(function() {
+	const input = document.getElementById("q");
+	const list = document.getElementById("stops");
+	let controller = null;
+	let timer = null;
+	function search() {
+		if (controller !== null) {
+			controller.abort();
+		}
+		const q = input.value.trim();
+		if (q === "") {
+			list.replaceChildren();
+			return;
+		}
+		controller = new AbortController();
+		fetch("/api/stops?q=" + encodeURIComponent(q), {signal: controller.signal})
+			.then(response => response.ok ? response.json() : [])
+			.then(stops => {
+				const noStops = document.getElementById("no-stops");
+				if (noStops !== null) {
+					noStops.remove();
+				}
+				list.replaceChildren(...stops.map((stop, i) => {
+					const a = document.createElement("a");
+					a.href = "/stop/" + stop.id;
+					a.textContent = stop.name;
+					const li = document.createElement("li");
+					if (i % 2 === 1) {
+						li.style.backgroundColor = "lightgray";
+					}
+					li.appendChild(a);
+					if (stop.city) {
+						const city = document.createElement("small");
+						city.textContent = stop.city;
+						li.append(" ", city);
+					}
+					return li;
+				}));
+			})
+			.catch(() => {});
+	}
+	input.addEventListener("input", () => {
+		clearTimeout(timer);
+		timer = setTimeout(search, 200);
+	});
+})();
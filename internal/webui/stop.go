@@ -1,21 +1,56 @@
 package webui
 
 import (
+	"context"
 	"fmt"
 	"html/template"
+	"log"
 	"net/http"
+	"strings"
+	"unicode/utf8"
 
 	"git.adyxax.org/adyxax/trains/pkg/model"
 )
 
+// stopSearchLimit is the maximum number of stops a search returns
+const stopSearchLimit = 20
+
+// placesFallbackMinLength is the minimum number of characters of a query before the navitia places api is asked, the
+// shorter ones match too many places to be worth an api request
+const placesFallbackMinLength = 3
+
 var stopTemplate = template.Must(template.New("stop").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/stop.html"))
 
 // The page template variable
 type StopPage struct {
 	User  *model.User
+	Query string
 	Stops []model.Stop
 }
 
+// searchStops searches the stops table, and the navitia places api of the default coverage when configured to and
+// nothing matched locally. Only the places known locally are kept since the stop page needs them.
+func searchStops(e *env, ctx context.Context, q string) ([]model.Stop, error) {
+	stops, err := e.dbEnv.SearchStops(ctx, q, stopSearchLimit)
+	if err != nil || len(stops) > 0 || !e.conf.PlacesFallback || utf8.RuneCountInString(strings.TrimSpace(q)) < placesFallbackMinLength {
+		return stops, err
+	}
+	places, err := e.navitia.GetPlaces(ctx, "", q)
+	if err != nil {
+		log.Printf("Could not search stops matching %q from navitia : %+v", q, err)
+		return nil, nil
+	}
+	for _, place := range places {
+		if stop, err := e.dbEnv.GetStop(ctx, place.Id); err == nil {
+			stops = append(stops, *stop)
+			if len(stops) == stopSearchLimit {
+				break
+			}
+		}
+	}
+	return stops, nil
+}
+
 // The stop handler of the webui
 func stopHandler(e *env, w http.ResponseWriter, r *http.Request) error {
 	if r.URL.Path == "/stop" {
@@ -26,16 +61,17 @@ func stopHandler(e *env, w http.ResponseWriter, r *http.Request) error {
 		}
 		switch r.Method {
 		case http.MethodGet:
-			stops, err := e.dbEnv.GetStops()
-			if err != nil {
-				return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get train stops"))
-			} else {
-				w.Header().Set("Cache-Control", "no-store, no-cache")
-			}
 			p := StopPage{
 				User:  user,
-				Stops: stops,
+				Query: r.URL.Query().Get("q"),
+			}
+			if p.Query != "" {
+				p.Stops, err = searchStops(e, r.Context(), p.Query)
+				if err != nil {
+					return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get train stops"))
+				}
 			}
+			w.Header().Set("Cache-Control", "no-store, no-cache")
 			err = stopTemplate.ExecuteTemplate(w, "stop.html", p)
 			if err != nil {
 				return newStatusError(http.StatusInternalServerError, err)
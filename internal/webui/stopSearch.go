@@ -0,0 +1,41 @@
+package webui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// A stop as returned by the stop search api
+type stopSearchResult struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	City string `json:"city,omitempty"`
+}
+
+// The stop search json api of the webui, used to autocomplete stop names as you type
+func stopSearchHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path == "/api/stops" {
+		if _, err := tryAndResumeSession(e, r); err != nil {
+			return newStatusError(http.StatusUnauthorized, fmt.Errorf(http.StatusText(http.StatusUnauthorized)))
+		}
+		switch r.Method {
+		case http.MethodGet:
+			stops, err := searchStops(e, r.Context(), r.URL.Query().Get("q"))
+			if err != nil {
+				return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get train stops"))
+			}
+			results := make([]stopSearchResult, len(stops))
+			for i, stop := range stops {
+				results[i] = stopSearchResult{Id: stop.Id, Name: stop.Name, City: stop.City}
+			}
+			w.Header().Set("Cache-Control", "no-store, no-cache")
+			w.Header().Set("Content-Type", "application/json")
+			return json.NewEncoder(w).Encode(results)
+		default:
+			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	} else {
+		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in stopSearchHandler"))
+	}
+}
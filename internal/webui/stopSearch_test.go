@@ -0,0 +1,104 @@
+package webui
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopSearchHandler(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "Saint-Étienne Châteaucreux", Coverage: "sncf", City: "Saint-Étienne (42000)"},
+		model.Stop{Id: "stop_area:test:02", Name: "Saint-Étienne", Coverage: "sncf"},
+	})
+	require.Nil(t, err)
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: &NavitiaMockClient{},
+	}
+	// test GET requests
+	runHttpTest(t, &e, stopSearchHandler, &httpTestCase{
+		name: "a search when not logged in should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/api/stops?q=etienne",
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusUnauthorized, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, stopSearchHandler, &httpTestCase{
+		name: "a search should return the ranked matching stops",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/api/stops?q=saint-etienne",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `[{"id":"stop_area:test:02","name":"Saint-Étienne"},{"id":"stop_area:test:01","name":"Saint-Étienne Châteaucreux","city":"Saint-Étienne (42000)"}]`,
+		},
+	})
+	runHttpTest(t, &e, stopSearchHandler, &httpTestCase{
+		name: "a search without results should return an empty list",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/api/stops?q=nowhere",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "[]",
+		},
+	})
+	runHttpTest(t, &e, stopSearchHandler, &httpTestCase{
+		name: "a cancelled search should not resume the session",
+		input: httpTestInput{
+			method:    http.MethodGet,
+			path:      "/api/stops?q=etienne",
+			cookie:    &http.Cookie{Name: sessionCookieName, Value: *token1},
+			cancelled: true,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusUnauthorized, simpleErrorMessage},
+		},
+	})
+	// test other methods
+	runHttpTest(t, &e, stopSearchHandler, &httpTestCase{
+		name: "a post should fail",
+		input: httpTestInput{
+			method: http.MethodPost,
+			path:   "/api/stops",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, stopSearchHandler, &httpTestCase{
+		name: "an invalid path should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/api/stops/test",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+}
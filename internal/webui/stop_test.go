@@ -1,8 +1,11 @@
 package webui
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"git.adyxax.org/adyxax/trains/pkg/config"
 	"git.adyxax.org/adyxax/trains/pkg/database"
@@ -14,15 +17,15 @@ func TestStopHandler(t *testing.T) {
 	// test environment setup
 	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.Nil(t, err)
-	err = dbEnv.Migrate()
+	err = dbEnv.Migrate(context.Background())
 	require.Nil(t, err)
-	user1, err := dbEnv.CreateUser(&model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
 	require.Nil(t, err)
-	_, err = dbEnv.Login(&model.UserLogin{Username: "user1", Password: "password1"})
+	_, err = dbEnv.Login(context.Background(), &model.UserLogin{Username: "user1", Password: "password1"})
 	require.Nil(t, err)
-	token1, err := dbEnv.CreateSession(user1)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
 	require.Nil(t, err)
-	err = dbEnv.ReplaceAndImportStops([]model.Stop{model.Stop{Id: "stop_area:test:01", Name: "test"}})
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{model.Stop{Id: "stop_area:test:01", Name: "test"}})
 	require.Nil(t, err)
 	e := env{
 		dbEnv: dbEnv,
@@ -30,8 +33,9 @@ func TestStopHandler(t *testing.T) {
 	}
 	departures1 := []model.Departure{
 		model.Departure{
-			Direction: "test direction",
-			Arrival:   "20210503T150405",
+			Direction:     "test direction",
+			BaseDeparture: time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC),
+			Departure:     time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC),
 		},
 	}
 	e.navitia = &NavitiaMockClient{departures: departures1, err: nil}
@@ -48,15 +52,111 @@ func TestStopHandler(t *testing.T) {
 		},
 	})
 	runHttpTest(t, &e, stopHandler, &httpTestCase{
-		name: "a simple get when logged in should display the stops list",
+		name: "a simple get when logged in should display the search form",
 		input: httpTestInput{
 			method: http.MethodGet,
 			path:   "/stop",
 			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
 		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Nom de la gare",
+		},
+	})
+	runHttpTest(t, &e, stopHandler, &httpTestCase{
+		name: "a search should display the matching stops",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop?q=TEST",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
 		expect: httpTestExpect{
 			code:       http.StatusOK,
 			bodyString: "stop_area:test:01",
 		},
 	})
+	runHttpTest(t, &e, stopHandler, &httpTestCase{
+		name: "a search without results should say so",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop?q=nowhere",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Aucune gare ne correspond à « nowhere »",
+		},
+	})
+	runHttpTest(t, &e, stopHandler, &httpTestCase{
+		name: "a cancelled search should not resume the session",
+		input: httpTestInput{
+			method:    http.MethodGet,
+			path:      "/stop?q=test",
+			cookie:    &http.Cookie{Name: sessionCookieName, Value: *token1},
+			cancelled: true,
+		},
+		expect: httpTestExpect{
+			code:     http.StatusFound,
+			location: "/login",
+		},
+	})
+	// test other methods
+	runHttpTest(t, &e, stopHandler, &httpTestCase{
+		name: "a post should fail",
+		input: httpTestInput{
+			method: http.MethodPost,
+			path:   "/stop",
+			cookie: &http.Cookie{Name: sessionCookieName, Value: *token1},
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+		},
+	})
+}
+
+func TestSearchStops(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	stops := []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "Saint-Étienne Châteaucreux", Coverage: "sncf", City: "Saint-Étienne (42000)"},
+		model.Stop{Id: "stop_area:test:02", Name: "Lyon Part-Dieu", Coverage: "sncf"},
+	}
+	err = dbEnv.ReplaceAndImportStops(context.Background(), stops)
+	require.Nil(t, err)
+	navitia := &NavitiaMockClient{places: []model.Stop{
+		model.Stop{Id: "stop_area:test:99", Name: "Unknown", Coverage: "sncf"},
+		model.Stop{Id: "stop_area:test:02", Name: "Lyon Part Dieu", Coverage: "sncf"},
+	}}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: navitia,
+	}
+	// local search
+	res, err := searchStops(&e, context.Background(), "saint etienne")
+	require.NoError(t, err)
+	require.Equal(t, stops[:1], res)
+	res, err = searchStops(&e, context.Background(), "lyon pt dieu")
+	require.NoError(t, err)
+	require.Empty(t, res)
+	// places fallback only keeps the stops known locally
+	e.conf.PlacesFallback = true
+	res, err = searchStops(&e, context.Background(), "lyon pt dieu")
+	require.NoError(t, err)
+	require.Equal(t, stops[1:], res)
+	require.Equal(t, "", navitia.coverage)
+	require.Equal(t, 1, navitia.placesRequests)
+	// short queries never reach the places api
+	res, err = searchStops(&e, context.Background(), " pt ")
+	require.NoError(t, err)
+	require.Empty(t, res)
+	require.Equal(t, 1, navitia.placesRequests)
+	// a failing fallback is not an error
+	navitia.err = fmt.Errorf("navitia error")
+	res, err = searchStops(&e, context.Background(), "lyon pt dieu")
+	require.NoError(t, err)
+	require.Empty(t, res)
 }
@@ -0,0 +1,112 @@
+package webui
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/gtfs"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// dateLayout is the layout of html date inputs
+const dateLayout = "2006-01-02"
+
+var timetableTemplate = template.Must(template.New("timetable").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/timetable.html"))
+
+// A TimetableRow lists the minutes of the departures of an hour, like on printed timetables
+type TimetableRow struct {
+	Hour    int
+	Minutes []int
+}
+
+// A Timetable is the printed timetable grid of a route
+type Timetable struct {
+	model.Schedule
+	Rows []TimetableRow
+}
+
+// The page template variable
+type TimetablePage struct {
+	User       *model.User
+	Stop       string
+	StopId     string
+	City       string
+	Timezone   string
+	Date       string
+	Previous   string
+	Next       string
+	Timetables []Timetable
+}
+
+// newTimetable lays out the departures of a schedule by hour
+func newTimetable(schedule model.Schedule) Timetable {
+	t := Timetable{Schedule: schedule}
+	for _, d := range schedule.Departures {
+		if n := len(t.Rows); n == 0 || t.Rows[n-1].Hour != d.Hour() {
+			t.Rows = append(t.Rows, TimetableRow{Hour: d.Hour()})
+		}
+		row := &t.Rows[len(t.Rows)-1]
+		row.Minutes = append(row.Minutes, d.Minute())
+	}
+	return t
+}
+
+// The timetable handler of the webui, for /stop/{id}/timetable paths
+func timetableHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	user, err := tryAndResumeSession(e, r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return nil
+	}
+	switch r.Method {
+	case http.MethodGet:
+		id := path.Base(path.Dir(r.URL.Path))
+		if ok := validStopId.MatchString(id); !ok {
+			return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid stop id"))
+		}
+		stop, err := e.dbEnv.GetStop(r.Context(), id)
+		if err != nil {
+			return newStatusError(http.StatusBadRequest, fmt.Errorf("Stop id not found in database"))
+		}
+		loc := stop.Location()
+		date := time.Now().In(loc)
+		if d := r.URL.Query().Get("date"); d != "" {
+			if date, err = time.ParseInLocation(dateLayout, d, loc); err != nil {
+				return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid date"))
+			}
+		}
+		p := TimetablePage{
+			User:     user,
+			Stop:     stop.Name,
+			StopId:   stop.Id,
+			City:     stop.City,
+			Timezone: stop.Timezone,
+			Date:     date.Format(dateLayout),
+			Previous: date.AddDate(0, 0, -1).Format(dateLayout),
+			Next:     date.AddDate(0, 0, 1).Format(dateLayout),
+		}
+		schedules, err := e.navitia.GetStopSchedules(r.Context(), stop.Coverage, stop.Id, date)
+		if err != nil {
+			if errors.As(err, &gtfs.NotSupportedError{}) {
+				return newStatusError(http.StatusNotFound, fmt.Errorf("Timetables are not supported by the backend"))
+			}
+			log.Printf("Could not get the timetable of %s from navitia : %+v", stop.Id, err)
+			return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get timetable"))
+		}
+		for _, schedule := range schedules {
+			p.Timetables = append(p.Timetables, newTimetable(schedule.In(loc)))
+		}
+		err = timetableTemplate.ExecuteTemplate(w, "timetable.html", p)
+		if err != nil {
+			return newStatusError(http.StatusInternalServerError, err)
+		}
+		return nil
+	default:
+		return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+	}
+}
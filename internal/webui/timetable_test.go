@@ -0,0 +1,182 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTimetable(t *testing.T) {
+	schedule := model.Schedule{Departures: []time.Time{
+		time.Date(2021, 5, 3, 5, 42, 0, 0, time.UTC),
+		time.Date(2021, 5, 3, 6, 5, 0, 0, time.UTC),
+		time.Date(2021, 5, 3, 6, 42, 0, 0, time.UTC),
+		time.Date(2021, 5, 3, 18, 12, 0, 0, time.UTC),
+	}}
+	require.Equal(t, []TimetableRow{
+		TimetableRow{Hour: 5, Minutes: []int{42}},
+		TimetableRow{Hour: 6, Minutes: []int{5, 42}},
+		TimetableRow{Hour: 18, Minutes: []int{12}},
+	}, newTimetable(schedule).Rows)
+	require.Nil(t, newTimetable(model.Schedule{}).Rows)
+}
+
+func TestTimetableHandler(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "Crépieux-la-Pape", Coverage: "fr-se", City: "Rillieux-la-Pape", Timezone: "Europe/Paris"},
+	})
+	require.Nil(t, err)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.Nil(t, err)
+	mock := &NavitiaMockClient{schedules: []model.Schedule{
+		model.Schedule{
+			Line:           "St-Etienne - Lyon - Ambérieu",
+			CommercialMode: "TER",
+			Direction:      "Ambérieu-en-Bugey",
+			Departures: []time.Time{
+				time.Date(2021, 5, 3, 3, 42, 0, 0, time.UTC),
+				time.Date(2021, 5, 3, 4, 5, 0, 0, time.UTC),
+			},
+		},
+	}}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: mock,
+	}
+	cookie := &http.Cookie{Name: sessionCookieName, Value: *token1}
+	// test GET requests
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a simple get when not logged in should redirect to the login page",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01/timetable",
+		},
+		expect: httpTestExpect{
+			code:     http.StatusFound,
+			location: "/login",
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "an invalid stop id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/invalid/timetable",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "an unknown stop id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:02/timetable",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "an invalid date should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01/timetable?date=tomorrow",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "the timetable should be displayed as a grid in the stop timezone",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01/timetable?date=2021-05-03",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "<tr><th>05h</th><td>42</td></tr>",
+		},
+	})
+	require.Equal(t, "fr-se", mock.coverage)
+	require.Equal(t, time.Date(2021, 5, 3, 0, 0, 0, 0, paris), mock.date)
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "the timetable should link to the next day",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01/timetable?date=2021-05-31",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: `<a href="/stop/stop_area:test:01/timetable?date=2021-06-01">Jour suivant</a>`,
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a post should fail",
+		input: httpTestInput{
+			method: http.MethodPost,
+			path:   "/stop/stop_area:test:01/timetable",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "other stop sub pages should not be found",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01/other",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+	mock.schedules = nil
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a day without trains should say so",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01/timetable",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Aucun train ne dessert cette gare ce jour.",
+		},
+	})
+	mock.err = fmt.Errorf("navitia error")
+	runHttpTest(t, &e, specificStopHandler, &httpTestCase{
+		name: "a navitia error should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/stop/stop_area:test:01/timetable",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusInternalServerError, simpleErrorMessage},
+		},
+	})
+}
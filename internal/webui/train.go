@@ -0,0 +1,105 @@
+package webui
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
+)
+
+// validVehicleJourneyId accepts the vehicle journey ids of any navitia coverage, like vehicle_journey:OCE:SN886823F29029_dst_1
+var validVehicleJourneyId = regexp.MustCompile(`^vehicle_journey(:[\w.-]+)+$`)
+
+var trainTemplate = template.Must(template.New("train").Funcs(funcMap).ParseFS(templatesFS, "html/base.html", "html/train.html"))
+
+// The page template variable
+type TrainPage struct {
+	User        *model.User
+	TrainNumber string
+	// StopId is the stop the train was looked up from, highlighted in the list of stops
+	StopId   string
+	Timezone string
+	Date     string
+	// Position is the index of the last stop the train reached, -1 if it has not left yet
+	Position int
+	Standing bool
+	// Next is the index of the next stop the train calls at, -1 once it reached its last one
+	Next        int
+	StopTimes   []model.StopTime
+	Disruptions []model.Disruption
+}
+
+// The train handler of the webui
+func trainHandler(e *env, w http.ResponseWriter, r *http.Request) error {
+	if path.Dir(r.URL.Path) == "/train" {
+		user, err := tryAndResumeSession(e, r)
+		if err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return nil
+		}
+		switch r.Method {
+		case http.MethodGet:
+			id := path.Base(r.URL.Path)
+			if ok := validVehicleJourneyId.MatchString(id); !ok {
+				return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid train id"))
+			}
+			// the train is displayed in the timezone of the stop it was looked up from
+			p := TrainPage{User: user}
+			var stop model.Stop
+			if p.StopId = r.URL.Query().Get("stop"); p.StopId != "" {
+				if ok := validStopId.MatchString(p.StopId); !ok {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid stop id"))
+				}
+				s, err := e.dbEnv.GetStop(r.Context(), p.StopId)
+				if err != nil {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Stop id not found in database"))
+				}
+				stop = *s
+				p.Timezone = stop.Timezone
+			}
+			loc := stop.Location()
+			date := time.Now().In(loc)
+			if d := r.URL.Query().Get("date"); d != "" {
+				if date, err = time.ParseInLocation(dateLayout, d, loc); err != nil {
+					return newStatusError(http.StatusBadRequest, fmt.Errorf("Invalid date"))
+				}
+			}
+			p.Date = date.Format(dateLayout)
+			vj, err := e.navitia.GetVehicleJourney(r.Context(), stop.Coverage, id, date)
+			if err != nil {
+				if errors.As(err, &navitia_api_client.NotFoundError{}) {
+					return newStatusError(http.StatusNotFound, fmt.Errorf("Train not found"))
+				}
+				log.Printf("Could not get train %s from navitia : %+v", id, err)
+				return newStatusError(http.StatusInternalServerError, fmt.Errorf("Could not get train"))
+			}
+			*vj = vj.In(loc)
+			p.TrainNumber = vj.TrainNumber
+			p.StopTimes = vj.StopTimes
+			p.Disruptions = stopDisruptions(vj.Disruptions)
+			p.Position, p.Standing = vj.Position(time.Now())
+			p.Next = -1
+			for i := p.Position + 1; i < len(vj.StopTimes) && p.Next < 0; i++ {
+				if !vj.StopTimes[i].Cancelled {
+					p.Next = i
+				}
+			}
+			err = trainTemplate.ExecuteTemplate(w, "train.html", p)
+			if err != nil {
+				return newStatusError(http.StatusInternalServerError, err)
+			}
+			return nil
+		default:
+			return newStatusError(http.StatusMethodNotAllowed, fmt.Errorf(http.StatusText(http.StatusMethodNotAllowed)))
+		}
+	} else {
+		return newStatusError(http.StatusNotFound, fmt.Errorf("Invalid path in trainHandler"))
+	}
+}
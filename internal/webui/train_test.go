@@ -0,0 +1,227 @@
+package webui
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrainHandler(t *testing.T) {
+	// test environment setup
+	dbEnv, err := database.InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.Nil(t, err)
+	err = dbEnv.Migrate(context.Background())
+	require.Nil(t, err)
+	user1, err := dbEnv.CreateUser(context.Background(), &model.UserRegistration{Username: "user1", Password: "password1", Email: "julien@adyxax.org"})
+	require.Nil(t, err)
+	token1, err := dbEnv.CreateSession(context.Background(), user1)
+	require.Nil(t, err)
+	err = dbEnv.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:02", Name: "Crépieux-la-Pape", Coverage: "fr-se", Timezone: "Europe/Paris"},
+	})
+	require.Nil(t, err)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.Nil(t, err)
+	stopTime := func(id string, name string, at time.Time) model.StopTime {
+		return model.StopTime{StopAreaId: id, Name: name, BaseArrival: at, Arrival: at, BaseDeparture: at, Departure: at}
+	}
+	delayed := stopTime("stop_area:test:02", "Crépieux-la-Pape", time.Date(2021, 2, 18, 12, 18, 0, 0, time.UTC))
+	delayed.Arrival = delayed.Arrival.Add(7 * time.Minute)
+	delayed.Departure = delayed.Departure.Add(7 * time.Minute)
+	cancelled := stopTime("stop_area:test:03", "Miribel", time.Date(2021, 2, 18, 12, 23, 0, 0, time.UTC))
+	cancelled.Cancelled = true
+	mock := &NavitiaMockClient{train: &model.VehicleJourney{
+		Id:          "vehicle_journey:test:01",
+		TrainNumber: "886823",
+		StopTimes: []model.StopTime{
+			stopTime("stop_area:test:01", "Lyon Part-Dieu", time.Date(2021, 2, 18, 12, 5, 0, 0, time.UTC)),
+			delayed,
+			cancelled,
+			stopTime("stop_area:test:04", "Ambérieu-en-Bugey", time.Date(2021, 2, 18, 12, 45, 0, 0, time.UTC)),
+		},
+		Disruptions: []model.Disruption{model.Disruption{Id: "d1", Status: "active", Cause: "Incident de signalisation"}},
+	}}
+	e := env{
+		dbEnv:   dbEnv,
+		conf:    &config.Config{},
+		navitia: mock,
+	}
+	cookie := &http.Cookie{Name: sessionCookieName, Value: *token1}
+	// test GET requests
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "a simple get when not logged in should redirect to the login page",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01",
+		},
+		expect: httpTestExpect{
+			code:     http.StatusFound,
+			location: "/login",
+		},
+	})
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "an invalid path should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01/other",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "an invalid train id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/stop_area:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "an invalid stop id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01?stop=invalid",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "an unknown stop id should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01?stop=stop_area:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "an invalid date should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01?date=tomorrow",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusBadRequest, simpleErrorMessage},
+		},
+	})
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "a train should list its stops in the timezone of the stop it was looked up from",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01?stop=stop_area:test:02&date=2021-02-18",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "<td><b>Crépieux-la-Pape</b></td>\n\t\t\t<td><s>13:18</s> 13:25</td>",
+		},
+	})
+	require.Equal(t, "fr-se", mock.coverage)
+	require.Equal(t, time.Date(2021, 2, 18, 0, 0, 0, 0, paris), mock.date)
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "a train should show its disruptions and cancelled stops",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01?stop=stop_area:test:02&date=2021-02-18",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "<td>Arrêt supprimé</td>",
+		},
+	})
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "a train that reached its last stop should say so",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Arrivé à Ambérieu-en-Bugey",
+		},
+	})
+	now := time.Now()
+	mock.train.StopTimes[0] = stopTime("stop_area:test:01", "Lyon Part-Dieu", now.Add(-10*time.Minute))
+	mock.train.StopTimes[1] = stopTime("stop_area:test:02", "Crépieux-la-Pape", now.Add(10*time.Minute))
+	mock.train.StopTimes[3] = stopTime("stop_area:test:04", "Ambérieu-en-Bugey", now.Add(time.Hour))
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "a running train should be located between two stops",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Entre Lyon Part-Dieu et Crépieux-la-Pape",
+		},
+	})
+	mock.train.StopTimes[0] = stopTime("stop_area:test:01", "Lyon Part-Dieu", now.Add(10*time.Minute))
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "a train that did not leave yet should say so",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			code:       http.StatusOK,
+			bodyString: "Pas encore parti",
+		},
+	})
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "a post should fail",
+		input: httpTestInput{
+			method: http.MethodPost,
+			path:   "/train/vehicle_journey:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusMethodNotAllowed, simpleErrorMessage},
+		},
+	})
+	mock.err = navitia_api_client.NotFoundError{}
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "an unknown train should not be found",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusNotFound, simpleErrorMessage},
+		},
+	})
+	mock.err = fmt.Errorf("navitia error")
+	runHttpTest(t, &e, trainHandler, &httpTestCase{
+		name: "a navitia error should fail",
+		input: httpTestInput{
+			method: http.MethodGet,
+			path:   "/train/vehicle_journey:test:01",
+			cookie: cookie,
+		},
+		expect: httpTestExpect{
+			err: &statusError{http.StatusInternalServerError, simpleErrorMessage},
+		},
+	})
+}
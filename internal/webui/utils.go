@@ -2,9 +2,12 @@ package webui
 
 import (
 	"embed"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"git.adyxax.org/adyxax/trains/pkg/config"
 	"git.adyxax.org/adyxax/trains/pkg/database"
@@ -22,6 +25,18 @@ var funcMap = template.FuncMap{
 	"odd": func(i int) bool {
 		return i%2 == 1
 	},
+	"duration": func(d time.Duration) string {
+		if d < time.Hour {
+			return fmt.Sprintf("%d min", d/time.Minute)
+		}
+		return fmt.Sprintf("%dh%02d", d/time.Hour, (d%time.Hour)/time.Minute)
+	},
+	"distance": func(meters float64) string {
+		if meters < 1000 {
+			return fmt.Sprintf("%d m", int(meters+5)/10*10)
+		}
+		return strings.Replace(fmt.Sprintf("%.1f km", meters/1000), ".", ",", 1)
+	},
 }
 
 // the environment that will be passed to our handlers
@@ -1,6 +1,7 @@
 package webui
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,8 +9,10 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
 	"github.com/stretchr/testify/require"
 )
 
@@ -17,20 +20,111 @@ func requireErrorTypeMatch(t *testing.T, err error, expected error) {
 	require.Equalf(t, reflect.TypeOf(err), reflect.TypeOf(expected), "Invalid error type. Got %s but expected %s", reflect.TypeOf(err), reflect.TypeOf(expected))
 }
 
+// NavitiaMockClient fails like the real client would when the request context is done
 type NavitiaMockClient struct {
+	arrivals   []model.Arrival
 	departures []model.Departure
+	journeys   []model.Journey
+	lines      []model.Line
+	places     []model.Stop
+	routes     []model.Route
+	schedules  []model.Schedule
 	stops      []model.Stop
+	train      *model.VehicleJourney
 	err        error
+	// linesErr is returned by GetLines instead of err when set
+	linesErr error
+	// coverage, boardOptions, date, from and to are the ones of the last request
+	coverage     string
+	boardOptions navitia_api_client.BoardOptions
+	date         time.Time
+	from         string
+	to           string
+	// placesRequests counts the places searches
+	placesRequests int
 }
 
-func (c *NavitiaMockClient) GetDepartures(stop string) (departures []model.Departure, err error) {
+func (c *NavitiaMockClient) GetArrivals(ctx context.Context, coverage string, stop string, options navitia_api_client.BoardOptions) (arrivals []model.Arrival, err error) {
+	c.coverage = coverage
+	c.boardOptions = options
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.arrivals, c.err
+}
+
+func (c *NavitiaMockClient) GetDepartures(ctx context.Context, coverage string, stop string, options navitia_api_client.BoardOptions) (departures []model.Departure, err error) {
+	c.coverage = coverage
+	c.boardOptions = options
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return c.departures, c.err
 }
 
-func (c *NavitiaMockClient) GetStops() (stops []model.Stop, err error) {
+func (c *NavitiaMockClient) GetJourneys(ctx context.Context, coverage string, from string, to string, datetime time.Time, options navitia_api_client.JourneyOptions) (journeys []model.Journey, err error) {
+	c.coverage = coverage
+	c.date = datetime
+	c.from = from
+	c.to = to
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.journeys, c.err
+}
+
+func (c *NavitiaMockClient) GetLines(ctx context.Context, coverage string, stop string) (lines []model.Line, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.linesErr != nil {
+		return nil, c.linesErr
+	}
+	return c.lines, c.err
+}
+
+func (c *NavitiaMockClient) GetPlaces(ctx context.Context, coverage string, q string) (stops []model.Stop, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.coverage = coverage
+	c.placesRequests++
+	return c.places, c.err
+}
+
+func (c *NavitiaMockClient) GetRoutes(ctx context.Context, coverage string, line string) (routes []model.Route, err error) {
+	c.coverage = coverage
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.routes, c.err
+}
+
+func (c *NavitiaMockClient) GetStopSchedules(ctx context.Context, coverage string, stop string, date time.Time) (schedules []model.Schedule, err error) {
+	c.coverage = coverage
+	c.date = date
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.schedules, c.err
+}
+
+func (c *NavitiaMockClient) GetStops(ctx context.Context) (stops []model.Stop, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return c.stops, c.err
 }
 
+func (c *NavitiaMockClient) GetVehicleJourney(ctx context.Context, coverage string, id string, date time.Time) (vj *model.VehicleJourney, err error) {
+	c.coverage = coverage
+	c.date = date
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.train, c.err
+}
+
 var simpleErrorMessage = fmt.Errorf("")
 
 type httpTestCase struct {
@@ -43,6 +137,8 @@ type httpTestInput struct {
 	path   string
 	cookie *http.Cookie
 	data   url.Values
+	// cancelled makes the request context done before the handler runs, like when a browser disconnects
+	cancelled bool
 }
 type httpTestExpect struct {
 	code       int
@@ -59,6 +155,11 @@ func runHttpTest(t *testing.T, e *env, h func(e *env, w http.ResponseWriter, r *
 		req, err = http.NewRequest(tc.input.method, tc.input.path, strings.NewReader(tc.input.data.Encode()))
 		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	}
+	if tc.input.cancelled {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancel()
+		req = req.WithContext(ctx)
+	}
 	if tc.input.cookie != nil {
 		req.AddCookie(tc.input.cookie)
 	}
@@ -1,31 +1,54 @@
 package webui
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
 
 	"git.adyxax.org/adyxax/trains/pkg/config"
 	"git.adyxax.org/adyxax/trains/pkg/database"
+	"git.adyxax.org/adyxax/trains/pkg/gtfs"
 	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
 )
 
 func Run(c *config.Config, dbEnv *database.DBEnv) {
 	e := env{
-		conf:    c,
-		dbEnv:   dbEnv,
-		navitia: navitia_api_client.NewClient(c.Token),
+		conf:  c,
+		dbEnv: dbEnv,
+	}
+	ctx := context.Background()
+	if c.Backend == "gtfs" {
+		var realtime gtfs.Realtime
+		if r := c.GTFS.Realtime; r.Source != "" {
+			poller := gtfs.NewPoller(r.Source, r.Interval, r.MaxAge)
+			go poller.Run(ctx)
+			realtime = poller
+		}
+		e.navitia = gtfs.NewClient(dbEnv, realtime, c.GTFS.TransferTime)
+		importGTFS(ctx, c.GTFS.Path, &e)
+	} else {
+		e.navitia = navitia_api_client.NewClient(c, dbEnv, dbEnv)
 	}
 	http.Handle("/", handler{&e, rootHandler})
+	http.Handle("/admin", handler{&e, adminHandler})
+	http.Handle("/api/stops", handler{&e, stopSearchHandler})
+	http.Handle("/gtfs-rt", handler{&e, gtfsRealtimeHandler})
+	http.Handle("/journey", handler{&e, journeyHandler})
+	http.Handle("/line/", handler{&e, lineHandler})
 	http.Handle("/login", handler{&e, loginHandler})
+	http.Handle("/nearby", handler{&e, nearbyHandler})
 	http.Handle("/static/", http.FileServer(http.FS(staticFS)))
+	http.Handle("/siri/stop-monitoring.json", handler{&e, siriStopMonitoringHandler})
 	http.Handle("/stop", handler{&e, stopHandler})
 	http.Handle("/stop/", handler{&e, specificStopHandler})
+	http.Handle("/train/", handler{&e, trainHandler})
 
-	if i, err := dbEnv.CountStops(); err == nil && i == 0 {
+	if i, err := dbEnv.CountStops(ctx); err == nil && i == 0 {
 		log.Printf("No trains stops data found, updating...")
-		if stops, err := e.navitia.GetStops(); err == nil {
+		if stops, err := e.navitia.GetStops(ctx); err == nil {
 			log.Printf("Updated trains stops data from navitia api, got %d results", len(stops))
-			if err = dbEnv.ReplaceAndImportStops(stops); err != nil {
+			if err = dbEnv.ReplaceAndImportStops(ctx, stops); err != nil {
 				if dberr, ok := err.(database.QueryError); ok {
 					log.Printf("%+v", dberr.Unwrap())
 				}
@@ -39,3 +62,39 @@ func Run(c *config.Config, dbEnv *database.DBEnv) {
 	log.Printf("Starting webui on %s", listenStr)
 	log.Fatal(http.ListenAndServe(listenStr, nil))
 }
+
+// importGTFS imports the gtfs archive when it changed since the last import, then replaces the stops with its stations
+func importGTFS(ctx context.Context, path string, e *env) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("Failed to open gtfs archive : %+v", err)
+		return
+	}
+	modifiedAt, err := e.dbEnv.GetGTFSModifiedAt(ctx)
+	if err != nil {
+		log.Printf("Failed to get the last gtfs import : %+v", err)
+		return
+	}
+	if modifiedAt != nil && !info.ModTime().After(*modifiedAt) {
+		return
+	}
+	log.Printf("Importing gtfs archive %s...", path)
+	feed, err := gtfs.Open(path)
+	if err != nil {
+		log.Printf("Failed to read gtfs archive : %+v", err)
+		return
+	}
+	if err = e.dbEnv.ImportGTFS(ctx, feed, info.ModTime()); err != nil {
+		log.Printf("Failed to import gtfs archive : %+v", err)
+		return
+	}
+	stops, err := e.navitia.GetStops(ctx)
+	if err != nil {
+		log.Printf("Failed to get trains stops data from gtfs feed : %+v", err)
+		return
+	}
+	log.Printf("Imported gtfs archive, got %d stops and %d stop times", len(stops), len(feed.StopTimes))
+	if err = e.dbEnv.ReplaceAndImportStops(ctx, stops); err != nil {
+		log.Printf("Failed to replace trains stops data : %+v", err)
+	}
+}
@@ -2,21 +2,259 @@ package config
 
 import (
 	"net"
+	"net/url"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+var validCoverage = regexp.MustCompile(`^[\w.-]+$`)
 var validToken = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
 
+// validHeaderToken matches the tokens of the self hosted navitia apis, which only need to fit in an http header
+var validHeaderToken = regexp.MustCompile(`^[[:graph:]]+$`)
+
+// minFeedTokenLength is the minimum length of the feed tokens, which are shared secrets
+const minFeedTokenLength = 16
+
+// sncfHost is the host of the sncf navitia api, the default one
+const sncfHost = "api.sncf.com"
+
 type Config struct {
 	// Address is the hostname or ip the web server will listen to
 	Address string `yaml:"address"`
 	// Port is the tcp port number or service name the web server will listen to
 	Port string `yaml:"port"`
+	// Backend is where trains come from: navitia for the live api or gtfs for an offline GTFS feed
+	Backend string `yaml:"backend"`
+	// GTFS configures the gtfs backend
+	GTFS GTFSConfig `yaml:"gtfs"`
 	// Token is the sncf api token
 	Token string `yaml:"token"`
+	// Tokens are additional api tokens, the requests are spread among all the tokens
+	Tokens []string `yaml:"tokens"`
+	// TokenSelection is how the next token is chosen: round_robin or budget, which picks the one with the most
+	// requests left for the day
+	TokenSelection string `yaml:"token_selection"`
+	// Url is the base url of the navitia api, either the sncf one or any compatible implementation
+	Url string `yaml:"url"`
+	// Coverages are the navitia coverage regions to serve, the first one is preferred when a stop belongs to several
+	Coverages []string `yaml:"coverages"`
+	// PlacesFallback searches stops with the navitia places api when none matches locally
+	PlacesFallback bool `yaml:"places_fallback"`
+	// Cache tunes the navitia api responses cache
+	Cache CacheConfig `yaml:"cache"`
+	// Quota protects the sncf api token from being cut off
+	Quota QuotaConfig `yaml:"quota"`
+	// Retry tunes how failed api requests are retried
+	Retry RetryConfig `yaml:"retry"`
+	// CircuitBreaker tunes when to stop sending requests to a failing api
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// Board tunes how many trains the departures and arrivals boards display
+	Board BoardConfig `yaml:"board"`
+	// FeedTokens let other tools read the GTFS-RT and SIRI-Lite feeds without a session
+	FeedTokens []string `yaml:"feed_tokens"`
+}
+
+type GTFSConfig struct {
+	// Path is the GTFS zip archive to import, it is imported again at startup when it changed
+	Path string `yaml:"path"`
+	// TransferTime is the minimum time to change trains in the journeys planned offline
+	TransferTime time.Duration `yaml:"transfer_time"`
+	// Realtime merges the delays and cancellations of a GTFS-RT feed into the departures
+	Realtime GTFSRealtimeConfig `yaml:"realtime"`
+}
+
+func (c *GTFSConfig) validate() error {
+	if c.Path == "" {
+		return newInvalidGTFSPathError(c.Path)
+	}
+	if c.TransferTime == 0 {
+		c.TransferTime = 5 * time.Minute
+	}
+	if c.TransferTime < 0 {
+		return newInvalidGTFSTransferTimeError(c.TransferTime)
+	}
+	return c.Realtime.validate()
+}
+
+type GTFSRealtimeConfig struct {
+	// Source is the url or the local path of the GTFS-RT trip updates feed, empty to disable real-time
+	Source string `yaml:"source"`
+	// Interval is how often the feed is fetched
+	Interval time.Duration `yaml:"interval"`
+	// MaxAge is how old the feed can get before its updates are ignored, when it cannot be fetched anymore
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+func (c *GTFSRealtimeConfig) validate() error {
+	if c.Source == "" {
+		return nil
+	}
+	if strings.HasPrefix(c.Source, "http://") || strings.HasPrefix(c.Source, "https://") {
+		if u, err := url.Parse(c.Source); err != nil || u.Host == "" {
+			return newInvalidGTFSRealtimeError("source", c.Source)
+		}
+	}
+	if c.Interval == 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.Interval < 0 {
+		return newInvalidGTFSRealtimeError("interval", c.Interval)
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = 5 * time.Minute
+	}
+	if c.MaxAge < c.Interval {
+		return newInvalidGTFSRealtimeError("max_age", c.MaxAge)
+	}
+	return nil
+}
+
+type BoardConfig struct {
+	// Count is the maximum number of trains displayed on a board
+	Count int `yaml:"count"`
+	// Window is how far ahead trains are displayed, 0 means only Count limits the board
+	Window time.Duration `yaml:"window"`
+}
+
+func (c *BoardConfig) validate() error {
+	if c.Count == 0 {
+		c.Count = 10
+	}
+	if c.Count < 0 {
+		return newInvalidBoardError("count", c.Count)
+	}
+	if c.Window < 0 {
+		return newInvalidBoardError("window", c.Window)
+	}
+	return nil
+}
+
+type CacheConfig struct {
+	// Size is the maximum number of cached responses, the least recently used ones are evicted first
+	Size int `yaml:"size"`
+	// The time to live of responses, per navitia api endpoint
+	DeparturesTTL time.Duration `yaml:"departures_ttl"`
+	JourneysTTL   time.Duration `yaml:"journeys_ttl"`
+	StopsTTL      time.Duration `yaml:"stops_ttl"`
+	// StaleWhileRevalidate is how long an expired response can still be served while it is refreshed in the background
+	StaleWhileRevalidate time.Duration `yaml:"stale_while_revalidate"`
+}
+
+func (c *CacheConfig) validate() error {
+	if c.Size == 0 {
+		c.Size = 1000
+	}
+	if c.Size < 0 {
+		return newInvalidCacheError("size", c.Size)
+	}
+	for _, ttl := range []struct {
+		name     string
+		value    *time.Duration
+		fallback time.Duration
+	}{
+		{"departures_ttl", &c.DeparturesTTL, time.Minute},
+		{"journeys_ttl", &c.JourneysTTL, time.Minute},
+		{"stops_ttl", &c.StopsTTL, 24 * time.Hour},
+	} {
+		if *ttl.value == 0 {
+			*ttl.value = ttl.fallback
+		}
+		if *ttl.value < 0 {
+			return newInvalidCacheError(ttl.name, *ttl.value)
+		}
+	}
+	if c.StaleWhileRevalidate < 0 {
+		return newInvalidCacheError("stale_while_revalidate", c.StaleWhileRevalidate)
+	}
+	return nil
+}
+
+type QuotaConfig struct {
+	// DailyBudget is the maximum number of api requests per day, the sncf api cuts tokens off after 5000
+	DailyBudget int `yaml:"daily_budget"`
+	// Rate is the number of api requests allowed per second, with bursts of up to Burst requests
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+func (c *QuotaConfig) validate() error {
+	if c.DailyBudget == 0 {
+		c.DailyBudget = 5000
+	}
+	if c.DailyBudget < 0 {
+		return newInvalidQuotaError("daily_budget", c.DailyBudget)
+	}
+	if c.Rate == 0 {
+		c.Rate = 5
+	}
+	if c.Rate < 0 {
+		return newInvalidQuotaError("rate", c.Rate)
+	}
+	if c.Burst == 0 {
+		c.Burst = 10
+	}
+	if c.Burst < 0 {
+		return newInvalidQuotaError("burst", c.Burst)
+	}
+	return nil
+}
+
+type RetryConfig struct {
+	// Attempts is the maximum number of attempts of a request, 1 disables retries
+	Attempts int `yaml:"attempts"`
+	// The backoff between attempts doubles from InitialBackoff up to MaxBackoff, with some jitter
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+func (c *RetryConfig) validate() error {
+	if c.Attempts == 0 {
+		c.Attempts = 3
+	}
+	if c.Attempts < 0 {
+		return newInvalidRetryError("attempts", c.Attempts)
+	}
+	if c.InitialBackoff == 0 {
+		c.InitialBackoff = 500 * time.Millisecond
+	}
+	if c.InitialBackoff < 0 {
+		return newInvalidRetryError("initial_backoff", c.InitialBackoff)
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = 10 * time.Second
+	}
+	if c.MaxBackoff < c.InitialBackoff {
+		return newInvalidRetryError("max_backoff", c.MaxBackoff)
+	}
+	return nil
+}
+
+type CircuitBreakerConfig struct {
+	// Threshold is the number of consecutive failed requests that opens the circuit
+	Threshold int `yaml:"threshold"`
+	// Cooldown is how long the circuit stays open before a request is allowed to probe the api
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+func (c *CircuitBreakerConfig) validate() error {
+	if c.Threshold == 0 {
+		c.Threshold = 5
+	}
+	if c.Threshold < 0 {
+		return newInvalidCircuitBreakerError("threshold", c.Threshold)
+	}
+	if c.Cooldown == 0 {
+		c.Cooldown = 30 * time.Second
+	}
+	if c.Cooldown < 0 {
+		return newInvalidCircuitBreakerError("cooldown", c.Cooldown)
+	}
+	return nil
 }
 
 func (c *Config) validate() error {
@@ -36,11 +274,92 @@ func (c *Config) validate() error {
 	if _, err := net.LookupPort("tcp", c.Port); err != nil {
 		return newInvalidPortError(c.Port, err)
 	}
-	// token
-	if ok := validToken.MatchString(c.Token); !ok {
+	// backend
+	if c.Backend == "" {
+		c.Backend = "navitia"
+	}
+	switch c.Backend {
+	case "navitia":
+	case "gtfs":
+		if err := c.GTFS.validate(); err != nil {
+			return err
+		}
+	default:
+		return newInvalidBackendError(c.Backend)
+	}
+	// url
+	if c.Url == "" {
+		c.Url = "https://" + sncfHost + "/v1"
+	}
+	u, err := url.Parse(c.Url)
+	if err != nil {
+		return newInvalidUrlError(c.Url, err)
+	} else if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return newInvalidUrlError(c.Url, nil)
+	}
+	c.Url = strings.TrimSuffix(c.Url, "/")
+	// tokens, the gtfs backend does not query the api. The sncf api requires one of its tokens while a self hosted
+	// navitia can be queried with any token or without any
+	sncf := u.Hostname() == sncfHost
+	if c.Token == "" && len(c.Tokens) == 0 && c.Backend == "navitia" && sncf {
 		return newInvalidTokenError(c.Token)
 	}
-	return nil
+	for _, token := range c.ApiTokens() {
+		if sncf && !validToken.MatchString(token) || !validHeaderToken.MatchString(token) {
+			return newInvalidTokenError(token)
+		}
+	}
+	if c.TokenSelection == "" {
+		c.TokenSelection = "round_robin"
+	}
+	if c.TokenSelection != "round_robin" && c.TokenSelection != "budget" {
+		return newInvalidTokenSelectionError(c.TokenSelection)
+	}
+	// coverages
+	if len(c.Coverages) == 0 {
+		c.Coverages = []string{"sncf"}
+	}
+	for _, coverage := range c.Coverages {
+		if ok := validCoverage.MatchString(coverage); !ok {
+			return newInvalidCoverageError(coverage)
+		}
+	}
+	// cache
+	if err := c.Cache.validate(); err != nil {
+		return err
+	}
+	// quota
+	if err := c.Quota.validate(); err != nil {
+		return err
+	}
+	// retry
+	if err := c.Retry.validate(); err != nil {
+		return err
+	}
+	// circuit breaker
+	if err := c.CircuitBreaker.validate(); err != nil {
+		return err
+	}
+	// feed tokens
+	for _, token := range c.FeedTokens {
+		if len(token) < minFeedTokenLength || !validHeaderToken.MatchString(token) {
+			return newInvalidFeedTokenError()
+		}
+	}
+	// board
+	return c.Board.validate()
+}
+
+// ApiTokens returns all the configured api tokens, without duplicates
+func (c *Config) ApiTokens() (tokens []string) {
+	seen := make(map[string]bool)
+	for _, token := range append([]string{c.Token}, c.Tokens...) {
+		if token != "" && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return
 }
 
 // LoadFile loads the c from a given file
@@ -2,30 +2,144 @@ package config
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestLoadFile(t *testing.T) {
+	defaultCacheConfig := CacheConfig{
+		Size:          1000,
+		DeparturesTTL: time.Minute,
+		JourneysTTL:   time.Minute,
+		StopsTTL:      24 * time.Hour,
+	}
+	defaultQuotaConfig := QuotaConfig{
+		DailyBudget: 5000,
+		Rate:        5,
+		Burst:       10,
+	}
+	defaultRetryConfig := RetryConfig{
+		Attempts:       3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+	}
+	defaultCircuitBreakerConfig := CircuitBreakerConfig{
+		Threshold: 5,
+		Cooldown:  30 * time.Second,
+	}
+	defaultBoardConfig := BoardConfig{
+		Count: 10,
+	}
+
 	// Minimal yaml file
 	minimalConfig := Config{
-		Address: "127.0.0.1",
-		Port:    "8080",
-		Token:   "12345678-9abc-def0-1234-56789abcdef0",
+		Address:        "127.0.0.1",
+		Port:           "8080",
+		Backend:        "navitia",
+		Token:          "12345678-9abc-def0-1234-56789abcdef0",
+		TokenSelection: "round_robin",
+		Url:            "https://api.sncf.com/v1",
+		Coverages:      []string{"sncf"},
+		Cache:          defaultCacheConfig,
+		Quota:          defaultQuotaConfig,
+		Retry:          defaultRetryConfig,
+		CircuitBreaker: defaultCircuitBreakerConfig,
+		Board:          defaultBoardConfig,
 	}
 
 	// Minimal yaml file with hostname resolving
 	minimalConfigWithResolving := Config{
-		Address: "localhost",
-		Port:    "www",
-		Token:   "12345678-9abc-def0-1234-56789abcdef0",
+		Address:        "localhost",
+		Port:           "www",
+		Backend:        "navitia",
+		Token:          "12345678-9abc-def0-1234-56789abcdef0",
+		TokenSelection: "round_robin",
+		Url:            "https://api.sncf.com/v1",
+		Coverages:      []string{"sncf"},
+		Cache:          defaultCacheConfig,
+		Quota:          defaultQuotaConfig,
+		Retry:          defaultRetryConfig,
+		CircuitBreaker: defaultCircuitBreakerConfig,
+		Board:          defaultBoardConfig,
 	}
 
 	// Complete yaml file
 	completeConfig := Config{
-		Address: "127.0.0.2",
-		Port:    "8082",
-		Token:   "12345678-9abc-def0-1234-56789abcdef0",
+		Address:        "127.0.0.2",
+		Port:           "8082",
+		Backend:        "navitia",
+		Token:          "12345678-9abc-def0-1234-56789abcdef0",
+		Tokens:         []string{"12345678-9abc-def0-1234-56789abcdef1", "12345678-9abc-def0-1234-56789abcdef0"},
+		Url:            "http://navitia.example.com/v1",
+		TokenSelection: "budget",
+		Coverages:      []string{"sncf", "fr-se"},
+		PlacesFallback: true,
+		Cache: CacheConfig{
+			Size:                 500,
+			DeparturesTTL:        2 * time.Minute,
+			JourneysTTL:          5 * time.Minute,
+			StopsTTL:             12 * time.Hour,
+			StaleWhileRevalidate: 30 * time.Second,
+		},
+		Quota: QuotaConfig{
+			DailyBudget: 4000,
+			Rate:        0.5,
+			Burst:       3,
+		},
+		Retry: RetryConfig{
+			Attempts:       5,
+			InitialBackoff: time.Second,
+			MaxBackoff:     time.Minute,
+		},
+		CircuitBreaker: CircuitBreakerConfig{
+			Threshold: 10,
+			Cooldown:  time.Minute,
+		},
+		Board: BoardConfig{
+			Count:  20,
+			Window: 2 * time.Hour,
+		},
+		FeedTokens: []string{"0123456789abcdef0123456789abcdef"},
+	}
+
+	// GTFS backend yaml file, without api token
+	gtfsConfig := Config{
+		Address: "127.0.0.1",
+		Port:    "8080",
+		Backend: "gtfs",
+		GTFS: GTFSConfig{
+			Path:         "/var/lib/trains/export-ter-gtfs-last.zip",
+			TransferTime: 5 * time.Minute,
+			Realtime: GTFSRealtimeConfig{
+				Source:   "https://proxy.transport.data.gouv.fr/resource/sncf-ter-gtfs-rt-trip-updates",
+				Interval: 30 * time.Second,
+				MaxAge:   5 * time.Minute,
+			},
+		},
+		TokenSelection: "round_robin",
+		Url:            "https://api.sncf.com/v1",
+		Coverages:      []string{"sncf"},
+		Cache:          defaultCacheConfig,
+		Quota:          defaultQuotaConfig,
+		Retry:          defaultRetryConfig,
+		CircuitBreaker: defaultCircuitBreakerConfig,
+		Board:          defaultBoardConfig,
+	}
+
+	// self hosted navitia yaml file, without api token
+	selfHostedConfig := Config{
+		Address:        "127.0.0.1",
+		Port:           "8080",
+		Backend:        "navitia",
+		TokenSelection: "round_robin",
+		Url:            "http://navitia.example.com/v1",
+		Coverages:      []string{"sncf"},
+		Cache:          defaultCacheConfig,
+		Quota:          defaultQuotaConfig,
+		Retry:          defaultRetryConfig,
+		CircuitBreaker: defaultCircuitBreakerConfig,
+		Board:          defaultBoardConfig,
 	}
 
 	// Test cases
@@ -40,10 +154,35 @@ func TestLoadFile(t *testing.T) {
 		{"Invalid address should fail to load", "test_data/invalid_address.yaml", nil, InvalidAddressError{}},
 		{"Unresolvable address should fail to load", "test_data/invalid_address_unresolvable.yaml", nil, InvalidAddressError{}},
 		{"Invalid port should fail to load", "test_data/invalid_port.yaml", nil, InvalidPortError{}},
+		{"Invalid backend should fail to load", "test_data/invalid_backend.yaml", nil, InvalidBackendError{}},
+		{"Missing gtfs path should fail to load", "test_data/missing_gtfs_path.yaml", nil, InvalidGTFSPathError{}},
+		{"Negative gtfs transfer time should fail to load", "test_data/invalid_gtfs_transfer_time.yaml", nil, InvalidGTFSTransferTimeError{}},
+		{"Invalid gtfs realtime source should fail to load", "test_data/invalid_gtfs_realtime_source.yaml", nil, InvalidGTFSRealtimeError{}},
+		{"Invalid gtfs realtime max age should fail to load", "test_data/invalid_gtfs_realtime_max_age.yaml", nil, InvalidGTFSRealtimeError{}},
 		{"Invalid token should fail to load", "test_data/invalid_token.yaml", nil, InvalidTokenError{}},
+		{"Missing token should fail to load", "test_data/missing_token.yaml", nil, InvalidTokenError{}},
+		{"Invalid token in the list should fail to load", "test_data/invalid_tokens.yaml", nil, InvalidTokenError{}},
+		{"Invalid self hosted token should fail to load", "test_data/invalid_self_hosted_token.yaml", nil, InvalidTokenError{}},
+		{"Invalid feed token should fail to load", "test_data/invalid_feed_token.yaml", nil, InvalidFeedTokenError{}},
+		{"Invalid token selection should fail to load", "test_data/invalid_token_selection.yaml", nil, InvalidTokenSelectionError{}},
+		{"Invalid url should fail to load", "test_data/invalid_url.yaml", nil, InvalidUrlError{}},
+		{"Url with credentials should fail to load", "test_data/invalid_url_credentials.yaml", nil, InvalidUrlError{}},
+		{"Invalid coverage should fail to load", "test_data/invalid_coverage.yaml", nil, InvalidCoverageError{}},
+		{"Invalid cache size should fail to load", "test_data/invalid_cache_size.yaml", nil, InvalidCacheError{}},
+		{"Invalid cache ttl should fail to load", "test_data/invalid_cache_ttl.yaml", nil, InvalidCacheError{}},
+		{"Invalid cache stale while revalidate should fail to load", "test_data/invalid_cache_stale.yaml", nil, InvalidCacheError{}},
+		{"Invalid quota budget should fail to load", "test_data/invalid_quota_budget.yaml", nil, InvalidQuotaError{}},
+		{"Invalid quota rate should fail to load", "test_data/invalid_quota_rate.yaml", nil, InvalidQuotaError{}},
+		{"Invalid retry attempts should fail to load", "test_data/invalid_retry_attempts.yaml", nil, InvalidRetryError{}},
+		{"Invalid retry backoffs should fail to load", "test_data/invalid_retry_backoff.yaml", nil, InvalidRetryError{}},
+		{"Invalid circuit breaker should fail to load", "test_data/invalid_circuit_breaker.yaml", nil, InvalidCircuitBreakerError{}},
+		{"Invalid board count should fail to load", "test_data/invalid_board_count.yaml", nil, InvalidBoardError{}},
+		{"Invalid board window should fail to load", "test_data/invalid_board_window.yaml", nil, InvalidBoardError{}},
 		{"Minimal config", "test_data/minimal.yaml", &minimalConfig, nil},
 		{"Minimal config with resolving", "test_data/minimal_with_hostname.yaml", &minimalConfigWithResolving, nil},
 		{"Complete config", "test_data/complete.yaml", &completeConfig, nil},
+		{"GTFS config", "test_data/gtfs.yaml", &gtfsConfig, nil},
+		{"Self hosted config", "test_data/self_hosted.yaml", &selfHostedConfig, nil},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -59,3 +198,12 @@ func TestLoadFile(t *testing.T) {
 		})
 	}
 }
+
+func TestApiTokens(t *testing.T) {
+	c := Config{Tokens: []string{"b", "a"}}
+	require.Equal(t, []string{"b", "a"}, c.ApiTokens())
+	c = Config{Token: "a", Tokens: []string{"b", "a", "c"}}
+	require.Equal(t, []string{"a", "b", "c"}, c.ApiTokens())
+	c = Config{}
+	require.Nil(t, c.ApiTokens())
+}
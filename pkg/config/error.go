@@ -1,6 +1,9 @@
 package config
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // file open configuration file error
 type OpenError struct {
@@ -88,3 +91,209 @@ func newInvalidTokenError(token string) error {
 		token: token,
 	}
 }
+
+// Invalid feed token error, the token is a secret that is not repeated
+type InvalidFeedTokenError struct{}
+
+func (e InvalidFeedTokenError) Error() string {
+	return fmt.Sprintf("Invalid feed token : it must be at least %d characters long, without spaces", minFeedTokenLength)
+}
+
+func newInvalidFeedTokenError() error {
+	return InvalidFeedTokenError{}
+}
+
+// Invalid url field error
+type InvalidUrlError struct {
+	url string
+	err error
+}
+
+func (e InvalidUrlError) Error() string {
+	return fmt.Sprintf("Invalid url %s : it must be an http or https url without credentials", e.url)
+}
+func (e InvalidUrlError) Unwrap() error { return e.err }
+
+func newInvalidUrlError(url string, err error) error {
+	return InvalidUrlError{
+		url: url,
+		err: err,
+	}
+}
+
+// Invalid coverages field error
+type InvalidCoverageError struct {
+	coverage string
+}
+
+func (e InvalidCoverageError) Error() string {
+	return fmt.Sprintf("Invalid coverage %s : it must be a navitia coverage region name", e.coverage)
+}
+
+func newInvalidCoverageError(coverage string) error {
+	return InvalidCoverageError{
+		coverage: coverage,
+	}
+}
+
+// Invalid cache field error
+type InvalidCacheError struct {
+	field string
+	value interface{}
+}
+
+func (e InvalidCacheError) Error() string {
+	return fmt.Sprintf("Invalid cache %s %v : it must be a positive number or duration", e.field, e.value)
+}
+
+func newInvalidCacheError(field string, value interface{}) error {
+	return InvalidCacheError{
+		field: field,
+		value: value,
+	}
+}
+
+// Invalid quota field error
+type InvalidQuotaError struct {
+	field string
+	value interface{}
+}
+
+func (e InvalidQuotaError) Error() string {
+	return fmt.Sprintf("Invalid quota %s %v : it must be a positive number", e.field, e.value)
+}
+
+func newInvalidQuotaError(field string, value interface{}) error {
+	return InvalidQuotaError{
+		field: field,
+		value: value,
+	}
+}
+
+// Invalid retry field error
+type InvalidRetryError struct {
+	field string
+	value interface{}
+}
+
+func (e InvalidRetryError) Error() string {
+	return fmt.Sprintf("Invalid retry %s %v : it must be a positive number or duration, max_backoff cannot be lower than initial_backoff", e.field, e.value)
+}
+
+func newInvalidRetryError(field string, value interface{}) error {
+	return InvalidRetryError{
+		field: field,
+		value: value,
+	}
+}
+
+// Invalid circuit breaker field error
+type InvalidCircuitBreakerError struct {
+	field string
+	value interface{}
+}
+
+func (e InvalidCircuitBreakerError) Error() string {
+	return fmt.Sprintf("Invalid circuit breaker %s %v : it must be a positive number or duration", e.field, e.value)
+}
+
+func newInvalidCircuitBreakerError(field string, value interface{}) error {
+	return InvalidCircuitBreakerError{
+		field: field,
+		value: value,
+	}
+}
+
+// Invalid token selection field error
+type InvalidTokenSelectionError struct {
+	selection string
+}
+
+func (e InvalidTokenSelectionError) Error() string {
+	return fmt.Sprintf("Invalid token selection %s : it must be either round_robin or budget", e.selection)
+}
+
+func newInvalidTokenSelectionError(selection string) error {
+	return InvalidTokenSelectionError{
+		selection: selection,
+	}
+}
+
+// Invalid board field error
+type InvalidBoardError struct {
+	field string
+	value interface{}
+}
+
+func (e InvalidBoardError) Error() string {
+	return fmt.Sprintf("Invalid board %s %v : it must be a positive number or duration", e.field, e.value)
+}
+
+func newInvalidBoardError(field string, value interface{}) error {
+	return InvalidBoardError{
+		field: field,
+		value: value,
+	}
+}
+
+// Invalid backend field error
+type InvalidBackendError struct {
+	backend string
+}
+
+func (e InvalidBackendError) Error() string {
+	return fmt.Sprintf("Invalid backend %s : it must be either navitia or gtfs", e.backend)
+}
+
+func newInvalidBackendError(backend string) error {
+	return InvalidBackendError{
+		backend: backend,
+	}
+}
+
+// Invalid gtfs path field error
+type InvalidGTFSPathError struct {
+	path string
+}
+
+func (e InvalidGTFSPathError) Error() string {
+	return fmt.Sprintf("Invalid gtfs path %s : it must be set when the backend is gtfs", e.path)
+}
+
+func newInvalidGTFSPathError(path string) error {
+	return InvalidGTFSPathError{
+		path: path,
+	}
+}
+
+// Invalid gtfs transfer time field error
+type InvalidGTFSTransferTimeError struct {
+	transferTime time.Duration
+}
+
+func (e InvalidGTFSTransferTimeError) Error() string {
+	return fmt.Sprintf("Invalid gtfs transfer time %s : it must be a positive duration", e.transferTime)
+}
+
+func newInvalidGTFSTransferTimeError(transferTime time.Duration) error {
+	return InvalidGTFSTransferTimeError{
+		transferTime: transferTime,
+	}
+}
+
+// Invalid gtfs realtime field error
+type InvalidGTFSRealtimeError struct {
+	field string
+	value interface{}
+}
+
+func (e InvalidGTFSRealtimeError) Error() string {
+	return fmt.Sprintf("Invalid gtfs realtime %s %v : it must be an url or a path, and positive durations with max_age not shorter than interval", e.field, e.value)
+}
+
+func newInvalidGTFSRealtimeError(field string, value interface{}) error {
+	return InvalidGTFSRealtimeError{
+		field: field,
+		value: value,
+	}
+}
@@ -26,4 +26,31 @@ func TestErrorsCoverage(t *testing.T) {
 	_ = invalidPortErr.Unwrap()
 	invalidTokenErr := InvalidTokenError{}
 	_ = invalidTokenErr.Error()
+	invalidFeedTokenErr := InvalidFeedTokenError{}
+	_ = invalidFeedTokenErr.Error()
+	invalidTokenSelectionErr := InvalidTokenSelectionError{}
+	_ = invalidTokenSelectionErr.Error()
+	invalidUrlErr := InvalidUrlError{}
+	_ = invalidUrlErr.Error()
+	_ = invalidUrlErr.Unwrap()
+	invalidCoverageErr := InvalidCoverageError{}
+	_ = invalidCoverageErr.Error()
+	invalidCacheErr := InvalidCacheError{}
+	_ = invalidCacheErr.Error()
+	invalidQuotaErr := InvalidQuotaError{}
+	_ = invalidQuotaErr.Error()
+	invalidRetryErr := InvalidRetryError{}
+	_ = invalidRetryErr.Error()
+	invalidCircuitBreakerErr := InvalidCircuitBreakerError{}
+	_ = invalidCircuitBreakerErr.Error()
+	invalidBoardErr := InvalidBoardError{}
+	_ = invalidBoardErr.Error()
+	invalidBackendErr := InvalidBackendError{}
+	_ = invalidBackendErr.Error()
+	invalidGTFSPathErr := InvalidGTFSPathError{}
+	_ = invalidGTFSPathErr.Error()
+	invalidGTFSTransferTimeErr := InvalidGTFSTransferTimeError{}
+	_ = invalidGTFSTransferTimeErr.Error()
+	invalidGTFSRealtimeErr := InvalidGTFSRealtimeError{}
+	_ = invalidGTFSRealtimeErr.Error()
 }
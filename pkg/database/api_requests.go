@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// GetApiRequests returns the number of navitia api requests performed with a token on a given day, the token is
+// identified by a fingerprint and never stored
+func (env *DBEnv) GetApiRequests(ctx context.Context, token string, day string) (i int, err error) {
+	query := `SELECT requests FROM api_requests WHERE day = $1 AND token = $2;`
+	err = env.db.QueryRowContext(ctx, query, day, token).Scan(&i)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, newQueryError("Could not run database query: most likely the schema is corrupted", err)
+	}
+	return
+}
+
+// IncrementApiRequests records a navitia api request performed with a token on a given day
+func (env *DBEnv) IncrementApiRequests(ctx context.Context, token string, day string) error {
+	query := `
+		INSERT INTO api_requests
+			(day, token, requests)
+		VALUES
+			($1, $2, 1)
+		ON CONFLICT (day, token) DO UPDATE SET
+			requests = requests + 1;`
+	_, err := env.db.ExecContext(ctx, query, day, token)
+	if err != nil {
+		return newQueryError("Could not run database query: most likely the schema is corrupted", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApiRequests(t *testing.T) {
+	// test db setup
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	// error checks
+	_, err = db.GetApiRequests(context.Background(), "token1", "2021-05-03")
+	require.Error(t, err)
+	requireErrorTypeMatch(t, err, QueryError{})
+	err = db.IncrementApiRequests(context.Background(), "token1", "2021-05-03")
+	require.Error(t, err)
+	requireErrorTypeMatch(t, err, QueryError{})
+	// normal checks
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	i, err := db.GetApiRequests(context.Background(), "token1", "2021-05-03")
+	require.NoError(t, err)
+	require.Equal(t, 0, i)
+	for j := 0; j < 3; j++ {
+		err = db.IncrementApiRequests(context.Background(), "token1", "2021-05-03")
+		require.NoError(t, err)
+	}
+	err = db.IncrementApiRequests(context.Background(), "token1", "2021-05-04")
+	require.NoError(t, err)
+	err = db.IncrementApiRequests(context.Background(), "token2", "2021-05-03")
+	require.NoError(t, err)
+	i, err = db.GetApiRequests(context.Background(), "token1", "2021-05-03")
+	require.NoError(t, err)
+	require.Equal(t, 3, i)
+	i, err = db.GetApiRequests(context.Background(), "token1", "2021-05-04")
+	require.NoError(t, err)
+	require.Equal(t, 1, i)
+	i, err = db.GetApiRequests(context.Background(), "token2", "2021-05-03")
+	require.NoError(t, err)
+	require.Equal(t, 1, i)
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// The kinds of boards we keep a copy of
+const (
+	arrivalsBoard   = "arrivals"
+	departuresBoard = "departures"
+)
+
+// SaveArrivals stores the last good arrivals of a stop so that they can be served when the navitia api is unavailable
+func (env *DBEnv) SaveArrivals(ctx context.Context, stopId string, arrivals []model.Arrival, updatedAt time.Time) error {
+	return env.saveBoard(ctx, stopId, arrivalsBoard, arrivals, updatedAt)
+}
+
+// GetArrivals returns the last good arrivals of a stop, along with the time they were fetched at
+func (env *DBEnv) GetArrivals(ctx context.Context, stopId string) (arrivals []model.Arrival, updatedAt *time.Time, err error) {
+	updatedAt, err = env.getBoard(ctx, stopId, arrivalsBoard, &arrivals)
+	return
+}
+
+// SaveDepartures stores the last good departures of a stop so that they can be served when the navitia api is unavailable
+func (env *DBEnv) SaveDepartures(ctx context.Context, stopId string, departures []model.Departure, updatedAt time.Time) error {
+	return env.saveBoard(ctx, stopId, departuresBoard, departures, updatedAt)
+}
+
+// GetDepartures returns the last good departures of a stop, along with the time they were fetched at
+func (env *DBEnv) GetDepartures(ctx context.Context, stopId string) (departures []model.Departure, updatedAt *time.Time, err error) {
+	updatedAt, err = env.getBoard(ctx, stopId, departuresBoard, &departures)
+	return
+}
+
+// WatchStop records that a user viewed the boards of a stop, its trains are then published in the feeds for a while
+func (env *DBEnv) WatchStop(ctx context.Context, stopId string, watchedAt time.Time) error {
+	query := `
+		INSERT INTO watched_stops
+			(stop_id, watched_at)
+		VALUES
+			($1, $2)
+		ON CONFLICT (stop_id) DO UPDATE SET
+			watched_at = excluded.watched_at;`
+	_, err := env.db.ExecContext(
+		ctx,
+		query,
+		stopId,
+		watchedAt.UTC(),
+	)
+	if err != nil {
+		return newQueryError("Could not run database query", err)
+	}
+	return nil
+}
+
+// GetWatchedStops returns the stops users viewed since a given time, ordered by id. Saving their boards does not
+// watch stops, so that the feeds fetching them do not keep them watched.
+func (env *DBEnv) GetWatchedStops(ctx context.Context, since time.Time) ([]model.Stop, error) {
+	query := `
+		SELECT ` + stopColumns + `
+		FROM stops
+		WHERE id IN (SELECT stop_id FROM watched_stops WHERE watched_at >= $1)
+		ORDER BY id;`
+	rows, err := env.db.QueryContext(ctx, query, since.UTC())
+	if err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	return scanStops(rows)
+}
+
+func (env *DBEnv) saveBoard(ctx context.Context, stopId string, kind string, board interface{}, updatedAt time.Time) error {
+	data, err := json.Marshal(board)
+	if err != nil {
+		return newJsonError("Could not encode "+kind+" of "+stopId, err)
+	}
+	query := `
+		INSERT INTO boards
+			(stop_id, kind, updated_at, data)
+		VALUES
+			($1, $2, $3, $4)
+		ON CONFLICT (stop_id, kind) DO UPDATE SET
+			updated_at = excluded.updated_at,
+			data = excluded.data;`
+	_, err = env.db.ExecContext(
+		ctx,
+		query,
+		stopId,
+		kind,
+		updatedAt.UTC(),
+		string(data),
+	)
+	if err != nil {
+		return newQueryError("Could not run database query", err)
+	}
+	return nil
+}
+
+func (env *DBEnv) getBoard(ctx context.Context, stopId string, kind string, board interface{}) (*time.Time, error) {
+	query := `SELECT updated_at, data FROM boards WHERE stop_id = $1 AND kind = $2;`
+	var updatedAt time.Time
+	var data string
+	err := env.db.QueryRowContext(
+		ctx,
+		query,
+		stopId,
+		kind,
+	).Scan(
+		&updatedAt,
+		&data,
+	)
+	if err != nil {
+		return nil, newQueryError("Could not run database query, most likely there is no saved board for this stop", err)
+	}
+	if err = json.Unmarshal([]byte(data), board); err != nil {
+		return nil, newJsonError("Could not decode "+kind+" of "+stopId, err)
+	}
+	return &updatedAt, nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepartures(t *testing.T) {
+	updatedAt := time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC)
+	departures := []model.Departure{
+		model.Departure{
+			Direction:     "test direction",
+			TrainNumber:   "886823",
+			BaseDeparture: updatedAt.Add(10 * time.Minute),
+			Departure:     updatedAt.Add(15 * time.Minute),
+			Delay:         5 * time.Minute,
+			RealTime:      true,
+			Disruptions:   []model.Disruption{model.Disruption{Id: "test", Messages: []string{"test message"}}},
+		},
+	}
+	// test db setup
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	// error checks
+	err = db.SaveDepartures(context.Background(), "stop_area:test:01", departures, updatedAt)
+	require.Error(t, err)
+	requireErrorTypeMatch(t, err, QueryError{})
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	_, _, err = db.GetDepartures(context.Background(), "stop_area:test:01")
+	require.Error(t, err)
+	requireErrorTypeMatch(t, err, QueryError{})
+	// normal checks
+	err = db.SaveDepartures(context.Background(), "stop_area:test:01", departures, updatedAt)
+	require.NoError(t, err)
+	valid, ts, err := db.GetDepartures(context.Background(), "stop_area:test:01")
+	require.NoError(t, err)
+	require.Equal(t, updatedAt, *ts)
+	require.Len(t, valid, 1)
+	require.True(t, valid[0].Departure.Equal(departures[0].Departure))
+	require.Equal(t, departures[0].Delay, valid[0].Delay)
+	require.Equal(t, departures[0].Disruptions, valid[0].Disruptions)
+	// a new save replaces the previous board
+	err = db.SaveDepartures(context.Background(), "stop_area:test:01", nil, updatedAt.Add(time.Minute))
+	require.NoError(t, err)
+	valid, ts, err = db.GetDepartures(context.Background(), "stop_area:test:01")
+	require.NoError(t, err)
+	require.Equal(t, updatedAt.Add(time.Minute), *ts)
+	require.Empty(t, valid)
+	// arrivals and departures are stored separately
+	_, _, err = db.GetArrivals(context.Background(), "stop_area:test:01")
+	require.Error(t, err)
+	requireErrorTypeMatch(t, err, QueryError{})
+}
+
+func TestArrivals(t *testing.T) {
+	updatedAt := time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC)
+	arrivals := []model.Arrival{
+		model.Arrival{
+			Origin:      "test origin",
+			BaseArrival: updatedAt.Add(10 * time.Minute),
+			Arrival:     updatedAt.Add(10 * time.Minute),
+			Cancelled:   true,
+		},
+	}
+	// test db setup
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	// normal checks
+	err = db.SaveArrivals(context.Background(), "stop_area:test:01", arrivals, updatedAt)
+	require.NoError(t, err)
+	valid, ts, err := db.GetArrivals(context.Background(), "stop_area:test:01")
+	require.NoError(t, err)
+	require.Equal(t, updatedAt, *ts)
+	require.Len(t, valid, 1)
+	require.Equal(t, "test origin", valid[0].Origin)
+	require.True(t, valid[0].Cancelled)
+}
+
+func TestGetWatchedStops(t *testing.T) {
+	updatedAt := time.Date(2021, 5, 3, 15, 4, 5, 0, time.UTC)
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	_, err = db.GetWatchedStops(context.Background(), updatedAt)
+	requireErrorTypeMatch(t, err, QueryError{})
+	err = db.WatchStop(context.Background(), "stop_area:test:01", updatedAt)
+	requireErrorTypeMatch(t, err, QueryError{})
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	err = db.ReplaceAndImportStops(context.Background(), []model.Stop{
+		model.Stop{Id: "stop_area:test:01", Name: "test 1"},
+		model.Stop{Id: "stop_area:test:02", Name: "test 2"},
+		model.Stop{Id: "stop_area:test:03", Name: "test 3"},
+		model.Stop{Id: "stop_area:test:04", Name: "test 4"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.WatchStop(context.Background(), "stop_area:test:02", updatedAt))
+	require.NoError(t, db.WatchStop(context.Background(), "stop_area:test:01", updatedAt.Add(-time.Hour)))
+	require.NoError(t, db.WatchStop(context.Background(), "stop_area:test:01", updatedAt.Add(time.Hour)))
+	// stops watched before and saved boards do not count
+	require.NoError(t, db.WatchStop(context.Background(), "stop_area:test:03", updatedAt.Add(-time.Minute)))
+	require.NoError(t, db.SaveDepartures(context.Background(), "stop_area:test:04", nil, updatedAt))
+	stops, err := db.GetWatchedStops(context.Background(), updatedAt)
+	require.NoError(t, err)
+	require.Len(t, stops, 2)
+	require.Equal(t, "stop_area:test:01", stops[0].Id)
+	require.Equal(t, "test 2", stops[1].Name)
+}
+
+func TestBoardsWithSQLMock(t *testing.T) {
+	// Invalid json data in database
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err, "an error '%s' was not expected when opening a stub database connection", err)
+	defer db.Close()
+	mock.ExpectQuery(`SELECT updated_at, data FROM boards`).WillReturnRows(sqlmock.NewRows([]string{"updated_at", "data"}).AddRow(time.Now(), "invalid"))
+	_, _, err = (&DBEnv{db: db}).GetDepartures(context.Background(), "stop_area:test:01")
+	require.Error(t, err)
+	requireErrorTypeMatch(t, err, JsonError{})
+}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -31,14 +32,14 @@ func InitDB(dbType string, dsn string) (*DBEnv, error) {
 }
 
 // Migrate performs the migrations of the database to the latest schema_version
-func (env *DBEnv) Migrate() error {
+func (env *DBEnv) Migrate(ctx context.Context) error {
 	var currentVersion int
-	if err := env.db.QueryRow(`SELECT version FROM schema_version`).Scan(&currentVersion); err != nil {
+	if err := env.db.QueryRowContext(ctx, `SELECT version FROM schema_version`).Scan(&currentVersion); err != nil {
 		currentVersion = 0
 	}
 	for version := currentVersion; version < len(migrations); version++ {
 		newVersion := version + 1
-		tx, err := env.db.Begin()
+		tx, err := env.db.BeginTx(ctx, nil)
 		if err != nil {
 			return newTransactionError("Could not begin transaction", err)
 		}
@@ -46,7 +47,7 @@ func (env *DBEnv) Migrate() error {
 			tx.Rollback()
 			return newMigrationError(newVersion, err)
 		}
-		if _, err := tx.Exec(`DELETE FROM schema_version; INSERT INTO schema_version (version) VALUES ($1)`, newVersion); err != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_version; INSERT INTO schema_version (version) VALUES ($1)`, newVersion); err != nil {
 			tx.Rollback()
 			return newMigrationError(newVersion, err)
 		}
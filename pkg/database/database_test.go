@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"testing"
@@ -61,7 +62,7 @@ func TestMigrate(t *testing.T) {
 	require.NoError(t, err, "Failed to init testfile.db : %+v", err)
 	defer os.Remove("testfile_notFromScratch.db")
 	migrations = onlyFirstMigration
-	err = notFromScratchDB.Migrate()
+	err = notFromScratchDB.Migrate(context.Background())
 	require.NoError(t, err, "Failed to migrate testfile.db to first schema version : %+v", err)
 
 	// Test cases
@@ -81,7 +82,7 @@ func TestMigrate(t *testing.T) {
 			db, err := InitDB("sqlite3", tc.dsn)
 			require.NoError(t, err)
 			migrations = tc.migrs
-			err = db.Migrate()
+			err = db.Migrate(context.Background())
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -121,7 +122,7 @@ func TestMigrateWithSQLMock(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			migrations = tc.migrs
-			err = tc.db.Migrate()
+			err = tc.db.Migrate(context.Background())
 			migrations = allMigrations
 			if tc.expectedError != nil {
 				require.Error(t, err)
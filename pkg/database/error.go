@@ -38,6 +38,24 @@ func newMigrationError(version int, err error) error {
 	}
 }
 
+// json encoding or decoding error
+type JsonError struct {
+	msg string
+	err error
+}
+
+func (e JsonError) Error() string {
+	return fmt.Sprintf("Failed to encode or decode json data : %s", e.msg)
+}
+func (e JsonError) Unwrap() error { return e.err }
+
+func newJsonError(msg string, err error) error {
+	return JsonError{
+		msg: msg,
+		err: err,
+	}
+}
+
 // Password hash error
 type PasswordError struct {
 	err error
@@ -15,6 +15,9 @@ func TestErrorsCoverage(t *testing.T) {
 	initErr := InitError{}
 	_ = initErr.Error()
 	_ = initErr.Unwrap()
+	jsonErr := JsonError{}
+	_ = jsonErr.Error()
+	_ = jsonErr.Unwrap()
 	migrationErr := MigrationError{}
 	_ = migrationErr.Error()
 	_ = migrationErr.Unwrap()
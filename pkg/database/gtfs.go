@@ -0,0 +1,304 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/gtfs"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// ImportGTFS replaces the imported gtfs feed, modifiedAt is the modification time of the archive it was read from
+func (env *DBEnv) ImportGTFS(ctx context.Context, feed *gtfs.Feed, modifiedAt time.Time) error {
+	tx, err := env.db.BeginTx(ctx, nil)
+	if err != nil {
+		return newTransactionError("Could not Begin()", err)
+	}
+	pre_query := `
+		DELETE FROM gtfs_feed;
+		DELETE FROM gtfs_stops;
+		DELETE FROM gtfs_routes;
+		DELETE FROM gtfs_trips;
+		DELETE FROM gtfs_stop_times;
+		DELETE FROM gtfs_calendar;
+		DELETE FROM gtfs_calendar_dates;`
+	if _, err = tx.ExecContext(ctx, pre_query); err != nil {
+		tx.Rollback()
+		return newQueryError("Could not run database query: most likely the schema is corrupted", err)
+	}
+	// rows are inserted with prepared statements, a whole country feed has millions of stop times
+	insert := func(query string, n int, args func(i int) []interface{}) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return newQueryError("Could not prepare database query", err)
+		}
+		defer stmt.Close()
+		for i := 0; i < n; i++ {
+			if _, err = stmt.ExecContext(ctx, args(i)...); err != nil {
+				return newQueryError("Could not run database query", err)
+			}
+		}
+		return nil
+	}
+	err = insert(`INSERT INTO gtfs_feed (timezone, modified_at) VALUES ($1, $2);`, 1, func(i int) []interface{} {
+		return []interface{}{feed.Timezone(), modifiedAt.Unix()}
+	})
+	if err == nil {
+		err = insert(`
+			INSERT INTO gtfs_stops
+				(stop_id, name, lat, lon, location_type, parent_station, timezone)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7);`, len(feed.Stops), func(i int) []interface{} {
+			s := &feed.Stops[i]
+			return []interface{}{s.Id, s.Name, s.Lat, s.Lon, s.LocationType, s.ParentStation, s.Timezone}
+		})
+	}
+	if err == nil {
+		err = insert(`
+			INSERT INTO gtfs_routes
+				(route_id, agency_id, short_name, long_name, route_type, color, text_color)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7);`, len(feed.Routes), func(i int) []interface{} {
+			r := &feed.Routes[i]
+			return []interface{}{r.Id, r.AgencyId, r.ShortName, r.LongName, r.Type, r.Color, r.TextColor}
+		})
+	}
+	if err == nil {
+		err = insert(`
+			INSERT INTO gtfs_trips
+				(trip_id, route_id, service_id, headsign, short_name)
+			VALUES
+				($1, $2, $3, $4, $5);`, len(feed.Trips), func(i int) []interface{} {
+			t := &feed.Trips[i]
+			return []interface{}{t.Id, t.RouteId, t.ServiceId, t.Headsign, t.ShortName}
+		})
+	}
+	if err == nil {
+		err = insert(`
+			INSERT INTO gtfs_stop_times
+				(trip_id, stop_sequence, stop_id, arrival_time, departure_time, pickup_type, drop_off_type)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7);`, len(feed.StopTimes), func(i int) []interface{} {
+			st := &feed.StopTimes[i]
+			return []interface{}{st.TripId, st.Sequence, st.StopId, int(st.Arrival / time.Second), int(st.Departure / time.Second), st.PickupType, st.DropOffType}
+		})
+	}
+	if err == nil {
+		err = insert(`
+			INSERT INTO gtfs_calendar
+				(service_id, sunday, monday, tuesday, wednesday, thursday, friday, saturday, start_date, end_date)
+			VALUES
+				($1, $2, $3, $4, $5, $6, $7, $8, $9, $10);`, len(feed.Calendars), func(i int) []interface{} {
+			c := &feed.Calendars[i]
+			args := []interface{}{c.ServiceId}
+			for _, d := range c.Days {
+				args = append(args, d)
+			}
+			return append(args, c.StartDate, c.EndDate)
+		})
+	}
+	if err == nil {
+		err = insert(`
+			INSERT INTO gtfs_calendar_dates
+				(service_id, date, exception_type)
+			VALUES
+				($1, $2, $3);`, len(feed.CalendarDates), func(i int) []interface{} {
+			cd := &feed.CalendarDates[i]
+			return []interface{}{cd.ServiceId, cd.Date, cd.ExceptionType}
+		})
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return newTransactionError("Could not commit transaction", err)
+	}
+	return nil
+}
+
+// GetGTFSModifiedAt returns the modification time of the archive the gtfs feed was imported from, nil if no feed was
+// imported yet
+func (env *DBEnv) GetGTFSModifiedAt(ctx context.Context) (*time.Time, error) {
+	query := `SELECT modified_at FROM gtfs_feed;`
+	var modifiedAt int64
+	err := env.db.QueryRowContext(ctx, query).Scan(&modifiedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	t := time.Unix(modifiedAt, 0)
+	return &t, nil
+}
+
+// GetGTFSTimezone returns the timezone of the imported gtfs feed
+func (env *DBEnv) GetGTFSTimezone(ctx context.Context) (tz string, err error) {
+	query := `SELECT timezone FROM gtfs_feed;`
+	err = env.db.QueryRowContext(ctx, query).Scan(&tz)
+	if err != nil {
+		return "", newQueryError("Could not run database query", err)
+	}
+	return
+}
+
+// GetGTFSStations returns the stations of the imported gtfs feed, and the stop points that are not part of a station
+func (env *DBEnv) GetGTFSStations(ctx context.Context) (stops []model.Stop, err error) {
+	query := `
+		SELECT s.stop_id, s.name, CASE s.timezone WHEN '' THEN f.timezone ELSE s.timezone END, s.lat, s.lon
+		FROM gtfs_stops s, gtfs_feed f
+		WHERE s.location_type = 1 OR (s.location_type = 0 AND s.parent_station = '')
+		ORDER BY s.name;`
+	rows, err := env.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stop model.Stop
+		var coord model.Coord
+		if err := rows.Scan(&stop.Id, &stop.Name, &stop.Timezone, &coord.Lat, &coord.Lon); err != nil {
+			return nil, newQueryError("Could not run database query", err)
+		}
+		stop.Coord = &coord
+		stops = append(stops, stop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	return
+}
+
+// gtfsServices selects the services running on the day $1, whose weekday is $2. Services run according to their weekly
+// calendar, on the days added by their exceptions and not on the days removed.
+const gtfsServices = `
+		WITH services AS (
+			SELECT service_id FROM gtfs_calendar
+			WHERE start_date <= $1 AND end_date >= $1 AND CASE $2
+				WHEN 0 THEN sunday
+				WHEN 1 THEN monday
+				WHEN 2 THEN tuesday
+				WHEN 3 THEN wednesday
+				WHEN 4 THEN thursday
+				WHEN 5 THEN friday
+				ELSE saturday
+			END = 1
+			UNION
+			SELECT service_id FROM gtfs_calendar_dates WHERE date = $1 AND exception_type = 1
+			EXCEPT
+			SELECT service_id FROM gtfs_calendar_dates WHERE date = $1 AND exception_type = 2
+		)
+`
+
+// GetGTFSDepartures returns the departures from a station of the gtfs trips running on a service day, between two
+// times relative to noon minus 12h of that day. A negative limit means no limit.
+func (env *DBEnv) GetGTFSDepartures(ctx context.Context, station string, day time.Time, from time.Duration, to time.Duration, limit int) (departures []gtfs.ScheduledDeparture, err error) {
+	query := gtfsServices + `
+		SELECT
+			st.trip_id, st.stop_id, st.stop_sequence, t.short_name, t.headsign, r.route_id, r.short_name, r.long_name,
+			st.arrival_time, st.departure_time,
+			(SELECT s.name FROM gtfs_stop_times terminus JOIN gtfs_stops s ON s.stop_id = terminus.stop_id
+				WHERE terminus.trip_id = st.trip_id ORDER BY terminus.stop_sequence DESC LIMIT 1)
+		FROM gtfs_stop_times st
+		JOIN gtfs_trips t ON t.trip_id = st.trip_id
+		JOIN gtfs_routes r ON r.route_id = t.route_id
+		WHERE st.stop_id IN (SELECT stop_id FROM gtfs_stops WHERE stop_id = $3 OR parent_station = $3)
+			AND t.service_id IN services
+			AND st.departure_time >= $4 AND st.departure_time < $5
+			AND st.pickup_type != 1
+			AND EXISTS (SELECT 1 FROM gtfs_stop_times later
+				WHERE later.trip_id = st.trip_id AND later.stop_sequence > st.stop_sequence)
+		ORDER BY st.departure_time
+		LIMIT $6;`
+	rows, err := env.db.QueryContext(
+		ctx,
+		query,
+		day.Format("20060102"),
+		int(day.Weekday()),
+		station,
+		int(from/time.Second),
+		int(to/time.Second),
+		limit,
+	)
+	if err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var shortName, headsign string
+		var arrival, departure int
+		sd := gtfs.ScheduledDeparture{ServiceDay: day.Format("20060102")}
+		d := &sd.Departure
+		if err := rows.Scan(&sd.TripId, &sd.StopId, &sd.StopSequence, &shortName, &headsign, &d.Line, &d.CommercialMode, &d.LineName, &arrival, &departure, &d.Direction); err != nil {
+			return nil, newQueryError("Could not run database query", err)
+		}
+		// feeds like the SNCF ones put the train number in the headsign
+		d.TrainNumber = shortName
+		if d.TrainNumber == "" {
+			d.TrainNumber = headsign
+		}
+		if d.LineName == "" {
+			d.LineName = d.CommercialMode
+		}
+		d.BaseArrival = gtfs.ServiceTime(day, time.Duration(arrival)*time.Second)
+		d.Arrival = d.BaseArrival
+		d.BaseDeparture = gtfs.ServiceTime(day, time.Duration(departure)*time.Second)
+		d.Departure = d.BaseDeparture
+		departures = append(departures, sd)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	return
+}
+
+// GetGTFSTrips returns the gtfs trips running on a service day with their stop times, whose stop ids are replaced by
+// the ones of their stations
+func (env *DBEnv) GetGTFSTrips(ctx context.Context, day time.Time) (trips []gtfs.ScheduledTrip, err error) {
+	query := gtfsServices + `
+		SELECT
+			t.trip_id, t.short_name, t.headsign, r.short_name, r.long_name,
+			CASE s.parent_station WHEN '' THEN s.stop_id ELSE s.parent_station END,
+			st.stop_sequence, st.arrival_time, st.departure_time, st.pickup_type, st.drop_off_type
+		FROM gtfs_trips t
+		JOIN gtfs_routes r ON r.route_id = t.route_id
+		JOIN gtfs_stop_times st ON st.trip_id = t.trip_id
+		JOIN gtfs_stops s ON s.stop_id = st.stop_id
+		WHERE t.service_id IN services
+		ORDER BY t.trip_id, st.stop_sequence;`
+	rows, err := env.db.QueryContext(ctx, query, day.Format("20060102"), int(day.Weekday()))
+	if err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tripId, shortName, headsign, routeShortName, routeLongName string
+		var arrival, departure int
+		st := gtfs.StopTime{}
+		if err := rows.Scan(&tripId, &shortName, &headsign, &routeShortName, &routeLongName, &st.StopId, &st.Sequence, &arrival, &departure, &st.PickupType, &st.DropOffType); err != nil {
+			return nil, newQueryError("Could not run database query", err)
+		}
+		if len(trips) == 0 || trips[len(trips)-1].TripId != tripId {
+			trip := gtfs.ScheduledTrip{TripId: tripId, TrainNumber: shortName, CommercialMode: routeShortName, Line: routeLongName}
+			// feeds like the SNCF ones put the train number in the headsign
+			if trip.TrainNumber == "" {
+				trip.TrainNumber = headsign
+			}
+			if trip.Line == "" {
+				trip.Line = routeShortName
+			}
+			trips = append(trips, trip)
+		}
+		st.TripId = tripId
+		st.Arrival = time.Duration(arrival) * time.Second
+		st.Departure = time.Duration(departure) * time.Second
+		trip := &trips[len(trips)-1]
+		trip.StopTimes = append(trip.StopTimes, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	return
+}
@@ -0,0 +1,276 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/gtfs"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/require"
+)
+
+// testFeed has a weekday train, a week-end train and a night train running only on may 3rd
+var testFeed = gtfs.Feed{
+	Agencies: []gtfs.Agency{gtfs.Agency{Id: "OCESN", Name: "SNCF", Timezone: "Europe/Paris"}},
+	Stops: []gtfs.Stop{
+		gtfs.Stop{Id: "StopArea:OCE87723197", Name: "Lyon Part Dieu", Lat: 45.76058, Lon: 4.85956, LocationType: 1},
+		gtfs.Stop{Id: "StopPoint:OCETrain TER-87723197", Name: "Lyon Part Dieu", Lat: 45.76058, Lon: 4.85956, ParentStation: "StopArea:OCE87723197"},
+		gtfs.Stop{Id: "StopArea:OCE87723502", Name: "Crépieux-la-Pape", Lat: 45.80482, Lon: 4.89214, LocationType: 1},
+		gtfs.Stop{Id: "StopPoint:OCETrain TER-87723502", Name: "Crépieux-la-Pape", Lat: 45.80482, Lon: 4.89214, ParentStation: "StopArea:OCE87723502"},
+		gtfs.Stop{Id: "StopPoint:OCETrain TER-87743716", Name: "Ambérieu-en-Bugey", Lat: 45.95445, Lon: 5.34223, Timezone: "Europe/Brussels"},
+	},
+	Routes: []gtfs.Route{gtfs.Route{Id: "OCE1506105", AgencyId: "OCESN", ShortName: "TER", Type: 2}},
+	Trips: []gtfs.Trip{
+		gtfs.Trip{Id: "weekday", RouteId: "OCE1506105", ServiceId: "1", Headsign: "886823"},
+		gtfs.Trip{Id: "weekend", RouteId: "OCE1506105", ServiceId: "2", Headsign: "Ambérieu", ShortName: "886825"},
+		gtfs.Trip{Id: "night", RouteId: "OCE1506105", ServiceId: "3", Headsign: "886899"},
+	},
+	StopTimes: []gtfs.StopTime{
+		gtfs.StopTime{TripId: "weekday", StopId: "StopPoint:OCETrain TER-87723197", Sequence: 0, Arrival: 13*time.Hour + 5*time.Minute, Departure: 13*time.Hour + 8*time.Minute},
+		gtfs.StopTime{TripId: "weekday", StopId: "StopPoint:OCETrain TER-87723502", Sequence: 1, Arrival: 13*time.Hour + 17*time.Minute, Departure: 13*time.Hour + 18*time.Minute},
+		gtfs.StopTime{TripId: "weekday", StopId: "StopPoint:OCETrain TER-87743716", Sequence: 2, Arrival: 13*time.Hour + 45*time.Minute, Departure: 13*time.Hour + 45*time.Minute},
+		gtfs.StopTime{TripId: "weekend", StopId: "StopPoint:OCETrain TER-87723197", Sequence: 0, Arrival: 10*time.Hour + 5*time.Minute, Departure: 10*time.Hour + 8*time.Minute},
+		gtfs.StopTime{TripId: "weekend", StopId: "StopPoint:OCETrain TER-87723502", Sequence: 1, Arrival: 10*time.Hour + 17*time.Minute, Departure: 10*time.Hour + 18*time.Minute, PickupType: 1},
+		gtfs.StopTime{TripId: "weekend", StopId: "StopPoint:OCETrain TER-87743716", Sequence: 2, Arrival: 10*time.Hour + 45*time.Minute, Departure: 10*time.Hour + 45*time.Minute},
+		gtfs.StopTime{TripId: "night", StopId: "StopPoint:OCETrain TER-87723197", Sequence: 0, Arrival: 23*time.Hour + 50*time.Minute, Departure: 23*time.Hour + 52*time.Minute},
+		gtfs.StopTime{TripId: "night", StopId: "StopPoint:OCETrain TER-87723502", Sequence: 1, Arrival: 24*time.Hour + 4*time.Minute, Departure: 24*time.Hour + 5*time.Minute},
+		gtfs.StopTime{TripId: "night", StopId: "StopPoint:OCETrain TER-87743716", Sequence: 2, Arrival: 24*time.Hour + 32*time.Minute, Departure: 24*time.Hour + 32*time.Minute},
+	},
+	Calendars: []gtfs.Calendar{
+		gtfs.Calendar{ServiceId: "1", Days: [7]bool{false, true, true, true, true, true, false}, StartDate: "20210501", EndDate: "20210531"},
+		gtfs.Calendar{ServiceId: "2", Days: [7]bool{true, false, false, false, false, false, true}, StartDate: "20210501", EndDate: "20210531"},
+	},
+	CalendarDates: []gtfs.CalendarDate{
+		// ascension day runs on the week-end service
+		gtfs.CalendarDate{ServiceId: "1", Date: "20210513", ExceptionType: 2},
+		gtfs.CalendarDate{ServiceId: "2", Date: "20210513", ExceptionType: 1},
+		gtfs.CalendarDate{ServiceId: "3", Date: "20210503", ExceptionType: 1},
+	},
+}
+
+func TestImportGTFS(t *testing.T) {
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	modifiedAt, err := db.GetGTFSModifiedAt(context.Background())
+	require.NoError(t, err)
+	require.Nil(t, modifiedAt)
+	// importing twice replaces the feed
+	require.NoError(t, db.ImportGTFS(context.Background(), &testFeed, time.Unix(1620000000, 0)))
+	require.NoError(t, db.ImportGTFS(context.Background(), &testFeed, time.Unix(1620086400, 0)))
+	modifiedAt, err = db.GetGTFSModifiedAt(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, time.Unix(1620086400, 0), *modifiedAt)
+	tz, err := db.GetGTFSTimezone(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Paris", tz)
+	stations, err := db.GetGTFSStations(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []model.Stop{
+		model.Stop{Id: "StopPoint:OCETrain TER-87743716", Name: "Ambérieu-en-Bugey", Timezone: "Europe/Brussels", Coord: &model.Coord{Lat: 45.95445, Lon: 5.34223}},
+		model.Stop{Id: "StopArea:OCE87723502", Name: "Crépieux-la-Pape", Timezone: "Europe/Paris", Coord: &model.Coord{Lat: 45.80482, Lon: 4.89214}},
+		model.Stop{Id: "StopArea:OCE87723197", Name: "Lyon Part Dieu", Timezone: "Europe/Paris", Coord: &model.Coord{Lat: 45.76058, Lon: 4.85956}},
+	}, stations)
+}
+
+func TestGetGTFSDepartures(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, db.ImportGTFS(context.Background(), &testFeed, time.Now()))
+	testCases := []struct {
+		name     string
+		station  string
+		day      time.Time
+		from     time.Duration
+		to       time.Duration
+		limit    int
+		expected []gtfs.ScheduledDeparture
+	}{
+		{"weekday and night train", "StopArea:OCE87723502", time.Date(2021, time.May, 3, 0, 0, 0, 0, paris), 0, 48 * time.Hour, -1, []gtfs.ScheduledDeparture{
+			gtfs.ScheduledDeparture{
+				Departure: model.Departure{
+					Direction:      "Ambérieu-en-Bugey",
+					TrainNumber:    "886823",
+					CommercialMode: "TER",
+					Line:           "OCE1506105",
+					LineName:       "TER",
+					BaseDeparture:  time.Date(2021, time.May, 3, 13, 18, 0, 0, paris),
+					Departure:      time.Date(2021, time.May, 3, 13, 18, 0, 0, paris),
+					BaseArrival:    time.Date(2021, time.May, 3, 13, 17, 0, 0, paris),
+					Arrival:        time.Date(2021, time.May, 3, 13, 17, 0, 0, paris),
+				},
+				TripId:       "weekday",
+				StopId:       "StopPoint:OCETrain TER-87723502",
+				StopSequence: 1,
+				ServiceDay:   "20210503",
+			},
+			gtfs.ScheduledDeparture{
+				Departure: model.Departure{
+					Direction:      "Ambérieu-en-Bugey",
+					TrainNumber:    "886899",
+					CommercialMode: "TER",
+					Line:           "OCE1506105",
+					LineName:       "TER",
+					BaseDeparture:  time.Date(2021, time.May, 4, 0, 5, 0, 0, paris),
+					Departure:      time.Date(2021, time.May, 4, 0, 5, 0, 0, paris),
+					BaseArrival:    time.Date(2021, time.May, 4, 0, 4, 0, 0, paris),
+					Arrival:        time.Date(2021, time.May, 4, 0, 4, 0, 0, paris),
+				},
+				TripId:       "night",
+				StopId:       "StopPoint:OCETrain TER-87723502",
+				StopSequence: 1,
+				ServiceDay:   "20210503",
+			},
+		}},
+		{"limit", "StopArea:OCE87723502", time.Date(2021, time.May, 3, 0, 0, 0, 0, paris), 0, 48 * time.Hour, 1, []gtfs.ScheduledDeparture{
+			gtfs.ScheduledDeparture{
+				Departure: model.Departure{
+					Direction:      "Ambérieu-en-Bugey",
+					TrainNumber:    "886823",
+					CommercialMode: "TER",
+					Line:           "OCE1506105",
+					LineName:       "TER",
+					BaseDeparture:  time.Date(2021, time.May, 3, 13, 18, 0, 0, paris),
+					Departure:      time.Date(2021, time.May, 3, 13, 18, 0, 0, paris),
+					BaseArrival:    time.Date(2021, time.May, 3, 13, 17, 0, 0, paris),
+					Arrival:        time.Date(2021, time.May, 3, 13, 17, 0, 0, paris),
+				},
+				TripId:       "weekday",
+				StopId:       "StopPoint:OCETrain TER-87723502",
+				StopSequence: 1,
+				ServiceDay:   "20210503",
+			},
+		}},
+		{"time window", "StopArea:OCE87723502", time.Date(2021, time.May, 3, 0, 0, 0, 0, paris), 14 * time.Hour, 24 * time.Hour, -1, nil},
+		{"weekend train from its origin", "StopArea:OCE87723197", time.Date(2021, time.May, 13, 0, 0, 0, 0, paris), 0, 48 * time.Hour, -1, []gtfs.ScheduledDeparture{
+			gtfs.ScheduledDeparture{
+				Departure: model.Departure{
+					Direction:      "Ambérieu-en-Bugey",
+					TrainNumber:    "886825",
+					CommercialMode: "TER",
+					Line:           "OCE1506105",
+					LineName:       "TER",
+					BaseDeparture:  time.Date(2021, time.May, 13, 10, 8, 0, 0, paris),
+					Departure:      time.Date(2021, time.May, 13, 10, 8, 0, 0, paris),
+					BaseArrival:    time.Date(2021, time.May, 13, 10, 5, 0, 0, paris),
+					Arrival:        time.Date(2021, time.May, 13, 10, 5, 0, 0, paris),
+				},
+				TripId:       "weekend",
+				StopId:       "StopPoint:OCETrain TER-87723197",
+				StopSequence: 0,
+				ServiceDay:   "20210513",
+			},
+		}},
+		// the weekend train does not pick up passengers there
+		{"no pickup", "StopArea:OCE87723502", time.Date(2021, time.May, 13, 0, 0, 0, 0, paris), 0, 48 * time.Hour, -1, nil},
+		// trains do not leave from their terminus
+		{"terminus", "StopPoint:OCETrain TER-87743716", time.Date(2021, time.May, 3, 0, 0, 0, 0, paris), 0, 48 * time.Hour, -1, nil},
+		{"out of the calendar", "StopArea:OCE87723197", time.Date(2021, time.June, 1, 0, 0, 0, 0, paris), 0, 48 * time.Hour, -1, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			departures, err := db.GetGTFSDepartures(context.Background(), tc.station, tc.day, tc.from, tc.to, tc.limit)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, departures)
+		})
+	}
+}
+
+func TestGetGTFSTrips(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, db.ImportGTFS(context.Background(), &testFeed, time.Now()))
+	trips, err := db.GetGTFSTrips(context.Background(), time.Date(2021, time.May, 3, 0, 0, 0, 0, paris))
+	require.NoError(t, err)
+	require.Equal(t, []gtfs.ScheduledTrip{
+		gtfs.ScheduledTrip{TripId: "night", TrainNumber: "886899", CommercialMode: "TER", Line: "TER", StopTimes: []gtfs.StopTime{
+			gtfs.StopTime{TripId: "night", StopId: "StopArea:OCE87723197", Sequence: 0, Arrival: 23*time.Hour + 50*time.Minute, Departure: 23*time.Hour + 52*time.Minute},
+			gtfs.StopTime{TripId: "night", StopId: "StopArea:OCE87723502", Sequence: 1, Arrival: 24*time.Hour + 4*time.Minute, Departure: 24*time.Hour + 5*time.Minute},
+			// stop points without a station stand for themselves
+			gtfs.StopTime{TripId: "night", StopId: "StopPoint:OCETrain TER-87743716", Sequence: 2, Arrival: 24*time.Hour + 32*time.Minute, Departure: 24*time.Hour + 32*time.Minute},
+		}},
+		gtfs.ScheduledTrip{TripId: "weekday", TrainNumber: "886823", CommercialMode: "TER", Line: "TER", StopTimes: []gtfs.StopTime{
+			gtfs.StopTime{TripId: "weekday", StopId: "StopArea:OCE87723197", Sequence: 0, Arrival: 13*time.Hour + 5*time.Minute, Departure: 13*time.Hour + 8*time.Minute},
+			gtfs.StopTime{TripId: "weekday", StopId: "StopArea:OCE87723502", Sequence: 1, Arrival: 13*time.Hour + 17*time.Minute, Departure: 13*time.Hour + 18*time.Minute},
+			gtfs.StopTime{TripId: "weekday", StopId: "StopPoint:OCETrain TER-87743716", Sequence: 2, Arrival: 13*time.Hour + 45*time.Minute, Departure: 13*time.Hour + 45*time.Minute},
+		}},
+	}, trips)
+	// ascension day runs on the week-end service
+	trips, err = db.GetGTFSTrips(context.Background(), time.Date(2021, time.May, 13, 0, 0, 0, 0, paris))
+	require.NoError(t, err)
+	require.Len(t, trips, 1)
+	require.Equal(t, "886825", trips[0].TrainNumber)
+	require.Equal(t, 1, trips[0].StopTimes[1].PickupType)
+	trips, err = db.GetGTFSTrips(context.Background(), time.Date(2021, time.June, 1, 0, 0, 0, 0, paris))
+	require.NoError(t, err)
+	require.Empty(t, trips)
+}
+
+func TestGTFSErrors(t *testing.T) {
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	// the schema does not exist yet
+	_, err = db.GetGTFSModifiedAt(context.Background())
+	requireErrorTypeMatch(t, err, QueryError{})
+	_, err = db.GetGTFSTimezone(context.Background())
+	requireErrorTypeMatch(t, err, QueryError{})
+	_, err = db.GetGTFSStations(context.Background())
+	requireErrorTypeMatch(t, err, QueryError{})
+	_, err = db.GetGTFSDepartures(context.Background(), "StopArea:OCE87723502", time.Now(), 0, 24*time.Hour, -1)
+	requireErrorTypeMatch(t, err, QueryError{})
+	_, err = db.GetGTFSTrips(context.Background(), time.Now())
+	requireErrorTypeMatch(t, err, QueryError{})
+	err = db.ImportGTFS(context.Background(), &testFeed, time.Now())
+	requireErrorTypeMatch(t, err, QueryError{})
+}
+
+func TestImportGTFSTransactionErrors(t *testing.T) {
+	// Transaction begin error
+	dbBeginError, _, err := sqlmock.New()
+	require.NoError(t, err, "an error '%s' was not expected when opening a stub database connection", err)
+	defer dbBeginError.Close()
+	// Query error cannot prepare
+	dbCannotPrepare, mockCannotPrepare, err := sqlmock.New()
+	require.NoError(t, err, "an error '%s' was not expected when opening a stub database connection", err)
+	defer dbCannotPrepare.Close()
+	mockCannotPrepare.ExpectBegin()
+	mockCannotPrepare.ExpectExec(`DELETE FROM`).WillReturnResult(sqlmock.NewResult(1, 1))
+	// Transaction commit error
+	dbCommitError, mockCommitError, err := sqlmock.New()
+	require.NoError(t, err, "an error '%s' was not expected when opening a stub database connection", err)
+	defer dbCommitError.Close()
+	mockCommitError.ExpectBegin()
+	mockCommitError.ExpectExec(`DELETE FROM`).WillReturnResult(sqlmock.NewResult(1, 1))
+	mockCommitError.ExpectPrepare(`INSERT INTO gtfs_feed`).ExpectExec().WillReturnResult(sqlmock.NewResult(1, 1))
+	for _, table := range []string{"gtfs_stops", "gtfs_routes", "gtfs_trips", "gtfs_stop_times", "gtfs_calendar", "gtfs_calendar_dates"} {
+		mockCommitError.ExpectPrepare(`INSERT INTO ` + table)
+	}
+	// Test cases
+	testCases := []struct {
+		name          string
+		db            *DBEnv
+		expectedError error
+	}{
+		{"begin transaction error", &DBEnv{db: dbBeginError}, TransactionError{}},
+		{"query error cannot prepare", &DBEnv{db: dbCannotPrepare}, QueryError{}},
+		{"commit transaction error", &DBEnv{db: dbCommitError}, TransactionError{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.db.ImportGTFS(context.Background(), &gtfs.Feed{}, time.Now())
+			require.Error(t, err)
+			requireErrorTypeMatch(t, err, tc.expectedError)
+		})
+	}
+}
@@ -30,6 +30,175 @@ var allMigrations = []func(tx *sql.Tx) error{
 		_, err = tx.Exec(sql)
 		return err
 	},
+	func(tx *sql.Tx) (err error) {
+		sql := `
+			CREATE TABLE boards (
+				stop_id TEXT NOT NULL,
+				kind TEXT NOT NULL,
+				updated_at DATE NOT NULL,
+				data TEXT NOT NULL,
+				PRIMARY KEY (stop_id, kind)
+			);`
+		_, err = tx.Exec(sql)
+		return err
+	},
+	func(tx *sql.Tx) (err error) {
+		sql := `
+			CREATE TABLE api_requests (
+				day TEXT PRIMARY KEY,
+				requests INTEGER NOT NULL DEFAULT 0
+			);`
+		_, err = tx.Exec(sql)
+		return err
+	},
+	func(tx *sql.Tx) (err error) {
+		sql := `ALTER TABLE stops ADD COLUMN coverage TEXT NOT NULL DEFAULT 'sncf';`
+		_, err = tx.Exec(sql)
+		return err
+	},
+	func(tx *sql.Tx) (err error) {
+		// requests are now counted per token, the previous counts are kept without any token
+		sql := `
+			CREATE TABLE api_token_requests (
+				day TEXT NOT NULL,
+				token TEXT NOT NULL,
+				requests INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (day, token)
+			);
+			INSERT INTO api_token_requests (day, token, requests) SELECT day, '', requests FROM api_requests;
+			DROP TABLE api_requests;
+			ALTER TABLE api_token_requests RENAME TO api_requests;`
+		_, err = tx.Exec(sql)
+		return err
+	},
+	func(tx *sql.Tx) (err error) {
+		// stop names are folded for accent and case insensitive searches
+		sql := `ALTER TABLE stops ADD COLUMN search TEXT NOT NULL DEFAULT '';`
+		if _, err = tx.Exec(sql); err != nil {
+			return err
+		}
+		rows, err := tx.Query(`SELECT id, name FROM stops;`)
+		if err != nil {
+			return err
+		}
+		names := make(map[string]string)
+		for rows.Next() {
+			var id, name string
+			if err = rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return err
+			}
+			names[id] = name
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		for id, name := range names {
+			if _, err = tx.Exec(`UPDATE stops SET search = $1 WHERE id = $2;`, normalizeName(name), id); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	func(tx *sql.Tx) (err error) {
+		// stops are imported again at startup to get their coordinates
+		sql := `
+			ALTER TABLE stops ADD COLUMN lat REAL;
+			ALTER TABLE stops ADD COLUMN lon REAL;
+			DELETE FROM stops;`
+		_, err = tx.Exec(sql)
+		return err
+	},
+	func(tx *sql.Tx) (err error) {
+		// stops are imported again at startup to get their metadata
+		sql := `
+			ALTER TABLE stops ADD COLUMN uic TEXT NOT NULL DEFAULT '';
+			ALTER TABLE stops ADD COLUMN city TEXT NOT NULL DEFAULT '';
+			ALTER TABLE stops ADD COLUMN timezone TEXT NOT NULL DEFAULT '';
+			DELETE FROM stops;`
+		_, err = tx.Exec(sql)
+		return err
+	},
+	func(tx *sql.Tx) (err error) {
+		// gtfs tables hold the offline feed as it was imported, ids are the ones of the feed
+		sql := `
+			CREATE TABLE gtfs_feed (
+				timezone TEXT NOT NULL,
+				-- modified_at is the unix time of the archive the feed was imported from
+				modified_at INTEGER NOT NULL
+			);
+			CREATE TABLE gtfs_stops (
+				stop_id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				lat REAL NOT NULL,
+				lon REAL NOT NULL,
+				location_type INTEGER NOT NULL,
+				parent_station TEXT NOT NULL,
+				timezone TEXT NOT NULL
+			);
+			CREATE INDEX gtfs_stops_parent_station ON gtfs_stops(parent_station);
+			CREATE TABLE gtfs_routes (
+				route_id TEXT PRIMARY KEY,
+				agency_id TEXT NOT NULL,
+				short_name TEXT NOT NULL,
+				long_name TEXT NOT NULL,
+				route_type INTEGER NOT NULL,
+				color TEXT NOT NULL,
+				text_color TEXT NOT NULL
+			);
+			CREATE TABLE gtfs_trips (
+				trip_id TEXT PRIMARY KEY,
+				route_id TEXT NOT NULL,
+				service_id TEXT NOT NULL,
+				headsign TEXT NOT NULL,
+				short_name TEXT NOT NULL
+			);
+			CREATE INDEX gtfs_trips_service_id ON gtfs_trips(service_id);
+			CREATE TABLE gtfs_stop_times (
+				trip_id TEXT NOT NULL,
+				stop_sequence INTEGER NOT NULL,
+				stop_id TEXT NOT NULL,
+				arrival_time INTEGER NOT NULL,
+				departure_time INTEGER NOT NULL,
+				pickup_type INTEGER NOT NULL,
+				drop_off_type INTEGER NOT NULL,
+				PRIMARY KEY (trip_id, stop_sequence)
+			);
+			CREATE INDEX gtfs_stop_times_stop_id ON gtfs_stop_times(stop_id, departure_time);
+			CREATE TABLE gtfs_calendar (
+				service_id TEXT PRIMARY KEY,
+				sunday INTEGER NOT NULL,
+				monday INTEGER NOT NULL,
+				tuesday INTEGER NOT NULL,
+				wednesday INTEGER NOT NULL,
+				thursday INTEGER NOT NULL,
+				friday INTEGER NOT NULL,
+				saturday INTEGER NOT NULL,
+				start_date TEXT NOT NULL,
+				end_date TEXT NOT NULL
+			);
+			CREATE TABLE gtfs_calendar_dates (
+				service_id TEXT NOT NULL,
+				date TEXT NOT NULL,
+				exception_type INTEGER NOT NULL,
+				PRIMARY KEY (service_id, date)
+			);`
+		_, err = tx.Exec(sql)
+		return err
+	},
+	func(tx *sql.Tx) (err error) {
+		// stops are watched when users view them instead of when their boards are saved, which the feeds also do
+		sql := `
+			CREATE TABLE watched_stops (
+				stop_id TEXT PRIMARY KEY,
+				watched_at DATE NOT NULL
+			);
+			INSERT INTO watched_stops (stop_id, watched_at)
+				SELECT stop_id, updated_at FROM boards WHERE kind = 'departures';`
+		_, err = tx.Exec(sql)
+		return err
+	},
 }
 
 // This variable exists so that tests can override it
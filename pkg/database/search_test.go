@@ -0,0 +1,28 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeName(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"empty", "", ""},
+		{"lowercase", "Lyon Part-Dieu", "lyon part dieu"},
+		{"accents", "Saint-Étienne Châteaucreux", "saint etienne chateaucreux"},
+		{"ligatures", "Œuvre Cœur", "oeuvre coeur"},
+		{"punctuation", "  L'Isle-d'Abeau (Isère)  ", "l isle d abeau isere"},
+		{"digits", "Paris 13e", "paris 13e"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, normalizeName(tc.input))
+		})
+	}
+	require.Equal(t, normalizeName("Saint-Etienne"), normalizeName("SAINT ÉTIENNE"))
+}
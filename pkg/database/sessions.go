@@ -1,11 +1,13 @@
 package database
 
 import (
+	"context"
+
 	"git.adyxax.org/adyxax/trains/pkg/model"
 	"github.com/google/uuid"
 )
 
-func (env *DBEnv) CreateSession(user *model.User) (*string, error) {
+func (env *DBEnv) CreateSession(ctx context.Context, user *model.User) (*string, error) {
 	token := uuid.NewString()
 
 	query := `
@@ -13,11 +15,12 @@ func (env *DBEnv) CreateSession(user *model.User) (*string, error) {
 			(token, user_id)
 		VALUES
 			($1, $2);`
-	tx, err := env.db.Begin()
+	tx, err := env.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, newTransactionError("Could not Begin()", err)
 	}
-	_, err = tx.Exec(
+	_, err = tx.ExecContext(
+		ctx,
 		query,
 		token,
 		user.Id,
@@ -32,7 +35,7 @@ func (env *DBEnv) CreateSession(user *model.User) (*string, error) {
 	return &token, nil
 }
 
-func (env *DBEnv) ResumeSession(token string) (*model.User, error) {
+func (env *DBEnv) ResumeSession(ctx context.Context, token string) (*model.User, error) {
 	user := model.User{}
 	query := `
 		SELECT
@@ -43,7 +46,8 @@ func (env *DBEnv) ResumeSession(token string) (*model.User, error) {
 			sessions ON users.id = sessions.user_id
 		WHERE
 			sessions.token = $1;`
-	err := env.db.QueryRow(
+	err := env.db.QueryRowContext(
+		ctx,
 		query,
 		token,
 	).Scan(
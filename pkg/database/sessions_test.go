@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"testing"
 
 	"git.adyxax.org/adyxax/trains/pkg/model"
@@ -12,14 +13,14 @@ func TestCreateSession(t *testing.T) {
 	// test db setup
 	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.NoError(t, err)
-	err = db.Migrate()
+	err = db.Migrate(context.Background())
 	require.NoError(t, err)
 	userReg1 := model.UserRegistration{
 		Username: "user1",
 		Password: "user1_pass",
 		Email:    "user1",
 	}
-	user1, err := db.CreateUser(&userReg1)
+	user1, err := db.CreateUser(context.Background(), &userReg1)
 	require.NoError(t, err)
 	user2 := *user1
 	user2.Id++ // we want a token request for an invalid user id
@@ -35,7 +36,7 @@ func TestCreateSession(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			valid, err := db.CreateSession(tc.input)
+			valid, err := db.CreateSession(context.Background(), tc.input)
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -70,7 +71,7 @@ func TestCreateSessionWithSQLMock(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			valid, err := tc.db.CreateSession(&model.User{})
+			valid, err := tc.db.CreateSession(context.Background(), &model.User{})
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -86,34 +87,34 @@ func TestResumeSession(t *testing.T) {
 	// test db setup : of the three users only two have session tokens
 	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.NoError(t, err)
-	err = db.Migrate()
+	err = db.Migrate(context.Background())
 	require.NoError(t, err)
 	userReg1 := model.UserRegistration{
 		Username: "user1",
 		Password: "user1_pass",
 		Email:    "user1",
 	}
-	user1, err := db.CreateUser(&userReg1)
+	user1, err := db.CreateUser(context.Background(), &userReg1)
 	require.NoError(t, err)
-	token1, err := db.CreateSession(user1)
+	token1, err := db.CreateSession(context.Background(), user1)
 	require.NoError(t, err)
-	token1bis, err := db.CreateSession(user1)
+	token1bis, err := db.CreateSession(context.Background(), user1)
 	require.NoError(t, err)
 	userReg2 := model.UserRegistration{
 		Username: "user2",
 		Password: "user2_pass",
 		Email:    "user2",
 	}
-	user2, err := db.CreateUser(&userReg2)
+	user2, err := db.CreateUser(context.Background(), &userReg2)
 	require.NoError(t, err)
-	token2, err := db.CreateSession(user2)
+	token2, err := db.CreateSession(context.Background(), user2)
 	require.NoError(t, err)
 	userReg3 := model.UserRegistration{
 		Username: "user3",
 		Password: "user3_pass",
 		Email:    "user3",
 	}
-	_, err = db.CreateUser(&userReg3)
+	_, err = db.CreateUser(context.Background(), &userReg3)
 	require.NoError(t, err)
 	// Test cases
 	testCases := []struct {
@@ -129,7 +130,7 @@ func TestResumeSession(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			valid, err := db.ResumeSession(tc.input)
+			valid, err := db.ResumeSession(context.Background(), tc.input)
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				require.Nil(t, valid)
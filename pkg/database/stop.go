@@ -1,71 +1,181 @@
 package database
 
 import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+
 	"git.adyxax.org/adyxax/trains/pkg/model"
 )
 
-func (env *DBEnv) CountStops() (i int, err error) {
+// stopCoord returns the coordinates of a stop read from the database, nil when unknown
+func stopCoord(lat sql.NullFloat64, lon sql.NullFloat64) *model.Coord {
+	if !lat.Valid || !lon.Valid {
+		return nil
+	}
+	return &model.Coord{Lat: lat.Float64, Lon: lon.Float64}
+}
+
+// stopColumns are the columns scanStops reads
+const stopColumns = `id, name, coverage, uic, city, timezone, lat, lon`
+
+// scanStops reads stops from the stopColumns of a query
+func scanStops(rows *sql.Rows) (stops []model.Stop, err error) {
+	defer rows.Close()
+	for rows.Next() {
+		var stop model.Stop
+		var lat, lon sql.NullFloat64
+		if err := rows.Scan(&stop.Id, &stop.Name, &stop.Coverage, &stop.Uic, &stop.City, &stop.Timezone, &lat, &lon); err != nil {
+			return nil, newQueryError("Could not run database query", err)
+		}
+		stop.Coord = stopCoord(lat, lon)
+		stops = append(stops, stop)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	return
+}
+
+func (env *DBEnv) CountStops(ctx context.Context) (i int, err error) {
 	query := `SELECT count(*) from stops;`
-	err = env.db.QueryRow(query).Scan(&i)
+	err = env.db.QueryRowContext(ctx, query).Scan(&i)
 	if err != nil {
 		return 0, newQueryError("Could not run database query: most likely the schema is corrupted", err)
 	}
 	return
 }
 
-func (env *DBEnv) GetStop(id string) (*model.Stop, error) {
-	query := `SELECT name FROM stops WHERE id = $1;`
+// GetStop returns a stop, a stop without timezone gets the one of the most stops of its coverage since navitia
+// expresses the times of a coverage in a single timezone
+func (env *DBEnv) GetStop(ctx context.Context, id string) (*model.Stop, error) {
+	query := `
+		SELECT name, coverage, uic, city,
+			CASE timezone WHEN '' THEN COALESCE((SELECT c.timezone FROM stops c
+				WHERE c.coverage = s.coverage AND c.timezone != ''
+				GROUP BY c.timezone ORDER BY COUNT(*) DESC, c.timezone LIMIT 1), '') ELSE timezone END,
+			lat, lon
+		FROM stops s WHERE id = $1;`
 	stop := model.Stop{Id: id}
-	err := env.db.QueryRow(
+	var lat, lon sql.NullFloat64
+	err := env.db.QueryRowContext(
+		ctx,
 		query,
 		id,
 	).Scan(
 		&stop.Name,
+		&stop.Coverage,
+		&stop.Uic,
+		&stop.City,
+		&stop.Timezone,
+		&lat,
+		&lon,
 	)
 	if err != nil {
 		return nil, newQueryError("Could not run database query", err)
 	}
+	stop.Coord = stopCoord(lat, lon)
 	return &stop, nil
 }
 
-func (env *DBEnv) GetStops() (stops []model.Stop, err error) {
-	query := `SELECT id, name FROM stops;`
-	rows, err := env.db.Query(query)
+// GetStops returns all the stops, ordered by city then name
+func (env *DBEnv) GetStops(ctx context.Context) (stops []model.Stop, err error) {
+	query := `SELECT ` + stopColumns + ` FROM stops ORDER BY city, name;`
+	rows, err := env.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, newQueryError("Could not run database query", err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var stop model.Stop
-		if err := rows.Scan(&stop.Id, &stop.Name); err != nil {
-			return nil, newQueryError("Could not run database query", err)
-		}
-		stops = append(stops, stop)
+	return scanStops(rows)
+}
+
+// GetNearbyStops returns the stops closest to a location, with their distance. Stops without coordinates are ignored.
+func (env *DBEnv) GetNearbyStops(ctx context.Context, coord model.Coord, limit int) ([]model.NearbyStop, error) {
+	// sqlite has no trigonometric functions: the candidates are ordered with an equirectangular approximation which
+	// is accurate enough at the scale of a country, then their actual distances are computed
+	query := `
+		SELECT ` + stopColumns + ` FROM stops
+		WHERE lat IS NOT NULL AND lon IS NOT NULL
+		ORDER BY (lat - $1) * (lat - $1) + (lon - $2) * (lon - $2) * $3
+		LIMIT $4;`
+	scale := math.Cos(coord.Lat * math.Pi / 180)
+	rows, err := env.db.QueryContext(ctx, query, coord.Lat, coord.Lon, scale*scale, limit)
+	if err != nil {
+		return nil, newQueryError("Could not run database query", err)
 	}
-	return
+	stops, err := scanStops(rows)
+	if err != nil {
+		return nil, err
+	}
+	nearby := make([]model.NearbyStop, len(stops))
+	for i, stop := range stops {
+		nearby[i] = model.NearbyStop{Stop: stop, Distance: coord.Distance(*stop.Coord)}
+	}
+	sort.SliceStable(nearby, func(i, j int) bool { return nearby[i].Distance < nearby[j].Distance })
+	return nearby, nil
+}
+
+// SearchStops returns the stops whose name contains the query, ignoring accents and case. Exact matches come first,
+// then names starting with the query, then names with a word starting with the query, shorter names first.
+func (env *DBEnv) SearchStops(ctx context.Context, q string, limit int) (stops []model.Stop, err error) {
+	search := normalizeName(q)
+	if search == "" {
+		return nil, nil
+	}
+	query := `
+		SELECT ` + stopColumns + ` FROM stops
+		WHERE search LIKE '%' || $1 || '%'
+		ORDER BY
+			CASE
+				WHEN search = $1 THEN 0
+				WHEN search LIKE $1 || '%' THEN 1
+				WHEN search LIKE '% ' || $1 || '%' THEN 2
+				ELSE 3
+			END,
+			length(name),
+			name
+		LIMIT $2;`
+	rows, err := env.db.QueryContext(ctx, query, search, limit)
+	if err != nil {
+		return nil, newQueryError("Could not run database query", err)
+	}
+	return scanStops(rows)
 }
 
-func (env *DBEnv) ReplaceAndImportStops(stops []model.Stop) error {
+func (env *DBEnv) ReplaceAndImportStops(ctx context.Context, stops []model.Stop) error {
 	pre_query := `DELETE FROM stops;`
 	query := `
 		INSERT INTO stops
-			(id, name)
+			(id, name, coverage, search, uic, city, timezone, lat, lon)
 		VALUES
-			($1, $2);`
-	tx, err := env.db.Begin()
+			($1, $2, $3, $4, $5, $6, $7, $8, $9);`
+	tx, err := env.db.BeginTx(ctx, nil)
 	if err != nil {
 		return newTransactionError("Could not Begin()", err)
 	}
-	_, err = tx.Exec(pre_query)
+	_, err = tx.ExecContext(ctx, pre_query)
 	if err != nil {
 		tx.Rollback()
 		return newQueryError("Could not run database query: most likely the schema is corrupted", err)
 	}
 	for i := 0; i < len(stops); i++ {
-		_, err = tx.Exec(
+		var lat, lon sql.NullFloat64
+		if stops[i].Coord != nil {
+			lat = sql.NullFloat64{Float64: stops[i].Coord.Lat, Valid: true}
+			lon = sql.NullFloat64{Float64: stops[i].Coord.Lon, Valid: true}
+		}
+		_, err = tx.ExecContext(
+			ctx,
 			query,
 			stops[i].Id,
 			stops[i].Name,
+			stops[i].Coverage,
+			normalizeName(stops[i].Name),
+			stops[i].Uic,
+			stops[i].City,
+			stops[i].Timezone,
+			lat,
+			lon,
 		)
 		if err != nil {
 			tx.Rollback()
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -11,82 +12,216 @@ import (
 
 func TestCountStops(t *testing.T) {
 	stops := []model.Stop{
-		model.Stop{Id: "id1", Name: "name1"},
-		model.Stop{Id: "id2", Name: "name2"},
+		model.Stop{Id: "id1", Name: "name1", Coverage: "sncf"},
+		model.Stop{Id: "id2", Name: "name2", Coverage: "fr-se"},
 	}
 	// test db setup
 	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.NoError(t, err)
 	// check sql error
-	i, err := db.CountStops()
+	i, err := db.CountStops(context.Background())
 	require.Error(t, err)
 	requireErrorTypeMatch(t, err, QueryError{})
 	// normal check
-	err = db.Migrate()
+	err = db.Migrate(context.Background())
 	require.NoError(t, err)
-	err = db.ReplaceAndImportStops(stops)
-	i, err = db.CountStops()
+	err = db.ReplaceAndImportStops(context.Background(), stops)
+	i, err = db.CountStops(context.Background())
 	require.NoError(t, err)
 	require.Equal(t, i, len(stops))
 }
 
 func TestGetStop(t *testing.T) {
 	stops := []model.Stop{
-		model.Stop{Id: "id1", Name: "name1"},
-		model.Stop{Id: "id2", Name: "name2"},
+		model.Stop{Id: "id1", Name: "name1", Coverage: "sncf", Uic: "87313759", City: "Abancourt (60220)", Timezone: "Europe/Paris"},
+		model.Stop{Id: "id2", Name: "name2", Coverage: "fr-se"},
+		model.Stop{Id: "id3", Name: "name3", Coverage: "sncf"},
 	}
 	// test db setup
 	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.NoError(t, err)
-	err = db.Migrate()
+	err = db.Migrate(context.Background())
 	require.NoError(t, err)
-	err = db.ReplaceAndImportStops(stops)
+	err = db.ReplaceAndImportStops(context.Background(), stops)
 	// normal check
-	stop, err := db.GetStop("id1")
+	stop, err := db.GetStop(context.Background(), "id1")
 	require.NoError(t, err)
 	require.Equal(t, stop, &stops[0])
+	// a stop without timezone gets the one of its coverage, when known
+	stop, err = db.GetStop(context.Background(), "id3")
+	require.NoError(t, err)
+	require.Equal(t, "Europe/Paris", stop.Timezone)
+	stop, err = db.GetStop(context.Background(), "id2")
+	require.NoError(t, err)
+	require.Equal(t, "", stop.Timezone)
 	// error check
-	stop, err = db.GetStop("non_existent")
+	stop, err = db.GetStop(context.Background(), "non_existent")
 	require.Error(t, err)
 	requireErrorTypeMatch(t, err, QueryError{})
 }
 
 func TestGetStops(t *testing.T) {
 	stops := []model.Stop{
-		model.Stop{Id: "id1", Name: "name1"},
-		model.Stop{Id: "id2", Name: "name2"},
+		model.Stop{Id: "id3", Name: "name3", Uic: "87313759", City: "Abancourt (60220)", Timezone: "Europe/Paris"},
+		model.Stop{Id: "id1", Name: "name1", City: "Lyon"},
+		model.Stop{Id: "id4", Name: "name0", City: "Lyon"},
 	}
 	// test db setup
 	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.NoError(t, err)
 	// error check
-	res, err := db.GetStops()
+	res, err := db.GetStops(context.Background())
 	require.Error(t, err)
 	requireErrorTypeMatch(t, err, QueryError{})
 	// normal check
-	err = db.Migrate()
+	err = db.Migrate(context.Background())
 	require.NoError(t, err)
-	err = db.ReplaceAndImportStops(stops)
-	res, err = db.GetStops()
+	err = db.ReplaceAndImportStops(context.Background(), stops)
+	res, err = db.GetStops(context.Background())
 	require.NoError(t, err)
-	require.Equal(t, res, stops)
+	// ordered by city then name
+	require.Equal(t, res, []model.Stop{stops[0], stops[2], stops[1]})
 }
 
 func TestGetStopsWithSQLMock(t *testing.T) {
 	// Transaction commit error
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err, "an error '%s' was not expected when opening a stub database connection", err)
-	mock.ExpectQuery(`SELECT id, name FROM stops;`).WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(nil, "b").RowError(1, fmt.Errorf("row error")))
-	_, err = (&DBEnv{db: db}).GetStops()
+	mock.ExpectQuery(`SELECT id, name, coverage, uic, city, timezone, lat, lon FROM stops ORDER BY city, name;`).WillReturnRows(sqlmock.NewRows([]string{"id", "name", "coverage", "uic", "city", "timezone", "lat", "lon"}).AddRow("a", "b", "sncf", "", "", "", nil, nil).RowError(0, fmt.Errorf("row error")))
+	_, err = (&DBEnv{db: db}).GetStops(context.Background())
 	require.Error(t, err)
 	requireErrorTypeMatch(t, err, QueryError{})
 }
 
+func TestStopsCancellation(t *testing.T) {
+	stops := []model.Stop{
+		model.Stop{Id: "id1", Name: "name1"},
+	}
+	// test db setup
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	err = db.ReplaceAndImportStops(context.Background(), stops)
+	require.NoError(t, err)
+	// a cancelled context should abort queries and transactions
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = db.GetStops(ctx)
+	requireErrorTypeMatch(t, err, QueryError{})
+	require.ErrorIs(t, err, context.Canceled)
+	err = db.ReplaceAndImportStops(ctx, nil)
+	requireErrorTypeMatch(t, err, TransactionError{})
+	require.ErrorIs(t, err, context.Canceled)
+	res, err := db.GetStops(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, stops, res)
+}
+
+func TestGetNearbyStops(t *testing.T) {
+	stops := []model.Stop{
+		model.Stop{Id: "perrache", Name: "Lyon Perrache", Coverage: "sncf", Coord: &model.Coord{Lat: 45.748439, Lon: 4.825781}},
+		model.Stop{Id: "part-dieu", Name: "Lyon Part-Dieu", Coverage: "sncf", Coord: &model.Coord{Lat: 45.760593, Lon: 4.859666}},
+		model.Stop{Id: "unknown", Name: "Unknown", Coverage: "sncf"},
+		model.Stop{Id: "paris", Name: "Paris Gare de Lyon", Coverage: "sncf", Coord: &model.Coord{Lat: 48.844888, Lon: 2.373483}},
+		model.Stop{Id: "vaise", Name: "Lyon Vaise", Coverage: "sncf", Coord: &model.Coord{Lat: 45.780163, Lon: 4.804275}},
+	}
+	// test db setup
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	bellecour := model.Coord{Lat: 45.757814, Lon: 4.832011}
+	// error check
+	_, err = db.GetNearbyStops(context.Background(), bellecour, 3)
+	requireErrorTypeMatch(t, err, QueryError{})
+	// normal check
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	err = db.ReplaceAndImportStops(context.Background(), stops)
+	require.NoError(t, err)
+	stop, err := db.GetStop(context.Background(), "perrache")
+	require.NoError(t, err)
+	require.Equal(t, &stops[0], stop)
+	res, err := db.GetNearbyStops(context.Background(), bellecour, 3)
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	require.Equal(t, stops[0], res[0].Stop)
+	require.Equal(t, stops[1], res[1].Stop)
+	require.Equal(t, stops[4], res[2].Stop)
+	require.InDelta(t, 1149, res[0].Distance, 1)
+	require.InDelta(t, 2168, res[1].Distance, 1)
+	require.InDelta(t, 3287, res[2].Distance, 1)
+	// stops without coordinates are never returned
+	res, err = db.GetNearbyStops(context.Background(), model.Coord{Lat: 48.8566, Lon: 2.3522}, 10)
+	require.NoError(t, err)
+	require.Len(t, res, 4)
+	require.Equal(t, "paris", res[0].Id)
+	require.Equal(t, "part-dieu", res[3].Id)
+	require.InDelta(t, 392701, res[3].Distance, 1)
+}
+
+func TestSearchStops(t *testing.T) {
+	stops := []model.Stop{
+		model.Stop{Id: "id1", Name: "Saint-Étienne Châteaucreux", Coverage: "sncf"},
+		model.Stop{Id: "id2", Name: "Saint-Étienne", Coverage: "sncf"},
+		model.Stop{Id: "id3", Name: "Firminy Saint-Étienne Bellevue", Coverage: "fr-se"},
+		model.Stop{Id: "id4", Name: "Lyon Part-Dieu", Coverage: "sncf"},
+		model.Stop{Id: "id5", Name: "Gare de Saint-Étienne-la-Varenne", Coverage: "sncf"},
+		model.Stop{Id: "id6", Name: "Quint", Coverage: "sncf"},
+	}
+	// test db setup
+	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	// error check
+	_, err = db.SearchStops(context.Background(), "lyon", 10)
+	requireErrorTypeMatch(t, err, QueryError{})
+	// normal check
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	err = db.ReplaceAndImportStops(context.Background(), stops)
+	require.NoError(t, err)
+	testCases := []struct {
+		name     string
+		query    string
+		limit    int
+		expected []model.Stop
+	}{
+		{"an empty query matches nothing", " - ", 10, nil},
+		{"no match", "marseille", 10, nil},
+		{"accents and case are ignored", "SAINT-ETIENNE", 10, []model.Stop{stops[1], stops[0], stops[2], stops[4]}},
+		{"results are limited", "saint etienne", 2, []model.Stop{stops[1], stops[0]}},
+		{"word prefixes rank before substrings", "chateau", 10, []model.Stop{stops[0]}},
+		{"substrings also match", "int", 10, []model.Stop{stops[5], stops[1], stops[0], stops[2], stops[4]}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := db.SearchStops(context.Background(), tc.query, tc.limit)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, res)
+		})
+	}
+	// stops imported before the search column existed are searchable after the migration
+	db, err = InitDB("sqlite3", "file::memory:?_foreign_keys=on")
+	require.NoError(t, err)
+	migrations = allMigrations[:5]
+	err = db.Migrate(context.Background())
+	require.NoError(t, err)
+	_, err = db.db.Exec(`INSERT INTO stops (id, name) VALUES ('id1', 'Saint-Étienne Châteaucreux');`)
+	require.NoError(t, err)
+	migrations = allMigrations[:6]
+	err = db.Migrate(context.Background())
+	migrations = allMigrations
+	require.NoError(t, err)
+	var search string
+	err = db.db.QueryRow(`SELECT search FROM stops WHERE id = 'id1';`).Scan(&search)
+	require.NoError(t, err)
+	require.Equal(t, "saint etienne chateaucreux", search)
+}
+
 func TestReplaceAndImportStops(t *testing.T) {
 	// test db setup
 	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.NoError(t, err)
-	err = db.Migrate()
+	err = db.Migrate(context.Background())
 	require.NoError(t, err)
 	// datasets
 	data1 := []model.Stop{
@@ -108,7 +243,7 @@ func TestReplaceAndImportStops(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := db.ReplaceAndImportStops(tc.input)
+			err := db.ReplaceAndImportStops(context.Background(), tc.input)
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -161,7 +296,7 @@ func TestReplaceAndImportStopsWithSQLMock(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			err := tc.db.ReplaceAndImportStops(data1)
+			err := tc.db.ReplaceAndImportStops(context.Background(), data1)
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
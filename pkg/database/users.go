@@ -1,12 +1,14 @@
 package database
 
 import (
+	"context"
+
 	"git.adyxax.org/adyxax/trains/pkg/model"
 )
 
 // Creates a new user in the database
 // a QueryError is return if the username already exists (database constraints not met)
-func (env *DBEnv) CreateUser(reg *model.UserRegistration) (*model.User, error) {
+func (env *DBEnv) CreateUser(ctx context.Context, reg *model.UserRegistration) (*model.User, error) {
 	hash, err := hashPassword(reg.Password)
 	if err != nil {
 		return nil, err
@@ -16,11 +18,12 @@ func (env *DBEnv) CreateUser(reg *model.UserRegistration) (*model.User, error) {
 			(username, hash, email)
 		VALUES
 			($1, $2, $3);`
-	tx, err := env.db.Begin()
+	tx, err := env.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, newTransactionError("Could not Begin()", err)
 	}
-	result, err := tx.Exec(
+	result, err := tx.ExecContext(
+		ctx,
 		query,
 		reg.Username,
 		hash,
@@ -49,11 +52,12 @@ func (env *DBEnv) CreateUser(reg *model.UserRegistration) (*model.User, error) {
 // Login logs a user in if the password matches the hash in database
 // a PasswordError is return if the passwords do not match
 // a QueryError is returned if the username contains invalid sql characters like %
-func (env *DBEnv) Login(login *model.UserLogin) (*model.User, error) {
+func (env *DBEnv) Login(ctx context.Context, login *model.UserLogin) (*model.User, error) {
 	query := `SELECT id, hash, email FROM users WHERE username = $1;`
 	user := model.User{Username: login.Username}
 	var hash string
-	err := env.db.QueryRow(
+	err := env.db.QueryRowContext(
+		ctx,
 		query,
 		login.Username,
 	).Scan(
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"testing"
 
 	"git.adyxax.org/adyxax/trains/pkg/model"
@@ -13,7 +14,7 @@ func TestCreateUser(t *testing.T) {
 	// test db setup
 	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.NoError(t, err)
-	err = db.Migrate()
+	err = db.Migrate(context.Background())
 	require.NoError(t, err)
 	// a normal user
 	normalUser := model.UserRegistration{
@@ -40,7 +41,7 @@ func TestCreateUser(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			valid, err := db.CreateUser(tc.input)
+			valid, err := db.CreateUser(context.Background(), tc.input)
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -53,7 +54,7 @@ func TestCreateUser(t *testing.T) {
 	}
 	// Test for bad password
 	passwordFunction = func(password []byte, cost int) ([]byte, error) { return nil, newPasswordError(nil) }
-	valid, err := db.CreateUser(&normalUser)
+	valid, err := db.CreateUser(context.Background(), &normalUser)
 	passwordFunction = bcrypt.GenerateFromPassword
 	require.Error(t, err)
 	require.Nil(t, valid)
@@ -89,7 +90,7 @@ func TestCreateUserWithSQLMock(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			valid, err := tc.db.CreateUser(&model.UserRegistration{})
+			valid, err := tc.db.CreateUser(context.Background(), &model.UserRegistration{})
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -115,11 +116,11 @@ func TestLogin(t *testing.T) {
 	// test db setup
 	db, err := InitDB("sqlite3", "file::memory:?_foreign_keys=on")
 	require.NoError(t, err)
-	err = db.Migrate()
+	err = db.Migrate(context.Background())
 	require.NoError(t, err)
-	_, err = db.CreateUser(&user1)
+	_, err = db.CreateUser(context.Background(), &user1)
 	require.NoError(t, err)
-	_, err = db.CreateUser(&user2)
+	_, err = db.CreateUser(context.Background(), &user2)
 	require.NoError(t, err)
 	// successful logins
 	loginUser1 := model.UserLogin{
@@ -152,7 +153,7 @@ func TestLogin(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			valid, err := db.Login(tc.input)
+			valid, err := db.Login(context.Background(), tc.input)
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -0,0 +1,273 @@
+package gtfs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
+)
+
+// stopAreaPrefix makes GTFS station ids look like the navitia stop area ids the webui expects
+const stopAreaPrefix = "stop_area:"
+
+// defaultCount is the number of departures returned when the options do not say, like navitia does
+const defaultCount = 10
+
+// horizon is how far departures are looked up when the options set no window
+const horizon = 24 * time.Hour
+
+// maxTransfers is the number of transfers allowed in a journey when the options do not say, like navitia does
+const maxTransfers = 10
+
+// maxTimetables is the number of days whose journey timetables are kept in memory
+const maxTimetables = 2
+
+// Store is where the feed was imported
+type Store interface {
+	GetGTFSTimezone(ctx context.Context) (string, error)
+	GetGTFSStations(ctx context.Context) ([]model.Stop, error)
+	// GetGTFSDepartures returns the departures from a station of the trips running on a service day, between two
+	// times relative to noon minus 12h of that day. A negative limit means no limit.
+	GetGTFSDepartures(ctx context.Context, station string, day time.Time, from time.Duration, to time.Duration, limit int) ([]ScheduledDeparture, error)
+	// GetGTFSTrips returns the trips running on a service day
+	GetGTFSTrips(ctx context.Context, day time.Time) ([]ScheduledTrip, error)
+}
+
+// A ScheduledDeparture is a departure of the static schedule, along with what identifies it in real-time feeds
+type ScheduledDeparture struct {
+	Departure    model.Departure
+	TripId       string
+	StopId       string
+	StopSequence int
+	// ServiceDay is the service day of the trip, like 20210503
+	ServiceDay string
+}
+
+// A ScheduledTrip is a trip of the static schedule running on a service day
+type ScheduledTrip struct {
+	TripId         string
+	TrainNumber    string
+	CommercialMode string
+	Line           string
+	// StopTimes are in sequence order, their stop ids are the ones of the stations
+	StopTimes []StopTime
+}
+
+// Client answers the queries of the webui from a GTFS feed imported in the database instead of the navitia api. Only
+// stops, departures and journeys are known from such a feed, the other methods return a NotSupportedError.
+type Client struct {
+	store        Store
+	realtime     Realtime
+	transferTime time.Duration
+
+	mutex sync.Mutex
+	// timetables are indexed by the day of the journeys they were built for
+	timetables map[string]*timetable
+}
+
+// NewClient returns a client reading the GTFS feed imported in store, realtime can be nil to only use the schedule.
+// Journeys leave at least transferTime to change trains.
+func NewClient(store Store, realtime Realtime, transferTime time.Duration) *Client {
+	return &Client{
+		store:        store,
+		realtime:     realtime,
+		transferTime: transferTime,
+		timetables:   make(map[string]*timetable),
+	}
+}
+
+// location returns the timezone of the feed
+func (c *Client) location(ctx context.Context) (*time.Location, error) {
+	tz, err := c.store.GetGTFSTimezone(ctx)
+	if err != nil {
+		return nil, newStoreError("GetGTFSTimezone", err)
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, newStoreError("LoadLocation "+tz, err)
+	}
+	return loc, nil
+}
+
+// GetStops returns the stations of the feed along with the stop points that are not part of one
+func (c *Client) GetStops(ctx context.Context) (stops []model.Stop, err error) {
+	stations, err := c.store.GetGTFSStations(ctx)
+	if err != nil {
+		return nil, newStoreError("GetGTFSStations", err)
+	}
+	for _, s := range stations {
+		s.Id = stopAreaPrefix + s.Id
+		stops = append(stops, s)
+	}
+	return stops, nil
+}
+
+// GetDepartures returns the departures from a stop, according to the service calendars of the feed. The coverage
+// is ignored since a feed has none.
+func (c *Client) GetDepartures(ctx context.Context, coverage string, stop string, options navitia_api_client.BoardOptions) (departures []model.Departure, err error) {
+	loc, err := c.location(ctx)
+	if err != nil {
+		return nil, err
+	}
+	from := time.Now().In(loc)
+	if !options.From.IsZero() {
+		from = options.From.In(loc)
+	}
+	end := from.Add(horizon)
+	limit := defaultCount
+	if options.Duration > 0 {
+		end = from.Add(options.Duration)
+		limit = -1
+	}
+	if options.Count > 0 {
+		limit = options.Count
+	}
+	station := strings.TrimPrefix(stop, stopAreaPrefix)
+	// trips of the previous service day can still be running past midnight
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -1)
+	for ; !ServiceTime(day, 0).After(end); day = day.AddDate(0, 0, 1) {
+		base := ServiceTime(day, 0)
+		deps, err := c.store.GetGTFSDepartures(ctx, station, day, from.Sub(base), end.Sub(base), limit)
+		if err != nil {
+			return nil, newStoreError("GetGTFSDepartures "+station, err)
+		}
+		for i := range deps {
+			if c.realtime != nil {
+				if tu, ok := c.realtime.TripUpdate(deps[i].TripId, deps[i].ServiceDay); ok {
+					tu.apply(&deps[i])
+				}
+			}
+			departures = append(departures, deps[i].Departure)
+		}
+	}
+	// like on station boards, delayed trains keep their place
+	sort.SliceStable(departures, func(i, j int) bool {
+		return departures[i].BaseDeparture.Before(departures[j].BaseDeparture)
+	})
+	if limit >= 0 && len(departures) > limit {
+		departures = departures[:limit]
+	}
+	return departures, nil
+}
+
+func (c *Client) GetArrivals(ctx context.Context, coverage string, stop string, options navitia_api_client.BoardOptions) (arrivals []model.Arrival, err error) {
+	return nil, newNotSupportedError("GetArrivals")
+}
+
+// GetJourneys returns the journeys arriving the earliest when leaving a station at datetime, computed with the RAPTOR
+// algorithm over the schedule. The coverage is ignored and only departure times are supported.
+func (c *Client) GetJourneys(ctx context.Context, coverage string, from string, to string, datetime time.Time, options navitia_api_client.JourneyOptions) (journeys []model.Journey, err error) {
+	if options.ArrivalBy {
+		return nil, newNotSupportedError("GetJourneys arriving by")
+	}
+	loc, err := c.location(ctx)
+	if err != nil {
+		return nil, err
+	}
+	datetime = datetime.In(loc)
+	tt, err := c.timetable(ctx, datetime)
+	if err != nil {
+		return nil, err
+	}
+	fromIndex, ok := tt.index[strings.TrimPrefix(from, stopAreaPrefix)]
+	toIndex, ok2 := tt.index[strings.TrimPrefix(to, stopAreaPrefix)]
+	if !ok || !ok2 || fromIndex == toIndex {
+		return nil, nil
+	}
+	maxTrips := maxTransfers + 1
+	if options.MaxTransfers != nil && *options.MaxTransfers >= 0 {
+		maxTrips = *options.MaxTransfers + 1
+	}
+	// a query only returns the fastest journeys, later ones are found by leaving after the first of them
+	found := make(map[string]bool)
+	for departure := datetime.Unix(); ; {
+		results := tt.journeys(fromIndex, toIndex, departure, maxTrips, int64(c.transferTime/time.Second))
+		if len(results) == 0 {
+			break
+		}
+		next := int64(never)
+		for _, legs := range results {
+			if first := legs[0].trip.departures[legs[0].board]; first < next {
+				next = first
+			}
+			var key strings.Builder
+			for _, l := range legs {
+				fmt.Fprintf(&key, "%p:%d:%d,", l.trip, l.board, l.alight)
+			}
+			if !found[key.String()] {
+				found[key.String()] = true
+				journeys = append(journeys, tt.journey(legs, loc, c.transferTime))
+			}
+		}
+		if options.Count <= 0 || len(journeys) >= options.Count {
+			break
+		}
+		departure = next + 1
+	}
+	sort.SliceStable(journeys, func(i, j int) bool {
+		if journeys[i].Departure.Equal(journeys[j].Departure) {
+			return journeys[i].Arrival.Before(journeys[j].Arrival)
+		}
+		return journeys[i].Departure.Before(journeys[j].Departure)
+	})
+	if options.Count > 0 && len(journeys) > options.Count {
+		journeys = journeys[:options.Count]
+	}
+	return journeys, nil
+}
+
+// timetable returns the timetable of the journeys leaving on the day of datetime. It holds the trips of the previous
+// service day still running past midnight, and those of the next one for the journeys arriving after midnight.
+func (c *Client) timetable(ctx context.Context, datetime time.Time) (*timetable, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := datetime.Format(dateLayout)
+	if tt, ok := c.timetables[key]; ok {
+		return tt, nil
+	}
+	stations, err := c.store.GetGTFSStations(ctx)
+	if err != nil {
+		return nil, newStoreError("GetGTFSStations", err)
+	}
+	tt := newTimetable(stations)
+	day := time.Date(datetime.Year(), datetime.Month(), datetime.Day(), 0, 0, 0, 0, datetime.Location())
+	for i := -1; i <= 1; i++ {
+		d := day.AddDate(0, 0, i)
+		trips, err := c.store.GetGTFSTrips(ctx, d)
+		if err != nil {
+			return nil, newStoreError("GetGTFSTrips "+d.Format(dateLayout), err)
+		}
+		tt.addTrips(d, trips)
+	}
+	tt.build()
+	if len(c.timetables) >= maxTimetables {
+		c.timetables = make(map[string]*timetable)
+	}
+	c.timetables[key] = tt
+	return tt, nil
+}
+
+func (c *Client) GetLines(ctx context.Context, coverage string, stop string) (lines []model.Line, err error) {
+	return nil, newNotSupportedError("GetLines")
+}
+
+func (c *Client) GetPlaces(ctx context.Context, coverage string, q string) (stops []model.Stop, err error) {
+	return nil, newNotSupportedError("GetPlaces")
+}
+
+func (c *Client) GetRoutes(ctx context.Context, coverage string, line string) (routes []model.Route, err error) {
+	return nil, newNotSupportedError("GetRoutes")
+}
+
+func (c *Client) GetStopSchedules(ctx context.Context, coverage string, stop string, date time.Time) (schedules []model.Schedule, err error) {
+	return nil, newNotSupportedError("GetStopSchedules")
+}
+
+func (c *Client) GetVehicleJourney(ctx context.Context, coverage string, id string, date time.Time) (vj *model.VehicleJourney, err error) {
+	return nil, newNotSupportedError("GetVehicleJourney")
+}
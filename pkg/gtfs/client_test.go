@@ -0,0 +1,211 @@
+package gtfs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"git.adyxax.org/adyxax/trains/pkg/navitia_api_client"
+	"github.com/stretchr/testify/require"
+)
+
+// departuresQuery records the arguments of a GetGTFSDepartures call
+type departuresQuery struct {
+	station string
+	day     string
+	from    time.Duration
+	to      time.Duration
+	limit   int
+}
+
+// testStore runs the same trips every service day
+type testStore struct {
+	timezone string
+	stations []model.Stop
+	times    []time.Duration
+	queries  []departuresQuery
+	trips    []ScheduledTrip
+	tripDays []string
+	err      error
+}
+
+func (s *testStore) GetGTFSTimezone(ctx context.Context) (string, error) {
+	return s.timezone, s.err
+}
+
+func (s *testStore) GetGTFSStations(ctx context.Context) ([]model.Stop, error) {
+	return s.stations, s.err
+}
+
+func (s *testStore) GetGTFSDepartures(ctx context.Context, station string, day time.Time, from time.Duration, to time.Duration, limit int) (departures []ScheduledDeparture, err error) {
+	s.queries = append(s.queries, departuresQuery{station, day.Format(dateLayout), from, to, limit})
+	for _, t := range s.times {
+		if t >= from && t < to && (limit < 0 || len(departures) < limit) {
+			departures = append(departures, ScheduledDeparture{
+				Departure:  model.Departure{TrainNumber: fmt.Sprintf("%s+%s", day.Format(dateLayout), t), BaseDeparture: ServiceTime(day, t), Departure: ServiceTime(day, t)},
+				TripId:     t.String(),
+				ServiceDay: day.Format(dateLayout),
+			})
+		}
+	}
+	return
+}
+
+func (s *testStore) GetGTFSTrips(ctx context.Context, day time.Time) ([]ScheduledTrip, error) {
+	s.tripDays = append(s.tripDays, day.Format(dateLayout))
+	return s.trips, s.err
+}
+
+func TestGetStops(t *testing.T) {
+	store := &testStore{stations: []model.Stop{model.Stop{Id: "StopArea:OCE87723502", Name: "Crépieux-la-Pape", Timezone: "Europe/Paris"}}}
+	stops, err := NewClient(store, nil, 0).GetStops(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []model.Stop{model.Stop{Id: "stop_area:StopArea:OCE87723502", Name: "Crépieux-la-Pape", Timezone: "Europe/Paris"}}, stops)
+	store.err = fmt.Errorf("database error")
+	_, err = NewClient(store, nil, 0).GetStops(context.Background())
+	requireErrorTypeMatch(t, err, StoreError{})
+}
+
+func TestGetDepartures(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	from := time.Date(2021, time.May, 3, 23, 0, 0, 0, paris)
+	testCases := []struct {
+		name            string
+		options         navitia_api_client.BoardOptions
+		expected        []string
+		expectedQueries []departuresQuery
+	}{
+		{"count", navitia_api_client.BoardOptions{From: from, Count: 3}, []string{"20210503+23h50m0s", "20210502+48h5m0s", "20210503+24h5m0s"}, []departuresQuery{
+			departuresQuery{"StopArea:OCE87723502", "20210502", 47 * time.Hour, 71 * time.Hour, 3},
+			departuresQuery{"StopArea:OCE87723502", "20210503", 23 * time.Hour, 47 * time.Hour, 3},
+			departuresQuery{"StopArea:OCE87723502", "20210504", -time.Hour, 23 * time.Hour, 3},
+		}},
+		{"default count", navitia_api_client.BoardOptions{From: from}, []string{"20210503+23h50m0s", "20210502+48h5m0s", "20210503+24h5m0s", "20210504+13h18m0s"}, []departuresQuery{
+			departuresQuery{"StopArea:OCE87723502", "20210502", 47 * time.Hour, 71 * time.Hour, 10},
+			departuresQuery{"StopArea:OCE87723502", "20210503", 23 * time.Hour, 47 * time.Hour, 10},
+			departuresQuery{"StopArea:OCE87723502", "20210504", -time.Hour, 23 * time.Hour, 10},
+		}},
+		{"window", navitia_api_client.BoardOptions{From: from, Duration: time.Hour}, []string{"20210503+23h50m0s"}, []departuresQuery{
+			departuresQuery{"StopArea:OCE87723502", "20210502", 47 * time.Hour, 48 * time.Hour, -1},
+			departuresQuery{"StopArea:OCE87723502", "20210503", 23 * time.Hour, 24 * time.Hour, -1},
+			departuresQuery{"StopArea:OCE87723502", "20210504", -time.Hour, 0, -1},
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &testStore{
+				timezone: "Europe/Paris",
+				times:    []time.Duration{13*time.Hour + 18*time.Minute, 23*time.Hour + 50*time.Minute, 24*time.Hour + 5*time.Minute, 48*time.Hour + 5*time.Minute},
+			}
+			departures, err := NewClient(store, nil, 0).GetDepartures(context.Background(), "", "stop_area:StopArea:OCE87723502", tc.options)
+			require.NoError(t, err)
+			var trains []string
+			for _, d := range departures {
+				trains = append(trains, d.TrainNumber)
+			}
+			require.Equal(t, tc.expected, trains)
+			require.Equal(t, tc.expectedQueries, store.queries)
+		})
+	}
+}
+
+func TestGetDeparturesRealtime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	store := &testStore{timezone: "Europe/Paris", times: []time.Duration{13*time.Hour + 8*time.Minute, 13*time.Hour + 18*time.Minute}}
+	realtime := newTestPoller("test_data/trip-updates.pb")
+	require.NoError(t, realtime.Poll(context.Background()))
+	// the test store names its trips after their departure time
+	realtime.updates[tripKey("13h8m0s", "20210503")] = realtime.updates[tripKey("OCESN886823F0100110", "20210503")]
+	realtime.updates[tripKey("13h18m0s", "20210503")] = realtime.updates[tripKey("OCESN886899F0300330", "20210503")]
+	departures, err := NewClient(store, realtime, 0).GetDepartures(context.Background(), "", "stop_area:StopArea:OCE87723197", navitia_api_client.BoardOptions{
+		From:     time.Date(2021, time.May, 3, 13, 0, 0, 0, paris),
+		Duration: time.Hour,
+	})
+	require.NoError(t, err)
+	require.Len(t, departures, 2)
+	require.True(t, departures[0].RealTime)
+	require.Equal(t, 5*time.Minute, departures[0].Delay)
+	require.True(t, time.Date(2021, time.May, 3, 13, 13, 0, 0, paris).Equal(departures[0].Departure))
+	require.True(t, departures[1].Cancelled)
+}
+
+func TestGetDeparturesErrors(t *testing.T) {
+	store := &testStore{timezone: "Europe/Paris", err: fmt.Errorf("database error")}
+	_, err := NewClient(store, nil, 0).GetDepartures(context.Background(), "", "stop_area:StopArea:OCE87723502", navitia_api_client.BoardOptions{})
+	requireErrorTypeMatch(t, err, StoreError{})
+	store = &testStore{timezone: "Mars/Olympus_Mons"}
+	_, err = NewClient(store, nil, 0).GetDepartures(context.Background(), "", "stop_area:StopArea:OCE87723502", navitia_api_client.BoardOptions{})
+	requireErrorTypeMatch(t, err, StoreError{})
+}
+
+func TestGetJourneys(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	store := &testStore{timezone: "Europe/Paris", stations: testStations, trips: testTrips()}
+	client := NewClient(store, nil, 5*time.Minute)
+	ctx := context.Background()
+	datetime := time.Date(2021, time.May, 3, 7, 50, 0, 0, paris)
+	// the fastest journeys for every number of transfers
+	journeys, err := client.GetJourneys(ctx, "", "stop_area:A", "stop_area:D", datetime, navitia_api_client.JourneyOptions{})
+	require.NoError(t, err)
+	require.Len(t, journeys, 2)
+	require.Equal(t, "slow", journeys[0].Sections[0].TrainNumber)
+	require.Equal(t, 0, journeys[0].NbTransfers)
+	require.Equal(t, 1, journeys[1].NbTransfers)
+	require.True(t, time.Date(2021, time.May, 3, 9, 0, 0, 0, paris).Equal(journeys[1].Arrival))
+	require.Equal(t, []string{"20210502", "20210503", "20210504"}, store.tripDays)
+	// later journeys are found by leaving after the first ones, up to the trains of the next day
+	journeys, err = client.GetJourneys(ctx, "", "stop_area:A", "stop_area:D", datetime, navitia_api_client.JourneyOptions{Count: 3})
+	require.NoError(t, err)
+	require.Len(t, journeys, 3)
+	require.True(t, time.Date(2021, time.May, 3, 8, 0, 0, 0, paris).Equal(journeys[0].Departure))
+	require.True(t, time.Date(2021, time.May, 3, 8, 5, 0, 0, paris).Equal(journeys[1].Departure))
+	require.True(t, time.Date(2021, time.May, 4, 8, 0, 0, 0, paris).Equal(journeys[2].Departure))
+	journeys, err = client.GetJourneys(ctx, "", "stop_area:A", "stop_area:D", datetime, navitia_api_client.JourneyOptions{Count: 1})
+	require.NoError(t, err)
+	require.Len(t, journeys, 1)
+	require.Equal(t, "slow", journeys[0].Sections[0].TrainNumber)
+	// direct trains only
+	maxTransfers := 0
+	journeys, err = client.GetJourneys(ctx, "", "stop_area:A", "stop_area:D", datetime, navitia_api_client.JourneyOptions{MaxTransfers: &maxTransfers})
+	require.NoError(t, err)
+	require.Len(t, journeys, 1)
+	require.Equal(t, "slow", journeys[0].Sections[0].TrainNumber)
+	require.Equal(t, 0, journeys[0].NbTransfers)
+	// the timetable of the day is only built once
+	require.Len(t, store.tripDays, 3)
+	journeys, err = client.GetJourneys(ctx, "", "stop_area:A", "stop_area:unknown", datetime, navitia_api_client.JourneyOptions{})
+	require.NoError(t, err)
+	require.Empty(t, journeys)
+	journeys, err = client.GetJourneys(ctx, "", "stop_area:A", "stop_area:A", datetime, navitia_api_client.JourneyOptions{})
+	require.NoError(t, err)
+	require.Empty(t, journeys)
+	store.err = fmt.Errorf("database error")
+	_, err = client.GetJourneys(ctx, "", "stop_area:A", "stop_area:D", datetime, navitia_api_client.JourneyOptions{})
+	requireErrorTypeMatch(t, err, StoreError{})
+	_, err = NewClient(&testStore{timezone: "Europe/Paris", err: fmt.Errorf("database error")}, nil, 0).timetable(ctx, datetime)
+	requireErrorTypeMatch(t, err, StoreError{})
+}
+
+func TestNotSupported(t *testing.T) {
+	client := NewClient(&testStore{}, nil, 0)
+	ctx := context.Background()
+	_, err := client.GetArrivals(ctx, "", "stop_area:StopArea:OCE87723502", navitia_api_client.BoardOptions{})
+	requireErrorTypeMatch(t, err, NotSupportedError{})
+	_, err = client.GetJourneys(ctx, "", "stop_area:StopArea:OCE87723197", "stop_area:StopArea:OCE87723502", time.Now(), navitia_api_client.JourneyOptions{ArrivalBy: true})
+	requireErrorTypeMatch(t, err, NotSupportedError{})
+	_, err = client.GetLines(ctx, "", "stop_area:StopArea:OCE87723502")
+	requireErrorTypeMatch(t, err, NotSupportedError{})
+	_, err = client.GetPlaces(ctx, "", "crepieux")
+	requireErrorTypeMatch(t, err, NotSupportedError{})
+	_, err = client.GetRoutes(ctx, "", "OCE1506105")
+	requireErrorTypeMatch(t, err, NotSupportedError{})
+	_, err = client.GetStopSchedules(ctx, "", "stop_area:StopArea:OCE87723502", time.Now())
+	requireErrorTypeMatch(t, err, NotSupportedError{})
+	_, err = client.GetVehicleJourney(ctx, "", "OCESN886823F0100110", time.Now())
+	requireErrorTypeMatch(t, err, NotSupportedError{})
+}
@@ -0,0 +1,119 @@
+package gtfs
+
+import (
+	"fmt"
+)
+
+// gtfs archive opening error
+type OpenError struct {
+	path string
+	err  error
+}
+
+func (e OpenError) Error() string { return fmt.Sprintf("Could not open gtfs archive %s", e.path) }
+func (e OpenError) Unwrap() error { return e.err }
+
+func newOpenError(path string, err error) error {
+	return OpenError{
+		path: path,
+		err:  err,
+	}
+}
+
+// missing gtfs file error
+type MissingFileError struct {
+	name string
+}
+
+func (e MissingFileError) Error() string { return fmt.Sprintf("Missing gtfs file %s", e.name) }
+
+func newMissingFileError(name string) error {
+	return MissingFileError{
+		name: name,
+	}
+}
+
+// gtfs file parsing error
+type ParseError struct {
+	file  string
+	line  int
+	field string
+	err   error
+}
+
+func (e ParseError) Error() string {
+	return fmt.Sprintf("Could not parse gtfs file %s line %d field %s : %+v", e.file, e.line, e.field, e.err)
+}
+func (e ParseError) Unwrap() error { return e.err }
+
+func newParseError(file string, line int, field string, err error) error {
+	return ParseError{
+		file:  file,
+		line:  line,
+		field: field,
+		err:   err,
+	}
+}
+
+// unsupported client method error
+type NotSupportedError struct {
+	method string
+}
+
+func (e NotSupportedError) Error() string {
+	return fmt.Sprintf("%s is not supported by the gtfs backend", e.method)
+}
+
+func newNotSupportedError(method string) error {
+	return NotSupportedError{
+		method: method,
+	}
+}
+
+// gtfs store error
+type StoreError struct {
+	msg string
+	err error
+}
+
+func (e StoreError) Error() string { return fmt.Sprintf("Gtfs store error %s : %+v", e.msg, e.err) }
+func (e StoreError) Unwrap() error { return e.err }
+
+func newStoreError(msg string, err error) error {
+	return StoreError{
+		msg: msg,
+		err: err,
+	}
+}
+
+// gtfs-rt protobuf decoding error
+type DecodeError struct {
+	err error
+}
+
+func (e DecodeError) Error() string { return fmt.Sprintf("Could not decode gtfs-rt feed : %+v", e.err) }
+func (e DecodeError) Unwrap() error { return e.err }
+
+func newDecodeError(err error) error {
+	return DecodeError{
+		err: err,
+	}
+}
+
+// gtfs-rt feed fetching error
+type FetchError struct {
+	source string
+	err    error
+}
+
+func (e FetchError) Error() string {
+	return fmt.Sprintf("Could not fetch gtfs-rt feed %s : %+v", e.source, e.err)
+}
+func (e FetchError) Unwrap() error { return e.err }
+
+func newFetchError(source string, err error) error {
+	return FetchError{
+		source: source,
+		err:    err,
+	}
+}
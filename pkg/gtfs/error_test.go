@@ -0,0 +1,34 @@
+package gtfs
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireErrorTypeMatch(t *testing.T, err error, expected error) {
+	require.Equalf(t, reflect.TypeOf(err), reflect.TypeOf(expected), "Invalid error type. Got %s but expected %s", reflect.TypeOf(err), reflect.TypeOf(expected))
+}
+
+func TestErrorsCoverage(t *testing.T) {
+	openErr := OpenError{}
+	_ = openErr.Error()
+	_ = openErr.Unwrap()
+	missingFileErr := MissingFileError{}
+	_ = missingFileErr.Error()
+	parseErr := ParseError{}
+	_ = parseErr.Error()
+	_ = parseErr.Unwrap()
+	notSupportedErr := NotSupportedError{}
+	_ = notSupportedErr.Error()
+	storeErr := StoreError{}
+	_ = storeErr.Error()
+	_ = storeErr.Unwrap()
+	decodeErr := DecodeError{}
+	_ = decodeErr.Error()
+	_ = decodeErr.Unwrap()
+	fetchErr := FetchError{}
+	_ = fetchErr.Error()
+	_ = fetchErr.Unwrap()
+}
@@ -0,0 +1,412 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayout is the layout of GTFS dates, like 20210503
+const dateLayout = "20060102"
+
+// A Feed holds the parts of a GTFS archive needed to compute departures
+type Feed struct {
+	Agencies      []Agency
+	Stops         []Stop
+	Routes        []Route
+	Trips         []Trip
+	StopTimes     []StopTime
+	Calendars     []Calendar
+	CalendarDates []CalendarDate
+}
+
+type Agency struct {
+	Id       string
+	Name     string
+	Timezone string
+}
+
+type Stop struct {
+	Id   string
+	Name string
+	Lat  float64
+	Lon  float64
+	// LocationType is 0 for a stop point and 1 for a station grouping stop points
+	LocationType  int
+	ParentStation string
+	// Timezone is empty when the stop is in the timezone of the agency
+	Timezone string
+}
+
+type Route struct {
+	Id        string
+	AgencyId  string
+	ShortName string
+	LongName  string
+	Type      int
+	Color     string
+	TextColor string
+}
+
+type Trip struct {
+	Id        string
+	RouteId   string
+	ServiceId string
+	Headsign  string
+	ShortName string
+}
+
+type StopTime struct {
+	TripId   string
+	StopId   string
+	Sequence int
+	// Times are relative to noon minus 12h of the service day and can go past 24h
+	Arrival   time.Duration
+	Departure time.Duration
+	// PickupType is 1 when passengers cannot board at this stop
+	PickupType  int
+	DropOffType int
+}
+
+// A Calendar gives the days of the week a service runs on during a period
+type Calendar struct {
+	ServiceId string
+	// Days are indexed by time.Weekday, sunday first
+	Days      [7]bool
+	StartDate string
+	EndDate   string
+}
+
+// A CalendarDate adds or removes a service on a given day
+type CalendarDate struct {
+	ServiceId string
+	Date      string
+	// ExceptionType is 1 when the service is added and 2 when it is removed
+	ExceptionType int
+}
+
+// Timezone returns the timezone of the feed, which is the one of its agencies
+func (f *Feed) Timezone() string {
+	for _, a := range f.Agencies {
+		if a.Timezone != "" {
+			return a.Timezone
+		}
+	}
+	return ""
+}
+
+// Open reads a GTFS zip archive
+func Open(path string) (*Feed, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, newOpenError(path, err)
+	}
+	defer r.Close()
+	files := make(map[string]*zip.File)
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+	feed := &Feed{}
+	for _, file := range []struct {
+		name     string
+		required bool
+		parse    func(record) error
+	}{
+		{"agency.txt", true, feed.parseAgency},
+		{"stops.txt", true, feed.parseStop},
+		{"routes.txt", true, feed.parseRoute},
+		{"trips.txt", true, feed.parseTrip},
+		{"stop_times.txt", true, feed.parseStopTime},
+		{"calendar.txt", false, feed.parseCalendar},
+		{"calendar_dates.txt", false, feed.parseCalendarDate},
+	} {
+		f, ok := files[file.name]
+		if !ok {
+			if file.required {
+				return nil, newMissingFileError(file.name)
+			}
+			continue
+		}
+		if err := readFile(f, file.parse); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := files["calendar.txt"]; !ok {
+		if _, ok := files["calendar_dates.txt"]; !ok {
+			return nil, newMissingFileError("calendar.txt")
+		}
+	}
+	feed.interpolateStopTimes()
+	return feed, nil
+}
+
+// interpolateStopTimes gives a time to the stop times that are not timepoints, spreading them evenly between the
+// timepoints around them in the sequence of their trip. The distances between stops are not used. The stop times
+// without a timepoint before and after them in their trip cannot be interpolated and are dropped.
+func (f *Feed) interpolateStopTimes() {
+	trips := make(map[string][]int)
+	var untimed bool
+	for i := range f.StopTimes {
+		trips[f.StopTimes[i].TripId] = append(trips[f.StopTimes[i].TripId], i)
+		untimed = untimed || f.StopTimes[i].Arrival < 0
+	}
+	if !untimed {
+		return
+	}
+	for _, indexes := range trips {
+		sort.Slice(indexes, func(a, b int) bool { return f.StopTimes[indexes[a]].Sequence < f.StopTimes[indexes[b]].Sequence })
+		previous := -1
+		for j, i := range indexes {
+			if f.StopTimes[i].Arrival < 0 {
+				continue
+			}
+			if previous >= 0 && j-previous > 1 {
+				from := f.StopTimes[indexes[previous]].Departure
+				to := f.StopTimes[i].Arrival
+				for k := previous + 1; k < j; k++ {
+					t := (from + (to-from)*time.Duration(k-previous)/time.Duration(j-previous)).Truncate(time.Second)
+					f.StopTimes[indexes[k]].Arrival = t
+					f.StopTimes[indexes[k]].Departure = t
+				}
+			}
+			previous = j
+		}
+	}
+	stopTimes := f.StopTimes[:0]
+	for _, st := range f.StopTimes {
+		if st.Arrival >= 0 {
+			stopTimes = append(stopTimes, st)
+		}
+	}
+	f.StopTimes = stopTimes
+}
+
+// A record is a line of a GTFS file, whose fields are accessed by column name
+type record struct {
+	file   string
+	line   int
+	header map[string]int
+	fields []string
+}
+
+func (r record) get(name string) string {
+	if i, ok := r.header[name]; ok && i < len(r.fields) {
+		return strings.TrimSpace(r.fields[i])
+	}
+	return ""
+}
+
+// int parses an optional integer field, which defaults to 0
+func (r record) int(name string) (int, error) {
+	s := r.get(name)
+	if s == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, newParseError(r.file, r.line, name, err)
+	}
+	return i, nil
+}
+
+func (r record) float(name string) (float64, error) {
+	s := r.get(name)
+	if s == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, newParseError(r.file, r.line, name, err)
+	}
+	return f, nil
+}
+
+// date validates a date field
+func (r record) date(name string) (string, error) {
+	s := r.get(name)
+	if _, err := time.Parse(dateLayout, s); err != nil {
+		return "", newParseError(r.file, r.line, name, err)
+	}
+	return s, nil
+}
+
+// time parses a time field like 25:10:00, an empty time is returned as -1
+func (r record) time(name string) (time.Duration, error) {
+	s := r.get(name)
+	if s == "" {
+		return -1, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, newParseError(r.file, r.line, name, fmt.Errorf("invalid time %s", s))
+	}
+	var t time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, newParseError(r.file, r.line, name, fmt.Errorf("invalid time %s", s))
+		}
+		t += time.Duration(n) * unit
+	}
+	return t, nil
+}
+
+// readFile calls parse for every record of a csv file of the archive
+func readFile(f *zip.File, parse func(record) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return newParseError(f.Name, 0, "", err)
+	}
+	defer rc.Close()
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return newParseError(f.Name, 1, "", err)
+	}
+	r := record{file: f.Name, header: make(map[string]int)}
+	for i, name := range header {
+		// some exports start with a byte order mark
+		r.header[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for r.line = 2; ; r.line++ {
+		if r.fields, err = reader.Read(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return newParseError(f.Name, r.line, "", err)
+		}
+		if err = parse(r); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *Feed) parseAgency(r record) error {
+	f.Agencies = append(f.Agencies, Agency{
+		Id:       r.get("agency_id"),
+		Name:     r.get("agency_name"),
+		Timezone: r.get("agency_timezone"),
+	})
+	return nil
+}
+
+func (f *Feed) parseStop(r record) (err error) {
+	s := Stop{
+		Id:            r.get("stop_id"),
+		Name:          r.get("stop_name"),
+		ParentStation: r.get("parent_station"),
+		Timezone:      r.get("stop_timezone"),
+	}
+	if s.Lat, err = r.float("stop_lat"); err != nil {
+		return err
+	}
+	if s.Lon, err = r.float("stop_lon"); err != nil {
+		return err
+	}
+	if s.LocationType, err = r.int("location_type"); err != nil {
+		return err
+	}
+	f.Stops = append(f.Stops, s)
+	return nil
+}
+
+func (f *Feed) parseRoute(r record) (err error) {
+	route := Route{
+		Id:        r.get("route_id"),
+		AgencyId:  r.get("agency_id"),
+		ShortName: r.get("route_short_name"),
+		LongName:  r.get("route_long_name"),
+		Color:     r.get("route_color"),
+		TextColor: r.get("route_text_color"),
+	}
+	if route.Type, err = r.int("route_type"); err != nil {
+		return err
+	}
+	f.Routes = append(f.Routes, route)
+	return nil
+}
+
+func (f *Feed) parseTrip(r record) error {
+	f.Trips = append(f.Trips, Trip{
+		Id:        r.get("trip_id"),
+		RouteId:   r.get("route_id"),
+		ServiceId: r.get("service_id"),
+		Headsign:  r.get("trip_headsign"),
+		ShortName: r.get("trip_short_name"),
+	})
+	return nil
+}
+
+func (f *Feed) parseStopTime(r record) (err error) {
+	st := StopTime{
+		TripId: r.get("trip_id"),
+		StopId: r.get("stop_id"),
+	}
+	if st.Sequence, err = r.int("stop_sequence"); err != nil {
+		return err
+	}
+	if st.Arrival, err = r.time("arrival_time"); err != nil {
+		return err
+	}
+	if st.Departure, err = r.time("departure_time"); err != nil {
+		return err
+	}
+	// times are only mandatory for the stops that are timepoints, the other ones are interpolated once every stop time
+	// is read
+	if st.Arrival < 0 {
+		st.Arrival = st.Departure
+	}
+	if st.Departure < 0 {
+		st.Departure = st.Arrival
+	}
+	if st.PickupType, err = r.int("pickup_type"); err != nil {
+		return err
+	}
+	if st.DropOffType, err = r.int("drop_off_type"); err != nil {
+		return err
+	}
+	f.StopTimes = append(f.StopTimes, st)
+	return nil
+}
+
+func (f *Feed) parseCalendar(r record) (err error) {
+	c := Calendar{ServiceId: r.get("service_id")}
+	for i, day := range []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"} {
+		n, err := r.int(day)
+		if err != nil {
+			return err
+		}
+		c.Days[i] = n == 1
+	}
+	if c.StartDate, err = r.date("start_date"); err != nil {
+		return err
+	}
+	if c.EndDate, err = r.date("end_date"); err != nil {
+		return err
+	}
+	f.Calendars = append(f.Calendars, c)
+	return nil
+}
+
+func (f *Feed) parseCalendarDate(r record) (err error) {
+	cd := CalendarDate{ServiceId: r.get("service_id")}
+	if cd.Date, err = r.date("date"); err != nil {
+		return err
+	}
+	if cd.ExceptionType, err = r.int("exception_type"); err != nil {
+		return err
+	}
+	f.CalendarDates = append(f.CalendarDates, cd)
+	return nil
+}
+
+// ServiceTime returns the time of a stop time on a service day. GTFS times are relative to noon minus 12h so that
+// they stay right on daylight saving time changes.
+func ServiceTime(day time.Time, t time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, day.Location()).Add(-12 * time.Hour).Add(t)
+}
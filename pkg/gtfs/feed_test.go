@@ -0,0 +1,148 @@
+package gtfs
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readSample returns the files of the sample feed, by name
+func readSample(t *testing.T) map[string]string {
+	entries, err := ioutil.ReadDir("test_data/sample")
+	require.NoError(t, err)
+	files := make(map[string]string)
+	for _, e := range entries {
+		content, err := ioutil.ReadFile(filepath.Join("test_data/sample", e.Name()))
+		require.NoError(t, err)
+		files[e.Name()] = string(content)
+	}
+	return files
+}
+
+// writeZip writes a gtfs archive in a temporary directory and returns its path
+func writeZip(t *testing.T, files map[string]string) string {
+	path := filepath.Join(t.TempDir(), "gtfs.zip")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return path
+}
+
+func TestOpen(t *testing.T) {
+	feed, err := Open(writeZip(t, readSample(t)))
+	require.NoError(t, err)
+	// the header of agency.txt starts with a byte order mark
+	require.Equal(t, []Agency{Agency{Id: "OCESN", Name: "SNCF", Timezone: "Europe/Paris"}}, feed.Agencies)
+	require.Equal(t, "Europe/Paris", feed.Timezone())
+	require.Len(t, feed.Stops, 6)
+	require.Equal(t, Stop{
+		Id:            "StopPoint:OCETrain TER-87723502",
+		Name:          "Crépieux-la-Pape",
+		Lat:           45.80482,
+		Lon:           4.89214,
+		ParentStation: "StopArea:OCE87723502",
+	}, feed.Stops[3])
+	require.Equal(t, 1, feed.Stops[2].LocationType)
+	require.Equal(t, []Route{Route{
+		Id:        "OCE1506105",
+		AgencyId:  "OCESN",
+		ShortName: "TER",
+		LongName:  "Lyon Part Dieu - Ambérieu-en-Bugey",
+		Type:      2,
+		Color:     "000000",
+		TextColor: "FFFFFF",
+	}}, feed.Routes)
+	require.Equal(t, Trip{Id: "OCESN886823F0100110", RouteId: "OCE1506105", ServiceId: "1", Headsign: "886823"}, feed.Trips[0])
+	require.Len(t, feed.StopTimes, 9)
+	require.Equal(t, StopTime{
+		TripId:    "OCESN886899F0300330",
+		StopId:    "StopPoint:OCETrain TER-87723502",
+		Sequence:  1,
+		Arrival:   24*time.Hour + 4*time.Minute,
+		Departure: 24*time.Hour + 5*time.Minute,
+	}, feed.StopTimes[7])
+	require.Equal(t, 1, feed.StopTimes[8].PickupType)
+	require.Equal(t, []Calendar{
+		Calendar{ServiceId: "1", Days: [7]bool{false, true, true, true, true, true, false}, StartDate: "20210501", EndDate: "20210531"},
+		Calendar{ServiceId: "2", Days: [7]bool{true, false, false, false, false, false, true}, StartDate: "20210501", EndDate: "20210531"},
+	}, feed.Calendars)
+	require.Equal(t, CalendarDate{ServiceId: "1", Date: "20210513", ExceptionType: 2}, feed.CalendarDates[0])
+}
+
+func TestOpenErrors(t *testing.T) {
+	_, err := Open("test_data/non-existent.zip")
+	requireErrorTypeMatch(t, err, OpenError{})
+	testCases := []struct {
+		name     string
+		edit     func(files map[string]string)
+		expected error
+	}{
+		{"missing stop times", func(files map[string]string) { delete(files, "stop_times.txt") }, MissingFileError{}},
+		{"missing calendars", func(files map[string]string) {
+			delete(files, "calendar.txt")
+			delete(files, "calendar_dates.txt")
+		}, MissingFileError{}},
+		{"invalid time", func(files map[string]string) {
+			files["stop_times.txt"] = "trip_id,arrival_time,departure_time,stop_id,stop_sequence\nt,13h05,13:08:00,s,0\n"
+		}, ParseError{}},
+		{"invalid sequence", func(files map[string]string) {
+			files["stop_times.txt"] = "trip_id,arrival_time,departure_time,stop_id,stop_sequence\nt,13:05:00,13:08:00,s,first\n"
+		}, ParseError{}},
+		{"invalid date", func(files map[string]string) {
+			files["calendar_dates.txt"] = "service_id,date,exception_type\n1,2021-05-13,2\n"
+		}, ParseError{}},
+		{"invalid coordinates", func(files map[string]string) {
+			files["stops.txt"] = "stop_id,stop_name,stop_lat,stop_lon\ns,Stop,north,4.85\n"
+		}, ParseError{}},
+		{"invalid csv", func(files map[string]string) { files["trips.txt"] = "route_id,trip_id\n\"r,t\n" }, ParseError{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := readSample(t)
+			tc.edit(files)
+			_, err := Open(writeZip(t, files))
+			requireErrorTypeMatch(t, err, tc.expected)
+		})
+	}
+}
+
+func TestOpenWithoutTimes(t *testing.T) {
+	files := readSample(t)
+	// stop times that are not timepoints are interpolated between the ones around them, a single time is used for both
+	// the arrival and the departure. Those without timepoints on both sides are dropped.
+	files["stop_times.txt"] = "trip_id,arrival_time,departure_time,stop_id,stop_sequence\nt,,,z,0\nt,13:05:00,,a,1\nt,,,d,4\nt,,,b,2\nt,,13:45:00,c,5\n"
+	delete(files, "calendar.txt")
+	feed, err := Open(writeZip(t, files))
+	require.NoError(t, err)
+	require.Equal(t, []StopTime{
+		StopTime{TripId: "t", StopId: "a", Sequence: 1, Arrival: 13*time.Hour + 5*time.Minute, Departure: 13*time.Hour + 5*time.Minute},
+		StopTime{TripId: "t", StopId: "d", Sequence: 4, Arrival: 13*time.Hour + 31*time.Minute + 40*time.Second, Departure: 13*time.Hour + 31*time.Minute + 40*time.Second},
+		StopTime{TripId: "t", StopId: "b", Sequence: 2, Arrival: 13*time.Hour + 18*time.Minute + 20*time.Second, Departure: 13*time.Hour + 18*time.Minute + 20*time.Second},
+		StopTime{TripId: "t", StopId: "c", Sequence: 5, Arrival: 13*time.Hour + 45*time.Minute, Departure: 13*time.Hour + 45*time.Minute},
+	}, feed.StopTimes)
+	require.Empty(t, feed.Calendars)
+}
+
+func TestServiceTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	day := time.Date(2021, time.May, 3, 0, 0, 0, 0, paris)
+	require.Equal(t, time.Date(2021, time.May, 3, 13, 8, 0, 0, paris), ServiceTime(day, 13*time.Hour+8*time.Minute))
+	require.Equal(t, time.Date(2021, time.May, 4, 0, 5, 0, 0, paris), ServiceTime(day, 24*time.Hour+5*time.Minute))
+	// on daylight saving time days, times are counted from noon minus 12h and not from midnight
+	dst := time.Date(2021, time.March, 28, 0, 0, 0, 0, paris)
+	require.Equal(t, time.Date(2021, time.March, 28, 13, 8, 0, 0, paris), ServiceTime(dst, 13*time.Hour+8*time.Minute))
+}
@@ -0,0 +1,130 @@
+package gtfs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxFeedSize bounds the size of a GTFS-RT feed, the SNCF one is a few hundred kilobytes
+const maxFeedSize = 32 << 20
+
+// Realtime gives the latest trip updates, it is implemented by the Poller
+type Realtime interface {
+	TripUpdate(tripId string, startDate string) (*TripUpdate, bool)
+}
+
+// A Poller periodically fetches a GTFS-RT trip updates feed from an url or a local file
+type Poller struct {
+	source     string
+	interval   time.Duration
+	maxAge     time.Duration
+	httpClient *http.Client
+	now        func() time.Time
+
+	mutex sync.RWMutex
+	// updates are indexed by trip id and start date, since a feed can update the runs of a trip on several days
+	updates   map[string]*TripUpdate
+	timestamp time.Time
+}
+
+// NewPoller returns a poller for a feed, updates older than maxAge are ignored
+func NewPoller(source string, interval time.Duration, maxAge time.Duration) *Poller {
+	return &Poller{
+		source:   source,
+		interval: interval,
+		maxAge:   maxAge,
+		httpClient: &http.Client{
+			Timeout: interval,
+		},
+		now: time.Now,
+	}
+}
+
+// Run polls the feed until the context is done
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		if err := p.Poll(ctx); err != nil {
+			log.Printf("%+v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll fetches the feed once and replaces the trip updates. They are kept when the feed cannot be fetched.
+func (p *Poller) Poll(ctx context.Context) error {
+	fetchedAt := p.now()
+	b, err := p.fetch(ctx)
+	if err != nil {
+		return newFetchError(p.source, err)
+	}
+	m, err := DecodeFeedMessage(b)
+	if err != nil {
+		return err
+	}
+	updates := make(map[string]*TripUpdate)
+	for i := range m.TripUpdates {
+		updates[tripKey(m.TripUpdates[i].TripId, m.TripUpdates[i].StartDate)] = &m.TripUpdates[i]
+	}
+	// the header timestamp is required but some feeds leave it unset, they are then as fresh as the fetch
+	if m.Timestamp.Unix() <= 0 {
+		m.Timestamp = fetchedAt
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.updates = updates
+	p.timestamp = m.Timestamp
+	return nil
+}
+
+// fetch returns the raw feed
+func (p *Poller) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(p.source, "http://") && !strings.HasPrefix(p.source, "https://") {
+		return ioutil.ReadFile(p.source)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", p.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http status %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, maxFeedSize))
+}
+
+// tripKey indexes the updates of a trip on a service day like 20210503, the start date is empty when the feed does not
+// give it
+func tripKey(tripId string, startDate string) string {
+	return tripId + ":" + startDate
+}
+
+// TripUpdate returns the latest update of a trip on a service day, or the one of the trip without start date, unless
+// the feed is older than the maximum age
+func (p *Poller) TripUpdate(tripId string, startDate string) (*TripUpdate, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	if p.now().Sub(p.timestamp) > p.maxAge {
+		return nil, false
+	}
+	if tu, ok := p.updates[tripKey(tripId, startDate)]; ok {
+		return tu, true
+	}
+	tu, ok := p.updates[tripKey(tripId, "")]
+	return tu, ok
+}
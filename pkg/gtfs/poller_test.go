@@ -0,0 +1,101 @@
+package gtfs
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPoller returns a poller whose clock is set shortly after the recorded feed was generated
+func newTestPoller(source string) *Poller {
+	p := NewPoller(source, 30*time.Second, 5*time.Minute)
+	p.now = func() time.Time { return time.Unix(1620040500, 0).Add(time.Minute) }
+	return p
+}
+
+func TestPollFile(t *testing.T) {
+	p := newTestPoller("test_data/trip-updates.pb")
+	_, ok := p.TripUpdate("OCESN886823F0100110", "20210503")
+	require.False(t, ok)
+	require.NoError(t, p.Poll(context.Background()))
+	tu, ok := p.TripUpdate("OCESN886823F0100110", "20210503")
+	require.True(t, ok)
+	require.Equal(t, "20210503", tu.StartDate)
+	// updates are given for a service day, unless the feed does not say which one
+	_, ok = p.TripUpdate("OCESN886823F0100110", "20210504")
+	require.False(t, ok)
+	_, ok = p.TripUpdate("OCESN886825F0200220", "20210503")
+	require.True(t, ok)
+	_, ok = p.TripUpdate("OCESN886825F0200220", "20210504")
+	require.True(t, ok)
+	_, ok = p.TripUpdate("unknown", "20210503")
+	require.False(t, ok)
+	// a feed that cannot be fetched keeps the previous updates until they are too old
+	p.source = "test_data/invalid.pb"
+	requireErrorTypeMatch(t, p.Poll(context.Background()), DecodeError{})
+	p.source = "test_data/non-existent.pb"
+	requireErrorTypeMatch(t, p.Poll(context.Background()), FetchError{})
+	_, ok = p.TripUpdate("OCESN886823F0100110", "20210503")
+	require.True(t, ok)
+	p.now = func() time.Time { return time.Unix(1620040500, 0).Add(10 * time.Minute) }
+	_, ok = p.TripUpdate("OCESN886823F0100110", "20210503")
+	require.False(t, ok)
+}
+
+func TestPollUrl(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/trip-updates" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, "test_data/trip-updates.pb")
+	}))
+	defer ts.Close()
+	p := newTestPoller(ts.URL + "/trip-updates")
+	require.NoError(t, p.Poll(context.Background()))
+	tu, ok := p.TripUpdate("OCESN886899F0300330", "20210503")
+	require.True(t, ok)
+	require.True(t, tu.Cancelled)
+	p = newTestPoller(ts.URL + "/not-found")
+	requireErrorTypeMatch(t, p.Poll(context.Background()), FetchError{})
+	p = newTestPoller("http://" + string([]byte{0x7f}))
+	requireErrorTypeMatch(t, p.Poll(context.Background()), FetchError{})
+	ts.Close()
+	p = newTestPoller(ts.URL + "/trip-updates")
+	requireErrorTypeMatch(t, p.Poll(context.Background()), FetchError{})
+}
+
+func TestRun(t *testing.T) {
+	p := newTestPoller("test_data/trip-updates.pb")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// the feed is fetched once before the poller notices the context is done
+	p.Run(ctx)
+	_, ok := p.TripUpdate("OCESN886823F0100110", "20210503")
+	require.True(t, ok)
+	p = newTestPoller("test_data/invalid.pb")
+	p.Run(ctx)
+	_, ok = p.TripUpdate("OCESN886823F0100110", "20210503")
+	require.False(t, ok)
+}
+
+func TestPollWithoutTimestamp(t *testing.T) {
+	// feeds without a header timestamp are as fresh as their fetch
+	m := NewFeedMessage(time.Unix(0, 0), []Board{testBoards(time.UTC)[0]})
+	path := filepath.Join(t.TempDir(), "trip-updates.pb")
+	require.NoError(t, ioutil.WriteFile(path, m.Marshal(), 0644))
+	p := newTestPoller(path)
+	require.NoError(t, p.Poll(context.Background()))
+	require.Equal(t, p.now(), p.timestamp)
+	require.NotEmpty(t, p.updates)
+	for _, tu := range p.updates {
+		_, ok := p.TripUpdate(tu.TripId, tu.StartDate)
+		require.True(t, ok)
+	}
+}
@@ -0,0 +1,474 @@
+package gtfs
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// An Alert is a disruption published in a GTFS-RT feed
+type Alert struct {
+	Id            string
+	ActivePeriods []model.Period
+	// Trips and StopIds are the entities the alert informs about
+	Trips   []TripUpdate
+	StopIds []string
+	// Effect is a GTFS-RT effect like NO_SERVICE, any other value is published as UNKNOWN_EFFECT
+	Effect      string
+	Header      string
+	Description string
+}
+
+// effects are the GTFS-RT alert effects
+var effects = map[string]uint64{
+	"NO_SERVICE":          1,
+	"REDUCED_SERVICE":     2,
+	"SIGNIFICANT_DELAYS":  3,
+	"DETOUR":              4,
+	"ADDITIONAL_SERVICE":  5,
+	"MODIFIED_SERVICE":    6,
+	"OTHER_EFFECT":        7,
+	"UNKNOWN_EFFECT":      8,
+	"STOP_MOVED":          9,
+	"NO_EFFECT":           10,
+	"ACCESSIBILITY_ISSUE": 11,
+}
+
+// byScheduledDeparture sorts the stop time updates of a trip by their scheduled departure, which is the order the trip
+// visits its stops
+type byScheduledDeparture struct {
+	updates    []StopTimeUpdate
+	departures []time.Time
+}
+
+func (b byScheduledDeparture) Len() int { return len(b.updates) }
+func (b byScheduledDeparture) Less(i, j int) bool {
+	return b.departures[i].Before(b.departures[j])
+}
+func (b byScheduledDeparture) Swap(i, j int) {
+	b.updates[i], b.updates[j] = b.updates[j], b.updates[i]
+	b.departures[i], b.departures[j] = b.departures[j], b.departures[i]
+}
+
+// A Board is the departures from a stop, as returned by GetDepartures
+type Board struct {
+	StopId     string
+	Departures []model.Departure
+}
+
+// NewFeedMessage builds a GTFS-RT feed from departure boards. Every train with real-time information becomes a trip
+// update with a stop time update for each board it leaves from, unless the whole train is cancelled, and the
+// disruptions of the trains become alerts. The trains which left the last of their stops before the timestamp are
+// not published. The stop sequences are unknown, the stop time updates are sorted by their
+// scheduled departure instead since GTFS-RT requires them in the order the trip visits its stops.
+// Trains are identified by their vehicle journey, or their number when there is none, and the day of their departure.
+func NewFeedMessage(timestamp time.Time, boards []Board) *FeedMessage {
+	m := &FeedMessage{Timestamp: timestamp}
+	// last is the last departure of each train from the boards
+	last := make(map[string]time.Time)
+	for _, board := range boards {
+		for _, d := range board.Departures {
+			key := tripKey(feedTripId(d), d.BaseDeparture.Format(dateLayout))
+			if d.Departure.After(last[key]) {
+				last[key] = d.Departure
+			}
+		}
+	}
+	updates := make(map[string]int)
+	// departures are the scheduled departures of the stop time updates of each trip update
+	var departures [][]time.Time
+	alerts := make(map[string]int)
+	// informed records the trips already listed by an alert
+	informed := make(map[string]bool)
+	for _, board := range boards {
+		for _, d := range board.Departures {
+			trip := TripUpdate{TripId: feedTripId(d), StartDate: d.BaseDeparture.Format(dateLayout)}
+			key := tripKey(trip.TripId, trip.StartDate)
+			if last[key].Before(timestamp) {
+				continue
+			}
+			for _, disruption := range d.Disruptions {
+				if disruption.Status == "past" {
+					continue
+				}
+				i, ok := alerts[disruption.Id]
+				if !ok {
+					i = len(m.Alerts)
+					alerts[disruption.Id] = i
+					m.Alerts = append(m.Alerts, newAlert(disruption))
+				}
+				if !informed[disruption.Id+"@"+key] {
+					informed[disruption.Id+"@"+key] = true
+					m.Alerts[i].Trips = append(m.Alerts[i].Trips, trip)
+				}
+			}
+			if !d.RealTime && !d.Cancelled {
+				continue
+			}
+			i, ok := updates[key]
+			if !ok {
+				i = len(m.TripUpdates)
+				updates[key] = i
+				m.TripUpdates = append(m.TripUpdates, trip)
+				departures = append(departures, nil)
+			}
+			tu := &m.TripUpdates[i]
+			stu := StopTimeUpdate{StopSequence: -1, StopId: board.StopId}
+			if d.Cancelled {
+				// a disruption without service cancels the whole train, otherwise only this stop is skipped
+				for _, disruption := range d.Disruptions {
+					tu.Cancelled = tu.Cancelled || disruption.NoService()
+				}
+				stu.Skipped = true
+			} else {
+				stu.Arrival = StopTimeEvent{Time: d.Arrival, Delay: d.Arrival.Sub(d.BaseArrival), HasDelay: true}
+				stu.Departure = StopTimeEvent{Time: d.Departure, Delay: d.Departure.Sub(d.BaseDeparture), HasDelay: true}
+			}
+			tu.StopTimeUpdates = append(tu.StopTimeUpdates, stu)
+			departures[i] = append(departures[i], d.BaseDeparture)
+		}
+	}
+	// a cancelled train has no stop time updates, its stops are not skipped one by one
+	for i := range m.TripUpdates {
+		if m.TripUpdates[i].Cancelled {
+			m.TripUpdates[i].StopTimeUpdates = nil
+			continue
+		}
+		sort.Stable(byScheduledDeparture{m.TripUpdates[i].StopTimeUpdates, departures[i]})
+	}
+	return m
+}
+
+// feedTripId identifies the train of a departure in the feed, by its vehicle journey or its number when there is none
+func feedTripId(d model.Departure) string {
+	if d.VehicleJourney != "" {
+		return d.VehicleJourney
+	}
+	return d.TrainNumber
+}
+
+// newAlert converts a disruption to an alert informing about the stop areas it impacts
+func newAlert(d model.Disruption) Alert {
+	a := Alert{
+		Id:            d.Id,
+		ActivePeriods: d.ApplicationPeriods,
+		Effect:        d.Severity.Effect,
+		Header:        d.Cause,
+		Description:   strings.Join(d.Messages, "\n"),
+	}
+	if a.Header == "" {
+		a.Header = d.Severity.Name
+	}
+	for _, o := range d.ImpactedObjects {
+		if o.Type == "stop_area" {
+			a.StopIds = append(a.StopIds, o.Id)
+		}
+	}
+	return a
+}
+
+// Marshal encodes the feed in the GTFS-RT protobuf format
+func (m *FeedMessage) Marshal() []byte {
+	return m.wire().append(nil)
+}
+
+// MarshalJSON encodes the feed in the JSON mapping of the GTFS-RT protobuf messages, for debugging purposes
+func (m *FeedMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.wire())
+}
+
+// wire converts the feed to the GTFS-RT messages
+func (m *FeedMessage) wire() *feedMessage {
+	w := &feedMessage{Header: feedHeader{GtfsRealtimeVersion: "2.0", Incrementality: "FULL_DATASET", Timestamp: m.Timestamp.Unix()}, Entity: []feedEntity{}}
+	for i := range m.TripUpdates {
+		tu := &m.TripUpdates[i]
+		e := feedEntity{Id: tu.TripId + ":" + tu.StartDate, TripUpdate: &tripUpdate{Trip: tripDescriptor(tu)}}
+		if tu.HasDelay {
+			e.TripUpdate.Delay = durationSeconds(tu.Delay)
+		}
+		for _, stu := range tu.StopTimeUpdates {
+			s := stopTimeUpdate{StopId: stu.StopId}
+			if stu.StopSequence >= 0 {
+				sequence := stu.StopSequence
+				s.StopSequence = &sequence
+			}
+			switch {
+			case stu.Skipped:
+				s.ScheduleRelationship = "SKIPPED"
+			case stu.NoData:
+				s.ScheduleRelationship = "NO_DATA"
+			default:
+				s.Arrival = stopTimeEvent(stu.Arrival)
+				s.Departure = stopTimeEvent(stu.Departure)
+			}
+			e.TripUpdate.StopTimeUpdate = append(e.TripUpdate.StopTimeUpdate, s)
+		}
+		w.Entity = append(w.Entity, e)
+	}
+	for i := range m.Alerts {
+		a := &m.Alerts[i]
+		w.Entity = append(w.Entity, feedEntity{Id: a.Id, Alert: a.wire()})
+	}
+	return w
+}
+
+func (a *Alert) wire() *alert {
+	w := &alert{Effect: "UNKNOWN_EFFECT"}
+	if _, ok := effects[a.Effect]; ok {
+		w.Effect = a.Effect
+	}
+	for _, p := range a.ActivePeriods {
+		var tr timeRange
+		if !p.Begin.IsZero() {
+			tr.Start = p.Begin.Unix()
+		}
+		if !p.End.IsZero() {
+			tr.End = p.End.Unix()
+		}
+		w.ActivePeriod = append(w.ActivePeriod, tr)
+	}
+	for i := range a.Trips {
+		w.InformedEntity = append(w.InformedEntity, entitySelector{Trip: tripDescriptor(&a.Trips[i])})
+	}
+	for _, id := range a.StopIds {
+		w.InformedEntity = append(w.InformedEntity, entitySelector{StopId: id})
+	}
+	if a.Header != "" {
+		w.HeaderText = &translatedString{Translation: []translation{translation{Text: a.Header}}}
+	}
+	if a.Description != "" {
+		w.DescriptionText = &translatedString{Translation: []translation{translation{Text: a.Description}}}
+	}
+	return w
+}
+
+func tripDescriptor(tu *TripUpdate) *trip {
+	t := &trip{TripId: tu.TripId, StartDate: tu.StartDate}
+	if tu.Cancelled {
+		t.ScheduleRelationship = "CANCELED"
+	}
+	return t
+}
+
+func stopTimeEvent(e StopTimeEvent) *event {
+	if !e.known() {
+		return nil
+	}
+	w := &event{}
+	if e.HasDelay {
+		w.Delay = durationSeconds(e.Delay)
+	}
+	if !e.Time.IsZero() {
+		w.Time = e.Time.Unix()
+	}
+	return w
+}
+
+func durationSeconds(d time.Duration) *int32 {
+	s := int32(d / time.Second)
+	return &s
+}
+
+// The GTFS-RT messages, their json tags follow the protobuf field names and the append methods encode their fields
+// numbers. Only the fields we publish are declared.
+type feedMessage struct {
+	Header feedHeader   `json:"header"`
+	Entity []feedEntity `json:"entity"`
+}
+
+type feedHeader struct {
+	GtfsRealtimeVersion string `json:"gtfs_realtime_version"`
+	Incrementality      string `json:"incrementality"`
+	Timestamp           int64  `json:"timestamp"`
+}
+
+type feedEntity struct {
+	Id         string      `json:"id"`
+	TripUpdate *tripUpdate `json:"trip_update,omitempty"`
+	Alert      *alert      `json:"alert,omitempty"`
+}
+
+type tripUpdate struct {
+	Trip           *trip            `json:"trip"`
+	StopTimeUpdate []stopTimeUpdate `json:"stop_time_update,omitempty"`
+	Delay          *int32           `json:"delay,omitempty"`
+}
+
+type trip struct {
+	TripId               string `json:"trip_id,omitempty"`
+	StartDate            string `json:"start_date,omitempty"`
+	ScheduleRelationship string `json:"schedule_relationship,omitempty"`
+}
+
+type stopTimeUpdate struct {
+	StopSequence         *int   `json:"stop_sequence,omitempty"`
+	StopId               string `json:"stop_id,omitempty"`
+	Arrival              *event `json:"arrival,omitempty"`
+	Departure            *event `json:"departure,omitempty"`
+	ScheduleRelationship string `json:"schedule_relationship,omitempty"`
+}
+
+type event struct {
+	Delay *int32 `json:"delay,omitempty"`
+	Time  int64  `json:"time,omitempty"`
+}
+
+type alert struct {
+	ActivePeriod    []timeRange       `json:"active_period,omitempty"`
+	InformedEntity  []entitySelector  `json:"informed_entity"`
+	Effect          string            `json:"effect"`
+	HeaderText      *translatedString `json:"header_text,omitempty"`
+	DescriptionText *translatedString `json:"description_text,omitempty"`
+}
+
+type timeRange struct {
+	Start int64 `json:"start,omitempty"`
+	End   int64 `json:"end,omitempty"`
+}
+
+type entitySelector struct {
+	Trip   *trip  `json:"trip,omitempty"`
+	StopId string `json:"stop_id,omitempty"`
+}
+
+type translatedString struct {
+	Translation []translation `json:"translation"`
+}
+
+type translation struct {
+	Text string `json:"text"`
+}
+
+func (m *feedMessage) append(b []byte) []byte {
+	b = appendMessage(b, 1, m.Header.append(nil))
+	for i := range m.Entity {
+		b = appendMessage(b, 2, m.Entity[i].append(nil))
+	}
+	return b
+}
+
+func (h *feedHeader) append(b []byte) []byte {
+	b = appendString(b, 1, h.GtfsRealtimeVersion)
+	b = appendVarint(b, 2, 0) // FULL_DATASET
+	return appendVarint(b, 3, uint64(h.Timestamp))
+}
+
+func (e *feedEntity) append(b []byte) []byte {
+	b = appendString(b, 1, e.Id)
+	if e.TripUpdate != nil {
+		b = appendMessage(b, 3, e.TripUpdate.append(nil))
+	}
+	if e.Alert != nil {
+		b = appendMessage(b, 5, e.Alert.append(nil))
+	}
+	return b
+}
+
+func (tu *tripUpdate) append(b []byte) []byte {
+	b = appendMessage(b, 1, tu.Trip.append(nil))
+	for i := range tu.StopTimeUpdate {
+		b = appendMessage(b, 2, tu.StopTimeUpdate[i].append(nil))
+	}
+	if tu.Delay != nil {
+		b = appendVarint(b, 5, uint64(int64(*tu.Delay)))
+	}
+	return b
+}
+
+func (t *trip) append(b []byte) []byte {
+	b = appendString(b, 1, t.TripId)
+	b = appendString(b, 3, t.StartDate)
+	if t.ScheduleRelationship == "CANCELED" {
+		b = appendVarint(b, 4, tripCanceled)
+	}
+	return b
+}
+
+func (stu *stopTimeUpdate) append(b []byte) []byte {
+	if stu.StopSequence != nil {
+		b = appendVarint(b, 1, uint64(*stu.StopSequence))
+	}
+	if stu.Arrival != nil {
+		b = appendMessage(b, 2, stu.Arrival.append(nil))
+	}
+	if stu.Departure != nil {
+		b = appendMessage(b, 3, stu.Departure.append(nil))
+	}
+	b = appendString(b, 4, stu.StopId)
+	switch stu.ScheduleRelationship {
+	case "SKIPPED":
+		b = appendVarint(b, 5, stopSkipped)
+	case "NO_DATA":
+		b = appendVarint(b, 5, stopNoData)
+	}
+	return b
+}
+
+func (e *event) append(b []byte) []byte {
+	if e.Delay != nil {
+		b = appendVarint(b, 1, uint64(int64(*e.Delay)))
+	}
+	if e.Time != 0 {
+		b = appendVarint(b, 2, uint64(e.Time))
+	}
+	return b
+}
+
+func (a *alert) append(b []byte) []byte {
+	for _, p := range a.ActivePeriod {
+		var tr []byte
+		if p.Start != 0 {
+			tr = appendVarint(tr, 1, uint64(p.Start))
+		}
+		if p.End != 0 {
+			tr = appendVarint(tr, 2, uint64(p.End))
+		}
+		b = appendMessage(b, 1, tr)
+	}
+	for _, e := range a.InformedEntity {
+		var es []byte
+		if e.Trip != nil {
+			es = appendMessage(es, 4, e.Trip.append(nil))
+		}
+		es = appendString(es, 5, e.StopId)
+		b = appendMessage(b, 5, es)
+	}
+	b = appendVarint(b, 7, effects[a.Effect])
+	if a.HeaderText != nil {
+		b = appendMessage(b, 10, a.HeaderText.append(nil))
+	}
+	if a.DescriptionText != nil {
+		b = appendMessage(b, 11, a.DescriptionText.append(nil))
+	}
+	return b
+}
+
+func (ts *translatedString) append(b []byte) []byte {
+	for _, t := range ts.Translation {
+		b = appendMessage(b, 1, appendString(nil, 1, t.Text))
+	}
+	return b
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// appendString skips empty strings, which are the default value of optional fields
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
@@ -0,0 +1,168 @@
+package gtfs
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testBoards are the departures of two stops : a delayed train calling at both, a train on schedule without real-time
+// information and a cancelled one
+func testBoards(paris *time.Location) []Board {
+	at := func(hour int, min int) time.Time { return time.Date(2021, time.May, 3, hour, min, 0, 0, paris) }
+	strike := model.Disruption{
+		Id:                 "strike",
+		Status:             "active",
+		Cause:              "Mouvement social",
+		Severity:           model.Severity{Name: "trip canceled", Effect: "NO_SERVICE"},
+		Messages:           []string{"Train supprimé", "Mouvement social"},
+		ApplicationPeriods: []model.Period{model.Period{Begin: at(0, 0), End: at(23, 59)}},
+		ImpactedObjects:    []model.ImpactedObject{model.ImpactedObject{Id: "stop_area:SNCF:87723502", Type: "stop_area"}},
+	}
+	delayed := model.Disruption{Id: "delay", Status: "active", Severity: model.Severity{Name: "trip delayed", Effect: "SIGNIFICANT_DELAYS"}}
+	past := model.Disruption{Id: "past", Status: "past"}
+	return []Board{
+		Board{StopId: "stop_area:SNCF:87723197", Departures: []model.Departure{
+			model.Departure{TrainNumber: "886823", VehicleJourney: "vehicle_journey:SNCF:2021-05-03:886823", BaseArrival: at(13, 5), Arrival: at(13, 10), BaseDeparture: at(13, 8), Departure: at(13, 13), Delay: 5 * time.Minute, RealTime: true, Disruptions: []model.Disruption{delayed, past}},
+			model.Departure{TrainNumber: "886825", BaseArrival: at(13, 35), Arrival: at(13, 35), BaseDeparture: at(13, 38), Departure: at(13, 38)},
+		}},
+		Board{StopId: "stop_area:SNCF:87723502", Departures: []model.Departure{
+			model.Departure{TrainNumber: "886823", VehicleJourney: "vehicle_journey:SNCF:2021-05-03:886823", BaseArrival: at(13, 17), Arrival: at(13, 21), BaseDeparture: at(13, 18), Departure: at(13, 22), Delay: 4 * time.Minute, RealTime: true, Disruptions: []model.Disruption{delayed}},
+			model.Departure{TrainNumber: "886899", BaseArrival: at(14, 17), Arrival: at(14, 17), BaseDeparture: at(14, 18), Departure: at(14, 18), Cancelled: true, RealTime: true, Disruptions: []model.Disruption{strike}},
+		}},
+	}
+}
+
+func TestNewFeedMessage(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	at := func(hour int, min int) time.Time { return time.Date(2021, time.May, 3, hour, min, 0, 0, paris) }
+	m := NewFeedMessage(at(13, 15), testBoards(paris))
+	require.Equal(t, []TripUpdate{
+		TripUpdate{TripId: "vehicle_journey:SNCF:2021-05-03:886823", StartDate: "20210503", StopTimeUpdates: []StopTimeUpdate{
+			StopTimeUpdate{StopSequence: -1, StopId: "stop_area:SNCF:87723197", Arrival: StopTimeEvent{Time: at(13, 10), Delay: 5 * time.Minute, HasDelay: true}, Departure: StopTimeEvent{Time: at(13, 13), Delay: 5 * time.Minute, HasDelay: true}},
+			StopTimeUpdate{StopSequence: -1, StopId: "stop_area:SNCF:87723502", Arrival: StopTimeEvent{Time: at(13, 21), Delay: 4 * time.Minute, HasDelay: true}, Departure: StopTimeEvent{Time: at(13, 22), Delay: 4 * time.Minute, HasDelay: true}},
+		}},
+		TripUpdate{TripId: "886899", StartDate: "20210503", Cancelled: true},
+	}, m.TripUpdates)
+	// the stop time updates follow the trip whatever the order of the boards
+	boards := testBoards(paris)
+	boards[0], boards[1] = boards[1], boards[0]
+	reversed := NewFeedMessage(at(13, 15), boards)
+	require.Len(t, reversed.TripUpdates, 2)
+	require.Equal(t, m.TripUpdates[0].StopTimeUpdates, reversed.TripUpdates[0].StopTimeUpdates)
+	require.Len(t, m.Alerts, 2)
+	require.Equal(t, Alert{
+		Id:     "delay",
+		Trips:  []TripUpdate{TripUpdate{TripId: "vehicle_journey:SNCF:2021-05-03:886823", StartDate: "20210503"}},
+		Effect: "SIGNIFICANT_DELAYS",
+		Header: "trip delayed",
+	}, m.Alerts[0])
+	require.Equal(t, []string{"stop_area:SNCF:87723502"}, m.Alerts[1].StopIds)
+	require.Equal(t, "Mouvement social", m.Alerts[1].Header)
+	require.Equal(t, "Train supprimé\nMouvement social", m.Alerts[1].Description)
+	// the trains which left their last stop are not published, nor are their disruptions
+	m = NewFeedMessage(at(13, 40), testBoards(paris))
+	require.Len(t, m.TripUpdates, 1)
+	require.Equal(t, "886899", m.TripUpdates[0].TripId)
+	require.Len(t, m.Alerts, 1)
+	require.Equal(t, "strike", m.Alerts[0].Id)
+}
+
+func TestMarshal(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	m := NewFeedMessage(time.Date(2021, time.May, 3, 13, 15, 0, 0, paris), testBoards(paris))
+	b := m.Marshal()
+	// our own decoder reads back the trip updates
+	decoded, err := DecodeFeedMessage(b)
+	require.NoError(t, err)
+	require.True(t, m.Timestamp.Equal(decoded.Timestamp))
+	require.Len(t, decoded.TripUpdates, 2)
+	for i, tu := range decoded.TripUpdates {
+		require.Equal(t, m.TripUpdates[i].TripId, tu.TripId)
+		require.Equal(t, m.TripUpdates[i].StartDate, tu.StartDate)
+		require.Equal(t, m.TripUpdates[i].Cancelled, tu.Cancelled)
+		for j, stu := range tu.StopTimeUpdates {
+			expected := m.TripUpdates[i].StopTimeUpdates[j]
+			require.Equal(t, expected.StopId, stu.StopId)
+			require.Equal(t, expected.Skipped, stu.Skipped)
+			require.Equal(t, expected.Departure.Delay, stu.Departure.Delay)
+			require.True(t, expected.Departure.Time.Equal(stu.Departure.Time))
+		}
+	}
+	// alerts are the entities with a field 5
+	var effects []uint64
+	require.NoError(t, decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		if num != 2 {
+			return nil
+		}
+		return decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+			if num != 5 {
+				return nil
+			}
+			return decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+				if num == 7 {
+					effects = append(effects, n)
+				}
+				return nil
+			})
+		})
+	}))
+	require.Equal(t, []uint64{3, 1}, effects)
+}
+
+func TestMarshalJSON(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	m := NewFeedMessage(time.Date(2021, time.May, 3, 13, 15, 0, 0, paris), testBoards(paris))
+	b, err := json.Marshal(m)
+	require.NoError(t, err)
+	var feed struct {
+		Header struct {
+			GtfsRealtimeVersion string `json:"gtfs_realtime_version"`
+			Timestamp           int64  `json:"timestamp"`
+		} `json:"header"`
+		Entity []struct {
+			Id         string `json:"id"`
+			TripUpdate *struct {
+				Trip struct {
+					ScheduleRelationship string `json:"schedule_relationship"`
+				} `json:"trip"`
+				StopTimeUpdate []struct {
+					Departure *struct {
+						Delay int `json:"delay"`
+					} `json:"departure"`
+					ScheduleRelationship string `json:"schedule_relationship"`
+				} `json:"stop_time_update"`
+			} `json:"trip_update"`
+			Alert *struct {
+				Effect string `json:"effect"`
+			} `json:"alert"`
+		} `json:"entity"`
+	}
+	require.NoError(t, json.Unmarshal(b, &feed))
+	require.Equal(t, "2.0", feed.Header.GtfsRealtimeVersion)
+	require.Equal(t, int64(1620040500), feed.Header.Timestamp)
+	require.Len(t, feed.Entity, 4)
+	require.Equal(t, "vehicle_journey:SNCF:2021-05-03:886823:20210503", feed.Entity[0].Id)
+	require.Equal(t, 300, feed.Entity[0].TripUpdate.StopTimeUpdate[0].Departure.Delay)
+	require.Equal(t, "CANCELED", feed.Entity[1].TripUpdate.Trip.ScheduleRelationship)
+	require.Empty(t, feed.Entity[1].TripUpdate.StopTimeUpdate)
+	require.Equal(t, "SIGNIFICANT_DELAYS", feed.Entity[2].Alert.Effect)
+	require.Equal(t, "NO_SERVICE", feed.Entity[3].Alert.Effect)
+	// a train only cancelled at a stop skips it
+	boards := testBoards(paris)
+	boards[1].Departures[1].Disruptions = nil
+	b, err = json.Marshal(NewFeedMessage(time.Date(2021, time.May, 3, 13, 15, 0, 0, paris), boards))
+	require.NoError(t, err)
+	feed.Entity = nil
+	require.NoError(t, json.Unmarshal(b, &feed))
+	require.Equal(t, "", feed.Entity[1].TripUpdate.Trip.ScheduleRelationship)
+	require.Equal(t, "SKIPPED", feed.Entity[1].TripUpdate.StopTimeUpdate[0].ScheduleRelationship)
+	require.Nil(t, feed.Entity[1].TripUpdate.StopTimeUpdate[0].Departure)
+}
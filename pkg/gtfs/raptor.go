@@ -0,0 +1,295 @@
+package gtfs
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// never is the arrival time at the stations that cannot be reached
+const never = math.MaxInt64
+
+// A timetable holds the trips of a few service days in the layout of the RAPTOR algorithm : the trips stopping at the
+// same stations in the same order are grouped in routes, so that a round scans every route once instead of every trip.
+type timetable struct {
+	stations []model.Stop
+	index    map[string]int
+	// stationRoutes lists the routes serving each station, with the position of the station along them
+	stationRoutes [][]routeStop
+	routes        []raptorRoute
+	// pending holds the trips added since the last build, by sequence of stations
+	pending map[string][]raptorTrip
+}
+
+type routeStop struct {
+	route    int
+	position int
+}
+
+// A raptorRoute is a sequence of stations along with the trips serving them, ordered by departure. A trip never
+// overtakes an earlier one on the same route, which lets the earliest trip at a station be found by binary search.
+type raptorRoute struct {
+	stations []int
+	trips    []raptorTrip
+}
+
+// A raptorTrip is a trip of a service day with its times as unix timestamps
+type raptorTrip struct {
+	trip       *ScheduledTrip
+	arrivals   []int64
+	departures []int64
+}
+
+// A leg is the part of a journey spent aboard a trip
+type leg struct {
+	route  *raptorRoute
+	trip   *raptorTrip
+	board  int
+	alight int
+}
+
+// a label records how a station was reached during a round
+type label struct {
+	set    bool
+	route  int
+	trip   int
+	board  int
+	alight int
+}
+
+// newTimetable returns an empty timetable between stations
+func newTimetable(stations []model.Stop) *timetable {
+	tt := &timetable{
+		index:   make(map[string]int),
+		pending: make(map[string][]raptorTrip),
+	}
+	for _, s := range stations {
+		tt.station(s.Id, s.Name)
+	}
+	return tt
+}
+
+// station returns the index of a station, adding it when it is unknown
+func (tt *timetable) station(id string, name string) int {
+	if i, ok := tt.index[id]; ok {
+		return i
+	}
+	tt.index[id] = len(tt.stations)
+	tt.stations = append(tt.stations, model.Stop{Id: id, Name: name})
+	tt.stationRoutes = append(tt.stationRoutes, nil)
+	return len(tt.stations) - 1
+}
+
+// addTrips adds the trips running on a service day, build must be called before querying the timetable
+func (tt *timetable) addTrips(day time.Time, trips []ScheduledTrip) {
+	base := ServiceTime(day, 0).Unix()
+	for i := range trips {
+		st := trips[i].StopTimes
+		if len(st) < 2 {
+			continue
+		}
+		rt := raptorTrip{
+			trip:       &trips[i],
+			arrivals:   make([]int64, len(st)),
+			departures: make([]int64, len(st)),
+		}
+		var key strings.Builder
+		for j := range st {
+			key.WriteString(strconv.Itoa(tt.station(st[j].StopId, st[j].StopId)))
+			key.WriteByte(',')
+			rt.arrivals[j] = base + int64(st[j].Arrival/time.Second)
+			rt.departures[j] = base + int64(st[j].Departure/time.Second)
+		}
+		tt.pending[key.String()] = append(tt.pending[key.String()], rt)
+	}
+}
+
+// build groups the added trips in routes
+func (tt *timetable) build() {
+	// routes are numbered in a stable order so that equally good journeys are always chosen the same way
+	keys := make([]string, 0, len(tt.pending))
+	for key := range tt.pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		trips := tt.pending[key]
+		sort.SliceStable(trips, func(i, j int) bool { return trips[i].departures[0] < trips[j].departures[0] })
+		stations := make([]int, len(trips[0].arrivals))
+		for j, st := range trips[0].trip.StopTimes {
+			stations[j] = tt.index[st.StopId]
+		}
+		// a trip overtaking another one, like an express service, goes on a route of its own
+		first := len(tt.routes)
+		for _, t := range trips {
+			r := first
+			for ; r < len(tt.routes) && overtakes(&t, &tt.routes[r].trips[len(tt.routes[r].trips)-1]); r++ {
+			}
+			if r == len(tt.routes) {
+				tt.routes = append(tt.routes, raptorRoute{stations: stations})
+				for position, s := range stations {
+					tt.stationRoutes[s] = append(tt.stationRoutes[s], routeStop{route: r, position: position})
+				}
+			}
+			tt.routes[r].trips = append(tt.routes[r].trips, t)
+		}
+	}
+	tt.pending = make(map[string][]raptorTrip)
+}
+
+// overtakes returns true if a trip leaving after another one arrives or departs before it somewhere along the route
+func overtakes(t *raptorTrip, previous *raptorTrip) bool {
+	for i := range t.arrivals {
+		if t.arrivals[i] < previous.arrivals[i] || t.departures[i] < previous.departures[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// earliestTrip returns the first trip of a route that can be boarded at a position from a time, -1 if there is none
+func (r *raptorRoute) earliestTrip(position int, ready int64) int {
+	t := sort.Search(len(r.trips), func(i int) bool { return r.trips[i].departures[position] >= ready })
+	for ; t < len(r.trips); t++ {
+		if r.trips[t].trip.StopTimes[position].PickupType != 1 {
+			return t
+		}
+	}
+	return -1
+}
+
+// journeys returns the earliest arrivals at a station when leaving another one at departure, one journey for every
+// number of trips up to maxTrips that arrives before the journeys with fewer trips. Changing trips takes at least
+// transfer seconds.
+func (tt *timetable) journeys(from int, to int, departure int64, maxTrips int, transfer int64) (journeys [][]leg) {
+	n := len(tt.stations)
+	// arrivals[k] are the earliest arrivals with at most k trips, best the earliest with any number of trips
+	arrivals := make([][]int64, maxTrips+1)
+	labels := make([][]label, maxTrips+1)
+	best := make([]int64, n)
+	for i := range best {
+		best[i] = never
+	}
+	arrivals[0] = make([]int64, n)
+	copy(arrivals[0], best)
+	arrivals[0][from] = departure
+	best[from] = departure
+	marked := map[int]bool{from: true}
+	for k := 1; k <= maxTrips && len(marked) > 0; k++ {
+		arrivals[k] = make([]int64, n)
+		copy(arrivals[k], arrivals[k-1])
+		labels[k] = make([]label, n)
+		// only the routes serving the stations improved in the previous round are scanned, from the first of them
+		queue := make(map[int]int)
+		var routes []int
+		for s := range marked {
+			for _, rs := range tt.stationRoutes[s] {
+				if p, ok := queue[rs.route]; !ok {
+					queue[rs.route] = rs.position
+					routes = append(routes, rs.route)
+				} else if rs.position < p {
+					queue[rs.route] = rs.position
+				}
+			}
+		}
+		sort.Ints(routes)
+		marked = make(map[int]bool)
+		for _, r := range routes {
+			route := &tt.routes[r]
+			position := queue[r]
+			trip, board := -1, 0
+			for i := position; i < len(route.stations); i++ {
+				s := route.stations[i]
+				if trip >= 0 && route.trips[trip].trip.StopTimes[i].DropOffType != 1 {
+					arrival := route.trips[trip].arrivals[i]
+					if arrival < best[s] && arrival < best[to] {
+						arrivals[k][s] = arrival
+						best[s] = arrival
+						labels[k][s] = label{set: true, route: r, trip: trip, board: board, alight: i}
+						marked[s] = true
+					}
+				}
+				if arrivals[k-1][s] == never {
+					continue
+				}
+				ready := arrivals[k-1][s]
+				if s != from {
+					ready += transfer
+				}
+				if trip < 0 || ready <= route.trips[trip].departures[i] {
+					if t := route.earliestTrip(i, ready); t >= 0 && (trip < 0 || t < trip) {
+						trip, board = t, i
+					}
+				}
+			}
+		}
+		if labels[k][to].set {
+			journeys = append(journeys, tt.legs(labels, from, to, k))
+		}
+	}
+	return journeys
+}
+
+// legs follows the labels back from the arrival station reached in round k
+func (tt *timetable) legs(labels [][]label, from int, to int, k int) []leg {
+	legs := make([]leg, 0, k)
+	for s := to; s != from; k-- {
+		// a station keeps its arrival time from the round that reached it
+		for !labels[k][s].set {
+			k--
+		}
+		l := labels[k][s]
+		route := &tt.routes[l.route]
+		legs = append(legs, leg{route: route, trip: &route.trips[l.trip], board: l.board, alight: l.alight})
+		s = route.stations[l.board]
+	}
+	for i, j := 0, len(legs)-1; i < j; i, j = i+1, j-1 {
+		legs[i], legs[j] = legs[j], legs[i]
+	}
+	return legs
+}
+
+// journey converts legs to our model, with a transfer and a waiting section between trips like navitia does
+func (tt *timetable) journey(legs []leg, loc *time.Location, transfer time.Duration) model.Journey {
+	at := func(t int64) time.Time { return time.Unix(t, 0).In(loc) }
+	station := func(i int) (string, string) {
+		return stopAreaPrefix + tt.stations[i].Id, tt.stations[i].Name
+	}
+	var j model.Journey
+	for i, l := range legs {
+		fromId, from := station(l.route.stations[l.board])
+		toId, to := station(l.route.stations[l.alight])
+		_, direction := station(l.route.stations[len(l.route.stations)-1])
+		departure, arrival := at(l.trip.departures[l.board]), at(l.trip.arrivals[l.alight])
+		if i > 0 {
+			previous := j.Sections[len(j.Sections)-1].Arrival
+			j.Sections = append(j.Sections, model.Section{Type: model.TransferSection, FromId: fromId, From: from, ToId: fromId, To: from, Departure: previous, Arrival: previous.Add(transfer), Duration: transfer})
+			if wait := departure.Sub(previous.Add(transfer)); wait > 0 {
+				j.Sections = append(j.Sections, model.Section{Type: model.WaitingSection, FromId: fromId, From: from, ToId: fromId, To: from, Departure: previous.Add(transfer), Arrival: departure, Duration: wait})
+			}
+		}
+		j.Sections = append(j.Sections, model.Section{
+			Type:           model.PublicTransportSection,
+			FromId:         fromId,
+			From:           from,
+			ToId:           toId,
+			To:             to,
+			Departure:      departure,
+			Arrival:        arrival,
+			Duration:       arrival.Sub(departure),
+			Line:           l.trip.trip.Line,
+			Direction:      direction,
+			TrainNumber:    l.trip.trip.TrainNumber,
+			CommercialMode: l.trip.trip.CommercialMode,
+		})
+	}
+	j.Departure = j.Sections[0].Departure
+	j.Arrival = j.Sections[len(j.Sections)-1].Arrival
+	j.Duration = j.Arrival.Sub(j.Departure)
+	j.NbTransfers = len(legs) - 1
+	return j
+}
@@ -0,0 +1,250 @@
+package gtfs
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+// testTrip returns a trip calling at stations named by a letter, arriving and leaving at the same times
+func testTrip(id string, stations string, times ...time.Duration) ScheduledTrip {
+	trip := ScheduledTrip{TripId: id, TrainNumber: id, CommercialMode: "TER", Line: "Lyon - Ambérieu"}
+	for i, s := range stations {
+		trip.StopTimes = append(trip.StopTimes, StopTime{TripId: id, StopId: string(s), Sequence: i, Arrival: times[i], Departure: times[i]})
+	}
+	return trip
+}
+
+// testStations are the stations of testTrips
+var testStations = []model.Stop{
+	model.Stop{Id: "A", Name: "Lyon Part Dieu"},
+	model.Stop{Id: "B", Name: "Crépieux-la-Pape"},
+	model.Stop{Id: "C", Name: "Meximieux"},
+	model.Stop{Id: "D", Name: "Ambérieu-en-Bugey"},
+	model.Stop{Id: "E", Name: "Lyon Saint-Exupéry"},
+}
+
+// testTrips is a slow direct train from A to D, and faster trains changing at E
+func testTrips() []ScheduledTrip {
+	h, m := time.Hour, time.Minute
+	return []ScheduledTrip{
+		testTrip("slow", "ABCD", 8*h, 8*h+30*m, 9*h, 10*h),
+		testTrip("fast", "AE", 8*h+5*m, 8*h+20*m),
+		testTrip("tight", "ED", 8*h+22*m, 8*h+50*m),
+		testTrip("connection", "ED", 8*h+30*m, 9*h),
+	}
+}
+
+func testTimetable(day time.Time, trips []ScheduledTrip) *timetable {
+	tt := newTimetable(testStations)
+	tt.addTrips(day, trips)
+	tt.build()
+	return tt
+}
+
+// tripIds returns the trips of every journey
+func tripIds(tt *timetable, journeys [][]leg) (ids [][]string) {
+	for _, legs := range journeys {
+		var trips []string
+		for _, l := range legs {
+			trips = append(trips, fmt.Sprintf("%s %s-%s", l.trip.trip.TripId, tt.stations[l.route.stations[l.board]].Id, tt.stations[l.route.stations[l.alight]].Id))
+		}
+		ids = append(ids, trips)
+	}
+	return
+}
+
+func TestJourneys(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	day := time.Date(2021, time.May, 3, 0, 0, 0, 0, paris)
+	at := func(hour int, min int) int64 { return time.Date(2021, time.May, 3, hour, min, 0, 0, paris).Unix() }
+	tt := testTimetable(day, testTrips())
+	testCases := []struct {
+		name      string
+		from      string
+		to        string
+		departure int64
+		maxTrips  int
+		transfer  time.Duration
+		expected  [][]string
+	}{
+		{"fastest for every number of trips", "A", "D", at(7, 50), 3, 5 * time.Minute, [][]string{
+			[]string{"slow A-D"},
+			[]string{"fast A-E", "connection E-D"},
+		}},
+		{"no transfer time", "A", "D", at(7, 50), 3, 0, [][]string{
+			[]string{"slow A-D"},
+			[]string{"fast A-E", "tight E-D"},
+		}},
+		{"max transfers", "A", "D", at(7, 50), 1, 5 * time.Minute, [][]string{
+			[]string{"slow A-D"},
+		}},
+		{"the direct train left", "A", "D", at(8, 1), 3, 5 * time.Minute, [][]string{
+			[]string{"fast A-E", "connection E-D"},
+		}},
+		{"intermediate station", "B", "C", at(7, 50), 3, 5 * time.Minute, [][]string{
+			[]string{"slow B-C"},
+		}},
+		{"backwards", "D", "A", at(7, 50), 3, 5 * time.Minute, nil},
+		{"too late", "A", "D", at(9, 0), 3, 5 * time.Minute, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			journeys := tt.journeys(tt.index[tc.from], tt.index[tc.to], tc.departure, tc.maxTrips, int64(tc.transfer/time.Second))
+			require.Equal(t, tc.expected, tripIds(tt, journeys))
+		})
+	}
+}
+
+func TestJourneysOvertaking(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	day := time.Date(2021, time.May, 3, 0, 0, 0, 0, paris)
+	h, m := time.Hour, time.Minute
+	tt := testTimetable(day, []ScheduledTrip{
+		testTrip("slow", "ABCD", 8*h, 8*h+30*m, 9*h, 10*h),
+		testTrip("express", "ABCD", 8*h+10*m, 8*h+20*m, 8*h+30*m, 8*h+40*m),
+	})
+	require.Len(t, tt.routes, 2)
+	journeys := tt.journeys(tt.index["A"], tt.index["D"], time.Date(2021, time.May, 3, 7, 0, 0, 0, paris).Unix(), 3, 0)
+	require.Equal(t, [][]string{[]string{"express A-D"}}, tripIds(tt, journeys))
+}
+
+func TestJourneysPickupAndDropOff(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	day := time.Date(2021, time.May, 3, 0, 0, 0, 0, paris)
+	trips := testTrips()
+	// the fast train does not drop off at E and the connection does not pick up there
+	trips[1].StopTimes[1].DropOffType = 1
+	trips[3].StopTimes[0].PickupType = 1
+	tt := testTimetable(day, trips)
+	journeys := tt.journeys(tt.index["A"], tt.index["D"], time.Date(2021, time.May, 3, 7, 50, 0, 0, paris).Unix(), 3, 0)
+	require.Equal(t, [][]string{[]string{"slow A-D"}}, tripIds(tt, journeys))
+	trips[1].StopTimes[1].DropOffType = 0
+	tt = testTimetable(day, trips)
+	journeys = tt.journeys(tt.index["A"], tt.index["D"], time.Date(2021, time.May, 3, 7, 50, 0, 0, paris).Unix(), 3, 5*60)
+	require.Equal(t, [][]string{[]string{"slow A-D"}}, tripIds(tt, journeys))
+}
+
+func TestJourneysAcrossServiceDays(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	h, m := time.Hour, time.Minute
+	tt := newTimetable(testStations)
+	// a night train of may 2nd still running on may 3rd, and the first train of may 3rd
+	tt.addTrips(time.Date(2021, time.May, 2, 0, 0, 0, 0, paris), []ScheduledTrip{testTrip("night", "AD", 24*h+10*m, 25*h)})
+	tt.addTrips(time.Date(2021, time.May, 3, 0, 0, 0, 0, paris), []ScheduledTrip{testTrip("night", "AD", 24*h+10*m, 25*h), testTrip("morning", "AD", 6*h, 7*h)})
+	tt.build()
+	journeys := tt.journeys(tt.index["A"], tt.index["D"], time.Date(2021, time.May, 3, 0, 0, 0, 0, paris).Unix(), 3, 0)
+	require.Equal(t, [][]string{[]string{"night A-D"}}, tripIds(tt, journeys))
+	require.Equal(t, time.Date(2021, time.May, 3, 1, 0, 0, 0, paris).Unix(), journeys[0][0].trip.arrivals[1])
+	journeys = tt.journeys(tt.index["A"], tt.index["D"], time.Date(2021, time.May, 3, 1, 0, 0, 0, paris).Unix(), 3, 0)
+	require.Equal(t, [][]string{[]string{"morning A-D"}}, tripIds(tt, journeys))
+}
+
+func TestJourney(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	day := time.Date(2021, time.May, 3, 0, 0, 0, 0, paris)
+	at := func(hour int, min int) time.Time { return time.Date(2021, time.May, 3, hour, min, 0, 0, paris) }
+	tt := testTimetable(day, testTrips())
+	journeys := tt.journeys(tt.index["A"], tt.index["D"], at(7, 50).Unix(), 3, 5*60)
+	require.Len(t, journeys, 2)
+	require.Equal(t, model.Journey{
+		Departure:   at(8, 5),
+		Arrival:     at(9, 0),
+		Duration:    55 * time.Minute,
+		NbTransfers: 1,
+		Sections: []model.Section{
+			model.Section{Type: model.PublicTransportSection, FromId: "stop_area:A", From: "Lyon Part Dieu", ToId: "stop_area:E", To: "Lyon Saint-Exupéry", Departure: at(8, 5), Arrival: at(8, 20), Duration: 15 * time.Minute, Line: "Lyon - Ambérieu", Direction: "Lyon Saint-Exupéry", TrainNumber: "fast", CommercialMode: "TER"},
+			model.Section{Type: model.TransferSection, FromId: "stop_area:E", From: "Lyon Saint-Exupéry", ToId: "stop_area:E", To: "Lyon Saint-Exupéry", Departure: at(8, 20), Arrival: at(8, 25), Duration: 5 * time.Minute},
+			model.Section{Type: model.WaitingSection, FromId: "stop_area:E", From: "Lyon Saint-Exupéry", ToId: "stop_area:E", To: "Lyon Saint-Exupéry", Departure: at(8, 25), Arrival: at(8, 30), Duration: 5 * time.Minute},
+			model.Section{Type: model.PublicTransportSection, FromId: "stop_area:E", From: "Lyon Saint-Exupéry", ToId: "stop_area:D", To: "Ambérieu-en-Bugey", Departure: at(8, 30), Arrival: at(9, 0), Duration: 30 * time.Minute, Line: "Lyon - Ambérieu", Direction: "Ambérieu-en-Bugey", TrainNumber: "connection", CommercialMode: "TER"},
+		},
+	}, tt.journey(journeys[1], paris, 5*time.Minute))
+}
+
+// generateNetwork returns a network the size of a regional one : 3000 stations on a grid, crossed by 200 lines of 10
+// to 40 stations served in both directions every 15 to 60 minutes from 5am to 11pm, for about 14000 trips a day
+func generateNetwork() ([]model.Stop, []ScheduledTrip) {
+	const width, height = 60, 50
+	r := rand.New(rand.NewSource(1))
+	var stations []model.Stop
+	for i := 0; i < width*height; i++ {
+		stations = append(stations, model.Stop{Id: fmt.Sprintf("StopArea:%d", i), Name: fmt.Sprintf("Station %d", i)})
+	}
+	var trips []ScheduledTrip
+	for line := 0; line < 200; line++ {
+		// lines are random walks over the grid, so that they cross each other
+		x, y := r.Intn(width), r.Intn(height)
+		var stops []int
+		var runs []time.Duration
+		for n := 10 + r.Intn(31); len(stops) < n; {
+			stops = append(stops, y*width+x)
+			runs = append(runs, time.Duration(2+r.Intn(5))*time.Minute)
+			switch r.Intn(4) {
+			case 0:
+				x = (x + 1) % width
+			case 1:
+				x = (x + width - 1) % width
+			case 2:
+				y = (y + 1) % height
+			default:
+				y = (y + height - 1) % height
+			}
+		}
+		headway := time.Duration(15+r.Intn(46)) * time.Minute
+		for direction := 0; direction < 2; direction++ {
+			for start := 5 * time.Hour; start < 23*time.Hour; start += headway {
+				id := fmt.Sprintf("line%d-%d-%s", line, direction, start)
+				trip := ScheduledTrip{TripId: id, TrainNumber: id, CommercialMode: "TER"}
+				t := start
+				for i := range stops {
+					s := stops[i]
+					if direction == 1 {
+						s = stops[len(stops)-1-i]
+					}
+					trip.StopTimes = append(trip.StopTimes, StopTime{TripId: id, StopId: stations[s].Id, Sequence: i, Arrival: t, Departure: t + time.Minute})
+					t += time.Minute + runs[i]
+				}
+				trips = append(trips, trip)
+			}
+		}
+	}
+	return stations, trips
+}
+
+func BenchmarkTimetable(b *testing.B) {
+	stations, trips := generateNetwork()
+	day := time.Date(2021, time.May, 3, 0, 0, 0, 0, time.UTC)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tt := newTimetable(stations)
+		for d := -1; d <= 1; d++ {
+			tt.addTrips(day.AddDate(0, 0, d), trips)
+		}
+		tt.build()
+	}
+}
+
+func BenchmarkJourneys(b *testing.B) {
+	stations, trips := generateNetwork()
+	day := time.Date(2021, time.May, 3, 0, 0, 0, 0, time.UTC)
+	tt := newTimetable(stations)
+	for d := -1; d <= 1; d++ {
+		tt.addTrips(day.AddDate(0, 0, d), trips)
+	}
+	tt.build()
+	r := rand.New(rand.NewSource(1))
+	departure := day.Add(8 * time.Hour).Unix()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tt.journeys(r.Intn(len(stations)), r.Intn(len(stations)), departure, maxTransfers+1, 5*60)
+	}
+}
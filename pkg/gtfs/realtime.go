@@ -0,0 +1,262 @@
+package gtfs
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Trip schedule relationships of the GTFS-RT specification
+const (
+	tripCanceled = 3
+	tripDeleted  = 7
+)
+
+// Stop time schedule relationships of the GTFS-RT specification
+const (
+	stopSkipped = 1
+	stopNoData  = 2
+)
+
+// A FeedMessage is a GTFS-RT feed. Only its trip updates are decoded, alerts are only published.
+type FeedMessage struct {
+	Timestamp   time.Time
+	TripUpdates []TripUpdate
+	Alerts      []Alert
+}
+
+// A TripUpdate gives the real-time progress of a trip
+type TripUpdate struct {
+	TripId string
+	// StartDate is the service day of the trip like 20210503, empty when the feed does not say
+	StartDate string
+	Cancelled bool
+	// Delay applies to the stops without a stop time update, when HasDelay is set
+	Delay           time.Duration
+	HasDelay        bool
+	StopTimeUpdates []StopTimeUpdate
+}
+
+// A StopTimeUpdate gives the real-time arrival and departure of a trip at a stop. It also applies to the following
+// stops unless they have their own update.
+type StopTimeUpdate struct {
+	// StopSequence is -1 when the update only gives the stop id
+	StopSequence int
+	StopId       string
+	Skipped      bool
+	// NoData means there is no real-time information for this stop, the schedule applies
+	NoData    bool
+	Arrival   StopTimeEvent
+	Departure StopTimeEvent
+}
+
+// A StopTimeEvent is either an absolute time or a delay from the schedule, or both
+type StopTimeEvent struct {
+	Time     time.Time
+	Delay    time.Duration
+	HasDelay bool
+}
+
+// known returns true if the event carries any information
+func (e StopTimeEvent) known() bool {
+	return e.HasDelay || !e.Time.IsZero()
+}
+
+// at returns the real-time time of an event scheduled at base
+func (e StopTimeEvent) at(base time.Time) time.Time {
+	if !e.Time.IsZero() {
+		return e.Time
+	}
+	return base.Add(e.Delay)
+}
+
+// apply updates a scheduled departure with the real-time information of its trip
+func (tu *TripUpdate) apply(sd *ScheduledDeparture) {
+	if tu.StartDate != "" && tu.StartDate != sd.ServiceDay {
+		return
+	}
+	d := &sd.Departure
+	if tu.Cancelled {
+		d.Cancelled = true
+		d.RealTime = true
+		return
+	}
+	// the update of the stop itself wins, otherwise the delay of the last update before it propagates
+	var exact, previous *StopTimeUpdate
+	for i := range tu.StopTimeUpdates {
+		stu := &tu.StopTimeUpdates[i]
+		if stu.StopSequence == sd.StopSequence || stu.StopSequence < 0 && stu.StopId == sd.StopId {
+			exact = stu
+		} else if stu.StopSequence >= 0 && stu.StopSequence < sd.StopSequence && (previous == nil || stu.StopSequence > previous.StopSequence) {
+			previous = stu
+		}
+	}
+	switch {
+	case exact != nil:
+		if exact.NoData {
+			return
+		}
+		if exact.Skipped {
+			d.Cancelled = true
+			break
+		}
+		arrival, departure := exact.Arrival, exact.Departure
+		if !departure.known() {
+			departure = StopTimeEvent{Delay: arrival.Delay, HasDelay: arrival.HasDelay}
+		}
+		if !arrival.known() {
+			arrival = StopTimeEvent{Delay: departure.Delay, HasDelay: departure.HasDelay}
+		}
+		if !arrival.known() && !departure.known() {
+			return
+		}
+		d.Arrival = arrival.at(d.BaseArrival)
+		d.Departure = departure.at(d.BaseDeparture)
+	case previous != nil && !previous.NoData && !previous.Skipped && (previous.Departure.HasDelay || previous.Arrival.HasDelay):
+		delay := previous.Arrival.Delay
+		if previous.Departure.HasDelay {
+			delay = previous.Departure.Delay
+		}
+		d.Arrival = d.BaseArrival.Add(delay)
+		d.Departure = d.BaseDeparture.Add(delay)
+	case tu.HasDelay:
+		d.Arrival = d.BaseArrival.Add(tu.Delay)
+		d.Departure = d.BaseDeparture.Add(tu.Delay)
+	default:
+		return
+	}
+	d.Delay = d.Departure.Sub(d.BaseDeparture)
+	d.RealTime = true
+}
+
+// DecodeFeedMessage decodes a GTFS-RT protobuf feed. Unknown fields, vehicle positions and alerts are skipped.
+func DecodeFeedMessage(b []byte) (*FeedMessage, error) {
+	var m FeedMessage
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+				if num == 3 && typ == protowire.VarintType {
+					m.Timestamp = time.Unix(int64(n), 0)
+				}
+				return nil
+			})
+		case num == 2 && typ == protowire.BytesType:
+			return decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+				if num == 3 && typ == protowire.BytesType {
+					tu, err := decodeTripUpdate(v)
+					if err != nil {
+						return err
+					}
+					m.TripUpdates = append(m.TripUpdates, *tu)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func decodeTripUpdate(b []byte) (*TripUpdate, error) {
+	var tu TripUpdate
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			return decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					tu.TripId = string(v)
+				case num == 3 && typ == protowire.BytesType:
+					tu.StartDate = string(v)
+				case num == 4 && typ == protowire.VarintType:
+					tu.Cancelled = n == tripCanceled || n == tripDeleted
+				}
+				return nil
+			})
+		case num == 2 && typ == protowire.BytesType:
+			stu, err := decodeStopTimeUpdate(v)
+			if err != nil {
+				return err
+			}
+			tu.StopTimeUpdates = append(tu.StopTimeUpdates, *stu)
+		case num == 5 && typ == protowire.VarintType:
+			tu.Delay = time.Duration(int32(n)) * time.Second
+			tu.HasDelay = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tu, nil
+}
+
+func decodeStopTimeUpdate(b []byte) (*StopTimeUpdate, error) {
+	stu := StopTimeUpdate{StopSequence: -1}
+	err := decodeMessage(b, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			stu.StopSequence = int(n)
+		case (num == 2 || num == 3) && typ == protowire.BytesType:
+			event := &stu.Arrival
+			if num == 3 {
+				event = &stu.Departure
+			}
+			return decodeMessage(v, func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error {
+				switch {
+				case num == 1 && typ == protowire.VarintType:
+					event.Delay = time.Duration(int32(n)) * time.Second
+					event.HasDelay = true
+				case num == 2 && typ == protowire.VarintType:
+					event.Time = time.Unix(int64(n), 0)
+				}
+				return nil
+			})
+		case num == 4 && typ == protowire.BytesType:
+			stu.StopId = string(v)
+		case num == 5 && typ == protowire.VarintType:
+			stu.Skipped = n == stopSkipped
+			stu.NoData = n == stopNoData
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stu, nil
+}
+
+// decodeMessage calls field for every field of a protobuf message, with its raw bytes for length delimited fields or
+// its value for varints
+func decodeMessage(b []byte, field func(num protowire.Number, typ protowire.Type, v []byte, n uint64) error) error {
+	for len(b) > 0 {
+		num, typ, l := protowire.ConsumeTag(b)
+		if l < 0 {
+			return newDecodeError(protowire.ParseError(l))
+		}
+		b = b[l:]
+		var v []byte
+		var n uint64
+		switch typ {
+		case protowire.VarintType:
+			n, l = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			v, l = protowire.ConsumeBytes(b)
+		default:
+			l = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if l < 0 {
+			return newDecodeError(fmt.Errorf("field %d : %w", num, protowire.ParseError(l)))
+		}
+		b = b[l:]
+		if err := field(num, typ, v, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package gtfs
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeFeedMessage(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	b, err := ioutil.ReadFile("test_data/trip-updates.pb")
+	require.NoError(t, err)
+	m, err := DecodeFeedMessage(b)
+	require.NoError(t, err)
+	require.True(t, time.Date(2021, time.May, 3, 13, 15, 0, 0, paris).Equal(m.Timestamp))
+	// vehicle positions and alerts are skipped
+	require.Len(t, m.TripUpdates, 4)
+	require.Equal(t, "OCESN886823F0100110", m.TripUpdates[0].TripId)
+	require.Equal(t, "20210503", m.TripUpdates[0].StartDate)
+	require.False(t, m.TripUpdates[0].Cancelled)
+	require.Len(t, m.TripUpdates[0].StopTimeUpdates, 2)
+	departure := m.TripUpdates[0].StopTimeUpdates[0]
+	require.Equal(t, 0, departure.StopSequence)
+	require.Equal(t, "StopPoint:OCETrain TER-87723197", departure.StopId)
+	require.Equal(t, 5*time.Minute, departure.Departure.Delay)
+	require.True(t, departure.Departure.HasDelay)
+	require.True(t, time.Date(2021, time.May, 3, 13, 13, 0, 0, paris).Equal(departure.Departure.Time))
+	require.False(t, departure.Arrival.known())
+	require.Equal(t, 7*time.Minute, m.TripUpdates[0].StopTimeUpdates[1].Arrival.Delay)
+	require.True(t, m.TripUpdates[1].Cancelled)
+	require.Equal(t, TripUpdate{
+		TripId:   "OCESN886825F0200220",
+		Delay:    2 * time.Minute,
+		HasDelay: true,
+		StopTimeUpdates: []StopTimeUpdate{
+			StopTimeUpdate{StopSequence: -1, StopId: "StopPoint:OCETrain TER-87723502", Skipped: true},
+		},
+	}, m.TripUpdates[2])
+	// negative delays are trains running early
+	require.Equal(t, -time.Minute, m.TripUpdates[3].StopTimeUpdates[0].Departure.Delay)
+}
+
+func TestDecodeFeedMessageErrors(t *testing.T) {
+	b, err := ioutil.ReadFile("test_data/invalid.pb")
+	require.NoError(t, err)
+	_, err = DecodeFeedMessage(b)
+	requireErrorTypeMatch(t, err, DecodeError{})
+	_, err = DecodeFeedMessage([]byte{0xff})
+	requireErrorTypeMatch(t, err, DecodeError{})
+}
+
+func TestApply(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	at := func(hour int, min int) time.Time { return time.Date(2021, time.May, 3, hour, min, 0, 0, paris) }
+	scheduled := ScheduledDeparture{
+		Departure:    model.Departure{BaseArrival: at(13, 17), Arrival: at(13, 17), BaseDeparture: at(13, 18), Departure: at(13, 18)},
+		TripId:       "OCESN886823F0100110",
+		StopId:       "StopPoint:OCETrain TER-87723502",
+		StopSequence: 1,
+		ServiceDay:   "20210503",
+	}
+	delayed := func(arrival time.Time, departure time.Time) model.Departure {
+		return model.Departure{BaseArrival: at(13, 17), Arrival: arrival, BaseDeparture: at(13, 18), Departure: departure, Delay: departure.Sub(at(13, 18)), RealTime: true}
+	}
+	testCases := []struct {
+		name     string
+		update   TripUpdate
+		expected model.Departure
+	}{
+		{"other day", TripUpdate{StartDate: "20210504", Cancelled: true}, scheduled.Departure},
+		{"cancelled trip", TripUpdate{StartDate: "20210503", Cancelled: true}, model.Departure{BaseArrival: at(13, 17), Arrival: at(13, 17), BaseDeparture: at(13, 18), Departure: at(13, 18), Cancelled: true, RealTime: true}},
+		{"skipped stop", TripUpdate{StopTimeUpdates: []StopTimeUpdate{
+			StopTimeUpdate{StopSequence: -1, StopId: "StopPoint:OCETrain TER-87723502", Skipped: true},
+		}}, model.Departure{BaseArrival: at(13, 17), Arrival: at(13, 17), BaseDeparture: at(13, 18), Departure: at(13, 18), Cancelled: true, RealTime: true}},
+		{"absolute times", TripUpdate{StopTimeUpdates: []StopTimeUpdate{
+			StopTimeUpdate{StopSequence: 1, Arrival: StopTimeEvent{Time: at(13, 20)}, Departure: StopTimeEvent{Time: at(13, 22)}},
+		}}, delayed(at(13, 20), at(13, 22))},
+		{"arrival delay only", TripUpdate{StopTimeUpdates: []StopTimeUpdate{
+			StopTimeUpdate{StopSequence: 1, Arrival: StopTimeEvent{Delay: 3 * time.Minute, HasDelay: true}},
+		}}, delayed(at(13, 20), at(13, 21))},
+		{"no data", TripUpdate{Delay: time.Minute, HasDelay: true, StopTimeUpdates: []StopTimeUpdate{
+			StopTimeUpdate{StopSequence: 1, NoData: true},
+		}}, scheduled.Departure},
+		{"empty stop update", TripUpdate{StopTimeUpdates: []StopTimeUpdate{StopTimeUpdate{StopSequence: 1}}}, scheduled.Departure},
+		{"propagated delay", TripUpdate{StopTimeUpdates: []StopTimeUpdate{
+			StopTimeUpdate{StopSequence: 0, Arrival: StopTimeEvent{Delay: time.Minute, HasDelay: true}, Departure: StopTimeEvent{Delay: 4 * time.Minute, HasDelay: true}},
+			StopTimeUpdate{StopSequence: 2, Arrival: StopTimeEvent{Delay: 10 * time.Minute, HasDelay: true}},
+		}}, delayed(at(13, 21), at(13, 22))},
+		{"trip delay", TripUpdate{Delay: 2 * time.Minute, HasDelay: true, StopTimeUpdates: []StopTimeUpdate{
+			StopTimeUpdate{StopSequence: 0, Departure: StopTimeEvent{Time: at(13, 10)}},
+		}}, delayed(at(13, 19), at(13, 20))},
+		{"no update", TripUpdate{StartDate: "20210503"}, scheduled.Departure},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := scheduled
+			tc.update.apply(&d)
+			require.Equal(t, tc.expected, d.Departure)
+		})
+	}
+}
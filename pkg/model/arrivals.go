@@ -0,0 +1,37 @@
+package model
+
+import "time"
+
+type Arrival struct {
+	Origin         string
+	TrainNumber    string
+	CommercialMode string
+	// VehicleJourney is the id of the train, to follow it along its journey
+	VehicleJourney string
+	// BaseArrival is the planned schedule, Arrival includes real-time updates when available
+	BaseArrival time.Time
+	Arrival     time.Time
+	// Delay is the difference between the real-time and the planned arrival
+	Delay     time.Duration
+	RealTime  bool
+	Cancelled bool
+	// Disruptions are the disruptions affecting this train or its arrival stop
+	Disruptions []Disruption
+}
+
+// Delayed returns true if the train is expected to arrive at least a minute late
+func (a Arrival) Delayed() bool {
+	return a.Delay >= time.Minute
+}
+
+// DelayMinutes returns the delay rounded down to the minute, for display purposes
+func (a Arrival) DelayMinutes() int {
+	return int(a.Delay / time.Minute)
+}
+
+// In returns the arrival with its times expressed in another timezone
+func (a Arrival) In(loc *time.Location) Arrival {
+	a.BaseArrival = a.BaseArrival.In(loc)
+	a.Arrival = a.Arrival.In(loc)
+	return a
+}
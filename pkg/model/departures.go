@@ -1,6 +1,44 @@
 package model
 
+import "time"
+
 type Departure struct {
-	Direction string
-	Arrival   string
+	Direction      string
+	TrainNumber    string
+	CommercialMode string
+	// Line is the id of the line of the train, LineName its name for display purposes
+	Line     string
+	LineName string
+	// VehicleJourney is the id of the train, to follow it along its journey
+	VehicleJourney string
+	// Base times are the planned schedule, the other ones include real-time updates when available
+	BaseDeparture time.Time
+	Departure     time.Time
+	BaseArrival   time.Time
+	Arrival       time.Time
+	// Delay is the difference between the real-time and the planned departure
+	Delay     time.Duration
+	RealTime  bool
+	Cancelled bool
+	// Disruptions are the disruptions affecting this train or its departure stop
+	Disruptions []Disruption
+}
+
+// Delayed returns true if the train is expected to leave at least a minute late
+func (d Departure) Delayed() bool {
+	return d.Delay >= time.Minute
+}
+
+// DelayMinutes returns the delay rounded down to the minute, for display purposes
+func (d Departure) DelayMinutes() int {
+	return int(d.Delay / time.Minute)
+}
+
+// In returns the departure with its times expressed in another timezone
+func (d Departure) In(loc *time.Location) Departure {
+	d.BaseDeparture = d.BaseDeparture.In(loc)
+	d.Departure = d.Departure.In(loc)
+	d.BaseArrival = d.BaseArrival.In(loc)
+	d.Arrival = d.Arrival.In(loc)
+	return d
 }
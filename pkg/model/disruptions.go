@@ -0,0 +1,75 @@
+package model
+
+import "time"
+
+type Disruption struct {
+	Id string
+	// Status is either past, active or future
+	Status             string
+	Cause              string
+	Category           string
+	Severity           Severity
+	Messages           []string
+	ApplicationPeriods []Period
+	ImpactedObjects    []ImpactedObject
+	UpdatedAt          time.Time
+}
+
+type Severity struct {
+	Name string
+	// Effect is the GTFS-RT like effect of the disruption, for example NO_SERVICE or SIGNIFICANT_DELAYS
+	Effect   string
+	Color    string
+	Priority int
+}
+
+type Period struct {
+	Begin time.Time
+	End   time.Time
+}
+
+type ImpactedObject struct {
+	Id string
+	// Type is the kind of object impacted : trip, line, stop_area, network, etc.
+	Type          string
+	Name          string
+	ImpactedStops []ImpactedStop
+}
+
+type ImpactedStop struct {
+	StopPointId string
+	Name        string
+	// Statuses are one of added, deleted, delayed or unchanged
+	ArrivalStatus   string
+	DepartureStatus string
+	Cause           string
+}
+
+// NoService returns true if the disruption cancels the whole service of the objects it impacts
+func (d Disruption) NoService() bool {
+	return d.Severity.Effect == "NO_SERVICE"
+}
+
+// DeletesDepartureFrom returns true if the disruption removes the departure from the given stop point
+func (d Disruption) DeletesDepartureFrom(stopPointId string) bool {
+	for _, o := range d.ImpactedObjects {
+		for _, s := range o.ImpactedStops {
+			if s.StopPointId == stopPointId && s.DepartureStatus == "deleted" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DeletesArrivalAt returns true if the disruption removes the arrival at the given stop point
+func (d Disruption) DeletesArrivalAt(stopPointId string) bool {
+	for _, o := range d.ImpactedObjects {
+		for _, s := range o.ImpactedStops {
+			if s.StopPointId == stopPointId && s.ArrivalStatus == "deleted" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+type SectionType string
+
+const (
+	PublicTransportSection SectionType = "public_transport"
+	TransferSection        SectionType = "transfer"
+	WaitingSection         SectionType = "waiting"
+	WalkingSection         SectionType = "walking"
+)
+
+type Journey struct {
+	Departure   time.Time
+	Arrival     time.Time
+	Duration    time.Duration
+	NbTransfers int
+	Sections    []Section
+}
+
+type Section struct {
+	Type      SectionType
+	FromId    string
+	From      string
+	ToId      string
+	To        string
+	Departure time.Time
+	Arrival   time.Time
+	Duration  time.Duration
+	// The following fields are only set for public transport sections
+	Line           string
+	Direction      string
+	TrainNumber    string
+	CommercialMode string
+}
@@ -0,0 +1,22 @@
+package model
+
+// A Line is a commercial line, like a TER line between two cities
+type Line struct {
+	Id   string
+	Name string
+	Code string
+	// Colors are hexadecimal rgb values without the leading #, like FF0000
+	Color          string
+	TextColor      string
+	Network        string
+	CommercialMode string
+}
+
+// A Route is one direction of a line
+type Route struct {
+	Id        string
+	Direction string
+	Line      Line
+	// Stops are the stops of the route in the order trains call at them
+	Stops []Stop
+}
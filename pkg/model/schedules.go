@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// A Schedule is the planned timetable of a route at a stop
+type Schedule struct {
+	Route          string
+	Line           string
+	CommercialMode string
+	Direction      string
+	// Departures are the planned departure times of the trains of the route, in chronological order
+	Departures []time.Time
+}
+
+// In returns the schedule with its times expressed in another timezone
+func (s Schedule) In(loc *time.Location) Schedule {
+	departures := make([]time.Time, len(s.Departures))
+	for i, d := range s.Departures {
+		departures[i] = d.In(loc)
+	}
+	s.Departures = departures
+	return s
+}
@@ -1,6 +1,73 @@
 package model
 
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
 type Stop struct {
 	Id   string
 	Name string
+	// Coverage is the navitia coverage region the stop is queried from
+	Coverage string
+	// Uic is the international railway code of the station, empty for the stops outside the railway network
+	Uic string
+	// City is the label of the town of the stop, like "Abancourt (60220)"
+	City string
+	// Timezone is the IANA timezone of the stop, like Europe/Paris
+	Timezone string
+	// Coord is the location of the stop, nil when navitia does not know it
+	Coord *Coord
+}
+
+// Location returns the timezone of the stop, or UTC when it is unknown like navitia does for the responses without
+// timezone. It never depends on the timezone of the server.
+func (s Stop) Location() *time.Location {
+	if s.Timezone != "" {
+		if loc, err := time.LoadLocation(s.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// Coord is a WGS84 location, in degrees
+type Coord struct {
+	Lat float64
+	Lon float64
+}
+
+// ParseCoord validates a latitude and a longitude in degrees, rejecting the values out of range, infinite or not a
+// number
+func ParseCoord(lat string, lon string) (*Coord, error) {
+	la, err := strconv.ParseFloat(lat, 64)
+	if err != nil || math.IsNaN(la) || la < -90 || la > 90 {
+		return nil, fmt.Errorf("Invalid latitude")
+	}
+	lo, err := strconv.ParseFloat(lon, 64)
+	if err != nil || math.IsNaN(lo) || lo < -180 || lo > 180 {
+		return nil, fmt.Errorf("Invalid longitude")
+	}
+	return &Coord{Lat: la, Lon: lo}, nil
+}
+
+// earthRadius is the mean radius of the earth in meters
+const earthRadius = 6371008.8
+
+// Distance returns the great-circle distance in meters between two locations
+func (c Coord) Distance(o Coord) float64 {
+	lat1 := c.Lat * math.Pi / 180
+	lat2 := o.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (o.Lon - c.Lon) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// NearbyStop is a stop along with its distance in meters from a location
+type NearbyStop struct {
+	Stop
+	Distance float64
 }
@@ -0,0 +1,62 @@
+package model
+
+import "time"
+
+// A VehicleJourney is a train running on a given day, with every stop it calls at
+type VehicleJourney struct {
+	Id          string
+	TrainNumber string
+	StopTimes   []StopTime
+	// Disruptions are the disruptions affecting this train on that day
+	Disruptions []Disruption
+}
+
+// A StopTime is a call of a train at a stop
+type StopTime struct {
+	StopPointId string
+	StopAreaId  string
+	Name        string
+	// Base times are the planned schedule, the other ones include real-time updates when available
+	BaseArrival   time.Time
+	Arrival       time.Time
+	BaseDeparture time.Time
+	Departure     time.Time
+	// Cancelled is true when the train no longer calls at this stop
+	Cancelled bool
+}
+
+// Delayed returns true if the train is expected at least a minute late at this stop
+func (s StopTime) Delayed() bool {
+	return s.Arrival.Sub(s.BaseArrival) >= time.Minute || s.Departure.Sub(s.BaseDeparture) >= time.Minute
+}
+
+// In returns the vehicle journey with its times expressed in another timezone
+func (vj VehicleJourney) In(loc *time.Location) VehicleJourney {
+	stopTimes := make([]StopTime, len(vj.StopTimes))
+	for i, s := range vj.StopTimes {
+		s.BaseArrival = s.BaseArrival.In(loc)
+		s.Arrival = s.Arrival.In(loc)
+		s.BaseDeparture = s.BaseDeparture.In(loc)
+		s.Departure = s.Departure.In(loc)
+		stopTimes[i] = s
+	}
+	vj.StopTimes = stopTimes
+	return vj
+}
+
+// Position locates the train at a given time from its real-time schedule : it returns the index of the last stop
+// it reached, -1 if it has not left yet, and whether it is still standing there. Cancelled stops are ignored.
+func (vj VehicleJourney) Position(now time.Time) (stop int, standing bool) {
+	stop = -1
+	for i, s := range vj.StopTimes {
+		if s.Cancelled {
+			continue
+		}
+		if now.Before(s.Arrival) {
+			break
+		}
+		stop = i
+		standing = now.Before(s.Departure)
+	}
+	return
+}
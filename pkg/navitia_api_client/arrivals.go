@@ -0,0 +1,150 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// maxOriginLookups bounds the concurrent vehicle journey requests made to find the origins of the arrivals of a board
+const maxOriginLookups = 4
+
+type ArrivalsResponse struct {
+	Pagination  Pagination    `json:"pagination"`
+	Disruptions []Disruption  `json:"disruptions"`
+	Notes       []interface{} `json:"notes"`
+	Arrivals    []Passage     `json:"arrivals"`
+	Context     struct {
+		Timezone        string `json:"timezone"`
+		CurrentDatetime string `json:"current_datetime"`
+	} `json:"context"`
+}
+
+// GetArrivals returns the arrivals of a stop, following the result pages as needed by the options
+func (c *NavitiaClient) GetArrivals(ctx context.Context, coverage string, stop string, options BoardOptions) (arrivals []model.Arrival, err error) {
+	base := fmt.Sprintf("%s/coverage/%s/stop_areas/%s/arrivals", c.baseURL, c.coverage(coverage), stop)
+	request := boardRequest(base, options, 0)
+	result, err := c.cache.get(ctx, request, c.departuresTTL, func(ctx context.Context) (interface{}, error) {
+		fetchedAt := time.Now()
+		var arrivals []model.Arrival
+		for page := 0; ; page++ {
+			var data ArrivalsResponse
+			if err := c.get(ctx, boardRequest(base, options, page), "GetArrivals "+stop, &data); err != nil {
+				return nil, err
+			}
+			pageOfArrivals, err := data.arrivals()
+			if err != nil {
+				return nil, err
+			}
+			arrivals = append(arrivals, pageOfArrivals...)
+			if !options.more(len(arrivals), data.Pagination, page) {
+				break
+			}
+		}
+		if options.Count > 0 && len(arrivals) > options.Count {
+			arrivals = arrivals[:options.Count]
+		}
+		if err := c.lookupOrigins(ctx, coverage, arrivals); err != nil {
+			return nil, err
+		}
+		if c.boards != nil && options.From.IsZero() {
+			if err := c.boards.SaveArrivals(ctx, stop, arrivals, fetchedAt); err != nil {
+				log.Printf("Could not save arrivals of %s : %+v", stop, err)
+			}
+		}
+		return arrivals, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]model.Arrival), nil
+}
+
+// lookupOrigins fills the origin of the arrivals whose route did not give one with the first stop of their vehicle
+// journey. The lookups run concurrently, at most maxOriginLookups at once, and are cached for long since the stops of a
+// train seldom change. An origin that cannot be looked up is left empty, only a done context fails the board.
+func (c *NavitiaClient) lookupOrigins(ctx context.Context, coverage string, arrivals []model.Arrival) error {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, a := range arrivals {
+		if a.Origin == "" && a.VehicleJourney != "" && !seen[a.VehicleJourney] {
+			seen[a.VehicleJourney] = true
+			ids = append(ids, a.VehicleJourney)
+		}
+	}
+	origins := make(map[string]string)
+	var (
+		mutex     sync.Mutex
+		wg        sync.WaitGroup
+		semaphore = make(chan struct{}, maxOriginLookups)
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			origin, err := c.origin(ctx, coverage, id)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Could not get the origin of %s from navitia : %+v", id, err)
+				}
+				return
+			}
+			mutex.Lock()
+			origins[id] = origin
+			mutex.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for i := range arrivals {
+		if arrivals[i].Origin == "" {
+			arrivals[i].Origin = origins[arrivals[i].VehicleJourney]
+		}
+	}
+	return nil
+}
+
+// arrivals converts the raw navitia response to our model
+func (data *ArrivalsResponse) arrivals() (arrivals []model.Arrival, err error) {
+	loc := responseLocation(data.Context.Timezone)
+	disruptions, err := disruptionsByID(data.Disruptions, loc)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(data.Arrivals); i++ {
+		p := &data.Arrivals[i]
+		t, err := p.times(loc)
+		if err != nil {
+			return nil, err
+		}
+		arrival := model.Arrival{
+			// the direction of an arrival is the terminus of the train like for departures, its origin is the one of
+			// its route
+			Origin:         p.origin(),
+			TrainNumber:    p.DisplayInformations.TripShortName,
+			CommercialMode: p.DisplayInformations.CommercialMode,
+			VehicleJourney: p.vehicleJourney(),
+			BaseArrival:    t.baseArrival,
+			Arrival:        t.arrival,
+			Delay:          t.arrival.Sub(t.baseArrival),
+			RealTime:       p.realTime(),
+			Disruptions:    p.disruptions(disruptions),
+		}
+		for _, d := range arrival.Disruptions {
+			// a train is cancelled when a disruption suppresses its whole service or deletes its arrival at this stop point
+			if d.NoService() || d.DeletesArrivalAt(p.StopPoint.ID) {
+				arrival.Cancelled = true
+			}
+		}
+		arrivals = append(arrivals, arrival)
+	}
+	return
+}
@@ -0,0 +1,99 @@
+package navitia_api_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetArrivals(t *testing.T) {
+	// Simple Test cases
+	testCases := []struct {
+		name             string
+		inputNewCLient   string
+		inputGetArrivals string
+		expected         []model.Arrival
+		expectedError    error
+	}{
+		{"invalid characters in token should fail", "}", "test", nil, HttpClientError{}},
+		{"unreachable server should fail", "https://", "test", nil, HttpClientError{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewClient(&config.Config{Token: tc.inputNewCLient}, nil, nil)
+			valid, err := client.GetArrivals(context.Background(), "sncf", tc.inputGetArrivals, BoardOptions{})
+			require.Error(t, err)
+			requireErrorTypeMatch(t, err, tc.expectedError)
+			require.Equal(t, tc.expected, valid)
+		})
+	}
+	// Test cases with a filename
+	testCasesFilename := []struct {
+		name             string
+		inputFilename    string
+		inputGetArrivals string
+		expected         []model.Arrival
+		expectedError    error
+	}{
+		{"invalid json should fail", "test_data/invalid.json", "test", nil, JsonDecodeError{}},
+		{"invalid disruption date should fail", "test_data/invalid_disruption_date.json", "test", nil, DateParsingError{}},
+	}
+	for _, tc := range testCasesFilename {
+		t.Run(tc.name, func(t *testing.T) {
+			client, ts := newTestClientFromFilename(t, tc.inputFilename)
+			defer ts.Close()
+			valid, err := client.GetArrivals(context.Background(), "sncf", tc.inputGetArrivals, BoardOptions{})
+			require.Error(t, err)
+			requireErrorTypeMatch(t, err, tc.expectedError)
+			require.Equal(t, tc.expected, valid)
+		})
+	}
+	// http error
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	client := newTestClient(ts)
+	_, err := client.GetArrivals(context.Background(), "sncf", "test", BoardOptions{})
+	requireErrorTypeMatch(t, err, ApiError{})
+	ts.Close()
+	// normal working request, the passages of arrivals have the terminus of the trains as their direction and their
+	// origin comes from their route. The routes not named after their origin fall back on the first stop of the vehicle
+	// journey, the other vehicle journeys fail to show that the board survives it.
+	client, ts = newTestClientFromFilenames(t, []testClientCase{
+		testClientCase{"/coverage/sncf/stop_areas/test/arrivals?", "test_data/realtime-crepieux-arrivals.json"},
+		testClientCase{"/coverage/sncf/vehicle_journeys/vehicle_journey:OCE:SN886823F29029_dst_1?", "test_data/vehicle-journey-886823.json"},
+	})
+	defer ts.Close()
+	arrivals, err := client.GetArrivals(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, arrivals, 3)
+	require.Equal(t, "Ambérieu-en-Bugey", arrivals[1].Origin)
+	require.Equal(t, "", arrivals[2].Origin)
+	// a delayed train
+	require.Equal(t, "St-Etienne-Châteaucreux", arrivals[0].Origin)
+	require.Equal(t, "886823", arrivals[0].TrainNumber)
+	require.Equal(t, "vehicle_journey:OCE:SN886823F29029_dst_1", arrivals[0].VehicleJourney)
+	require.True(t, arrivals[0].RealTime)
+	require.Equal(t, 6*time.Minute, arrivals[0].Delay)
+	require.True(t, arrivals[0].Delayed())
+	require.Equal(t, 6, arrivals[0].DelayMinutes())
+	require.Equal(t, "13:24", arrivals[0].Arrival.Format("15:04"))
+	require.False(t, arrivals[0].Cancelled)
+	// a cancelled train
+	require.True(t, arrivals[1].Cancelled)
+	require.Len(t, arrivals[1].Disruptions, 1)
+	// a train on time
+	require.False(t, arrivals[2].Delayed())
+	require.False(t, arrivals[2].Cancelled)
+	// test the cache
+	ts.Close()
+	arrivals, err = client.GetArrivals(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, arrivals, 3)
+}
@@ -0,0 +1,107 @@
+package navitia_api_client
+
+import (
+	"sync"
+	"time"
+)
+
+type CircuitState string
+
+const (
+	// CircuitClosed lets every request through
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen refuses every request until the cooldown expires
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a single request through to probe the api
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// BreakerStats is a snapshot of the circuit breaker
+type BreakerStats struct {
+	State               CircuitState
+	ConsecutiveFailures int
+	// OpenUntil is when the next probe will be allowed, only meaningful when the circuit is open
+	OpenUntil time.Time
+	// Opened counts the times the circuit opened since startup
+	Opened uint64
+}
+
+// breaker stops sending requests to the api after threshold consecutive failures, then lets a probe request
+// through every cooldown until one succeeds
+type breaker struct {
+	// threshold is the number of consecutive failures that opens the circuit, 0 disables the breaker
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mutex sync.Mutex
+	stats BreakerStats
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		stats:     BreakerStats{State: CircuitClosed},
+	}
+}
+
+// allow returns a CircuitOpenError if the request must not be sent
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.stats.State {
+	case CircuitOpen:
+		if b.now().Before(b.stats.OpenUntil) {
+			return newCircuitOpenError(b.stats.OpenUntil)
+		}
+		b.stats.State = CircuitHalfOpen
+		return nil
+	case CircuitHalfOpen:
+		// a probe is already in flight
+		return newCircuitOpenError(b.stats.OpenUntil)
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a request that was allowed
+func (b *breaker) record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err == nil || !transient(err) {
+		// the api answered, even an error like a 404 means it is healthy
+		b.stats.State = CircuitClosed
+		b.stats.ConsecutiveFailures = 0
+		return
+	}
+	b.stats.ConsecutiveFailures++
+	if b.stats.State == CircuitHalfOpen || b.stats.ConsecutiveFailures >= b.threshold {
+		b.stats.State = CircuitOpen
+		b.stats.OpenUntil = b.now().Add(b.cooldown)
+		b.stats.Opened++
+	}
+}
+
+// abort releases a request that was allowed but whose outcome tells nothing about the api, so that another probe
+// can be sent if it was one
+func (b *breaker) abort() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.stats.State == CircuitHalfOpen {
+		b.stats.State = CircuitOpen
+	}
+}
+
+// Stats returns a snapshot of the circuit breaker
+func (b *breaker) Stats() BreakerStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.stats
+}
@@ -0,0 +1,78 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(2, time.Minute)
+	now := time.Date(2021, 5, 3, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	serverErr := newApiError(http.StatusInternalServerError, "test", 0)
+	// failures below the threshold, or interrupted by a success, keep the circuit closed
+	require.NoError(t, b.allow())
+	b.record(serverErr)
+	require.NoError(t, b.allow())
+	b.record(newApiError(http.StatusNotFound, "test", 0))
+	require.Equal(t, BreakerStats{State: CircuitClosed}, b.Stats())
+	require.NoError(t, b.allow())
+	b.record(serverErr)
+	require.NoError(t, b.allow())
+	b.record(newHttpClientError("test", fmt.Errorf("connection reset")))
+	require.Equal(t, BreakerStats{State: CircuitOpen, ConsecutiveFailures: 2, OpenUntil: now.Add(time.Minute), Opened: 1}, b.Stats())
+	// an open circuit refuses requests until the cooldown expires
+	err := b.allow()
+	requireErrorTypeMatch(t, err, CircuitOpenError{})
+	now = now.Add(time.Minute)
+	// then a single probe is allowed
+	require.NoError(t, b.allow())
+	requireErrorTypeMatch(t, b.allow(), CircuitOpenError{})
+	require.Equal(t, CircuitHalfOpen, b.Stats().State)
+	// a failed probe opens the circuit again
+	b.record(serverErr)
+	require.Equal(t, BreakerStats{State: CircuitOpen, ConsecutiveFailures: 3, OpenUntil: now.Add(time.Minute), Opened: 2}, b.Stats())
+	now = now.Add(time.Minute)
+	// an aborted probe does not tell anything about the api
+	require.NoError(t, b.allow())
+	b.abort()
+	require.Equal(t, CircuitOpen, b.Stats().State)
+	// a successful probe closes the circuit
+	require.NoError(t, b.allow())
+	b.record(nil)
+	require.Equal(t, BreakerStats{State: CircuitClosed, OpenUntil: now, Opened: 2}, b.Stats())
+	// a zero threshold disables the breaker
+	b = newBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.allow())
+		b.record(serverErr)
+	}
+	require.Equal(t, BreakerStats{State: CircuitClosed}, b.Stats())
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	client.breaker = newBreaker(2, time.Hour)
+	for i := 0; i < 2; i++ {
+		_, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+		requireErrorTypeMatch(t, err, ApiError{})
+	}
+	// the api is not hammered anymore, and callers can tell why
+	_, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	requireErrorTypeMatch(t, err, CircuitOpenError{})
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	require.Equal(t, CircuitOpen, client.BreakerStats().State)
+}
@@ -0,0 +1,177 @@
+package navitia_api_client
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// cache memoizes navitia results. The mutex only protects the cache's bookkeeping and is never held during an
+// upstream request, so that lookups for different keys run in parallel. Concurrent misses for the same key wait
+// for a single upstream request.
+type cache struct {
+	// size is the maximum number of entries, the least recently used ones are evicted first. 0 means no limit
+	size int
+	// staleWhileRevalidate is how long an expired entry can still be served while it is refreshed in the background
+	staleWhileRevalidate time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List // of *cacheEntry, the most recently used at the front
+	stats   CacheStats
+}
+
+type cacheEntry struct {
+	key string
+	// ready is closed once the fetch completes, the following fields must not be accessed before that and never
+	// change afterwards: a refresh replaces the whole entry
+	ready  chan struct{}
+	ts     time.Time
+	result interface{}
+	err    error
+	// cancelled is true when the fetch failed because the lookup that triggered it was cancelled
+	cancelled bool
+	// refreshing is protected by the cache mutex
+	refreshing bool
+}
+
+// CacheStats are the cache counters, useful to tune the cache configuration against the api quota
+type CacheStats struct {
+	// Hits counts the lookups served from the cache, including the ones waiting on another lookup's request
+	Hits uint64
+	// StaleHits counts the lookups served with an expired entry while it was being refreshed
+	StaleHits uint64
+	// Misses counts the lookups that triggered an upstream request
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+}
+
+func newCache(size int, staleWhileRevalidate time.Duration) *cache {
+	return &cache{
+		size:                 size,
+		staleWhileRevalidate: staleWhileRevalidate,
+		entries:              make(map[string]*list.Element),
+		lru:                  list.New(),
+	}
+}
+
+// get returns the cached result for key if it is younger than ttl, otherwise it calls fetch and caches its result.
+// Errors are returned to all the callers waiting on the same fetch but are never cached. Once the api budget is
+// exhausted, an expired entry is served rather than nothing. The fetch runs with the context of the lookup that
+// triggered it, if that lookup is cancelled the ones waiting on it try again on their own.
+func (c *cache) get(ctx context.Context, key string, ttl time.Duration, fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	start := time.Now()
+	c.mutex.Lock()
+	if elt, ok := c.entries[key]; ok {
+		e := elt.Value.(*cacheEntry)
+		c.lru.MoveToFront(elt)
+		select {
+		case <-e.ready:
+			age := start.Sub(e.ts)
+			if age < ttl {
+				c.stats.Hits++
+				c.mutex.Unlock()
+				return e.result, nil
+			}
+			if age < ttl+c.staleWhileRevalidate {
+				c.stats.StaleHits++
+				if !e.refreshing {
+					e.refreshing = true
+					go c.refresh(e, fetch)
+				}
+				c.mutex.Unlock()
+				return e.result, nil
+			}
+		default:
+			// another goroutine is already fetching this key
+			c.stats.Hits++
+			c.mutex.Unlock()
+			select {
+			case <-e.ready:
+			case <-ctx.Done():
+				return nil, newHttpClientError("context done while waiting for another lookup", ctx.Err())
+			}
+			if e.cancelled && ctx.Err() == nil {
+				return c.get(ctx, key, ttl, fetch)
+			}
+			return e.result, e.err
+		}
+	}
+	var expired *cacheEntry
+	if elt, ok := c.entries[key]; ok {
+		expired = elt.Value.(*cacheEntry)
+	}
+	c.stats.Misses++
+	e := &cacheEntry{key: key, ready: make(chan struct{})}
+	c.add(e)
+	c.mutex.Unlock()
+
+	e.result, e.err = fetch(ctx)
+	e.ts = start
+	e.cancelled = e.err != nil && ctx.Err() != nil
+	if e.err != nil {
+		c.mutex.Lock()
+		if expired != nil && errors.As(e.err, &QuotaExceededError{}) {
+			if elt, ok := c.entries[key]; ok && elt.Value == e {
+				elt.Value = expired
+			}
+			e.result, e.err, e.ts = expired.result, nil, expired.ts
+		} else {
+			c.remove(e)
+		}
+		c.mutex.Unlock()
+	}
+	close(e.ready)
+	return e.result, e.err
+}
+
+// refresh fetches a new result for a stale entry, the stale entry is kept if the fetch fails. It does not depend on
+// the context of the lookup that triggered it since that lookup has already been served.
+func (c *cache) refresh(stale *cacheEntry, fetch func(ctx context.Context) (interface{}, error)) {
+	start := time.Now()
+	result, err := fetch(context.Background())
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stale.refreshing = false
+	if err != nil {
+		return
+	}
+	if elt, ok := c.entries[stale.key]; ok && elt.Value == stale {
+		e := &cacheEntry{key: stale.key, ready: make(chan struct{}), ts: start, result: result}
+		close(e.ready)
+		elt.Value = e
+	}
+}
+
+// add inserts a new entry in place of any expired one and evicts the least recently used ones if needed, the
+// mutex must be held
+func (c *cache) add(e *cacheEntry) {
+	if elt, ok := c.entries[e.key]; ok {
+		c.lru.Remove(elt)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.size > 0 && c.lru.Len() > c.size {
+		c.remove(c.lru.Back().Value.(*cacheEntry))
+		c.stats.Evictions++
+	}
+}
+
+// remove deletes an entry if it is still cached, the mutex must be held
+func (c *cache) remove(e *cacheEntry) {
+	if elt, ok := c.entries[e.key]; ok && elt.Value == e {
+		c.lru.Remove(elt)
+		delete(c.entries, e.key)
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *cache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	return stats
+}
@@ -0,0 +1,218 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheParallelLookups(t *testing.T) {
+	page, err := ioutil.ReadFile("test_data/normal-crepieux.json")
+	require.NoError(t, err)
+	// the slow stop only answers once the fast stop has been served
+	fastServed := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/coverage/sncf/stop_areas/slow/departures" {
+			select {
+			case <-fastServed:
+			case <-time.After(5 * time.Second):
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+		}
+		w.Write(page)
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	slowErr := make(chan error)
+	go func() {
+		_, err := client.GetDepartures(context.Background(), "sncf", "slow", BoardOptions{})
+		slowErr <- err
+	}()
+	// give the slow request a head start so that it is in flight when the fast one starts
+	time.Sleep(50 * time.Millisecond)
+	_, err = client.GetDepartures(context.Background(), "sncf", "fast", BoardOptions{})
+	require.NoError(t, err)
+	close(fastServed)
+	require.NoError(t, <-slowErr, "a slow stop should not block the lookups of other stops")
+}
+
+func TestCacheCoalescing(t *testing.T) {
+	page, err := ioutil.ReadFile("test_data/normal-crepieux.json")
+	require.NoError(t, err)
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(200 * time.Millisecond)
+		w.Write(page)
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+			if err == nil && len(departures) != 10 {
+				err = fmt.Errorf("got %d departures when expected 10", len(departures))
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests), "concurrent misses for the same stop should be coalesced")
+}
+
+func TestCacheErrorsAreNotCached(t *testing.T) {
+	page, err := ioutil.ReadFile("test_data/normal-crepieux.json")
+	require.NoError(t, err)
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(page)
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	_, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	requireErrorTypeMatch(t, err, ApiError{})
+	departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, departures, 10)
+	_, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestCacheExpiration(t *testing.T) {
+	c := newCache(0, 0)
+	calls := 0
+	fetch := func(ctx context.Context) (interface{}, error) {
+		calls++
+		return calls, nil
+	}
+	result, err := c.get(context.Background(), "key", time.Millisecond, fetch)
+	require.NoError(t, err)
+	require.Equal(t, 1, result)
+	time.Sleep(2 * time.Millisecond)
+	result, err = c.get(context.Background(), "key", time.Millisecond, fetch)
+	require.NoError(t, err)
+	require.Equal(t, 2, result)
+	// each lookup decides of its own time to live
+	result, err = c.get(context.Background(), "key", time.Hour, fetch)
+	require.NoError(t, err)
+	require.Equal(t, 2, result)
+	require.Equal(t, CacheStats{Hits: 1, Misses: 2, Entries: 1}, c.Stats())
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := newCache(2, 0)
+	fetch := func(value string) func(ctx context.Context) (interface{}, error) {
+		return func(ctx context.Context) (interface{}, error) { return value, nil }
+	}
+	_, err := c.get(context.Background(), "a", time.Hour, fetch("a"))
+	require.NoError(t, err)
+	_, err = c.get(context.Background(), "b", time.Hour, fetch("b"))
+	require.NoError(t, err)
+	// a is now the most recently used entry
+	result, err := c.get(context.Background(), "a", time.Hour, fetch("new a"))
+	require.NoError(t, err)
+	require.Equal(t, "a", result)
+	// so b is the one evicted
+	_, err = c.get(context.Background(), "c", time.Hour, fetch("c"))
+	require.NoError(t, err)
+	result, err = c.get(context.Background(), "b", time.Hour, fetch("new b"))
+	require.NoError(t, err)
+	require.Equal(t, "new b", result)
+	result, err = c.get(context.Background(), "c", time.Hour, fetch("new c"))
+	require.NoError(t, err)
+	require.Equal(t, "c", result)
+	require.Equal(t, CacheStats{Hits: 2, Misses: 4, Evictions: 2, Entries: 2}, c.Stats())
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	c := newCache(0, time.Hour)
+	refreshed := make(chan struct{})
+	_, err := c.get(context.Background(), "key", time.Millisecond, func(ctx context.Context) (interface{}, error) { return "stale", nil })
+	require.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	// an expired entry is served while it is refreshed in the background
+	result, err := c.get(context.Background(), "key", time.Millisecond, func(ctx context.Context) (interface{}, error) {
+		defer close(refreshed)
+		return "fresh", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "stale", result)
+	select {
+	case <-refreshed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the stale entry was not refreshed")
+	}
+	// the refreshed entry replaces the stale one
+	require.Eventually(t, func() bool {
+		result, err := c.get(context.Background(), "key", time.Hour, func(ctx context.Context) (interface{}, error) { return "unexpected", nil })
+		return err == nil && result == "fresh"
+	}, 5*time.Second, time.Millisecond)
+	// a failed refresh keeps the stale entry
+	time.Sleep(2 * time.Millisecond)
+	failed := make(chan struct{})
+	result, err = c.get(context.Background(), "key", time.Millisecond, func(ctx context.Context) (interface{}, error) {
+		defer close(failed)
+		return nil, fmt.Errorf("upstream error")
+	})
+	require.NoError(t, err)
+	require.Equal(t, "fresh", result)
+	<-failed
+	require.Eventually(t, func() bool {
+		result, err := c.get(context.Background(), "key", time.Millisecond, func(ctx context.Context) (interface{}, error) { return "fresh again", nil })
+		return err == nil && result == "fresh again"
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestCacheCancellation(t *testing.T) {
+	c := newCache(0, 0)
+	started := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := c.get(ctx, "key", time.Hour, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		firstErr <- err
+	}()
+	<-started
+	// a waiting lookup gives up when its own context is done
+	waiterCtx, waiterCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waiterCancel()
+	_, err := c.get(waiterCtx, "key", time.Hour, func(ctx context.Context) (interface{}, error) { return "unexpected", nil })
+	requireErrorTypeMatch(t, err, HttpClientError{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	// but does not fail when the lookup it waits on is cancelled
+	secondResult := make(chan interface{})
+	go func() {
+		result, _ := c.get(context.Background(), "key", time.Hour, func(ctx context.Context) (interface{}, error) { return "fresh", nil })
+		secondResult <- result
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-firstErr, context.Canceled)
+	require.Equal(t, "fresh", <-secondResult)
+}
@@ -1,38 +1,179 @@
 package navitia_api_client
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
-	"sync"
 	"time"
 
+	"git.adyxax.org/adyxax/trains/pkg/config"
 	"git.adyxax.org/adyxax/trains/pkg/model"
 )
 
 type Client interface {
-	GetDepartures(stop string) (departures []model.Departure, err error)
-	GetStops() (stops []model.Stop, err error)
+	GetArrivals(ctx context.Context, coverage string, stop string, options BoardOptions) (arrivals []model.Arrival, err error)
+	GetDepartures(ctx context.Context, coverage string, stop string, options BoardOptions) (departures []model.Departure, err error)
+	GetJourneys(ctx context.Context, coverage string, from string, to string, datetime time.Time, options JourneyOptions) (journeys []model.Journey, err error)
+	GetLines(ctx context.Context, coverage string, stop string) (lines []model.Line, err error)
+	GetPlaces(ctx context.Context, coverage string, q string) (stops []model.Stop, err error)
+	GetRoutes(ctx context.Context, coverage string, line string) (routes []model.Route, err error)
+	GetStopSchedules(ctx context.Context, coverage string, stop string, date time.Time) (schedules []model.Schedule, err error)
+	GetStops(ctx context.Context) (stops []model.Stop, err error)
+	GetVehicleJourney(ctx context.Context, coverage string, id string, date time.Time) (vj *model.VehicleJourney, err error)
+}
+
+// Monitored is implemented by the clients able to report their api usage
+type Monitored interface {
+	CacheStats() CacheStats
+	QuotaStats() QuotaStats
+	BreakerStats() BreakerStats
 }
 
 type NavitiaClient struct {
 	baseURL    string
 	httpClient *http.Client
+	// coverages are the navitia coverage regions stops are imported from, the first one is the default
+	coverages []string
 
-	mutex sync.Mutex
-	cache map[string]cachedResult
-}
+	cache         *cache
+	departuresTTL time.Duration
+	journeysTTL   time.Duration
+	stopsTTL      time.Duration
+
+	// tokens are sent in the Authorization header, they must never appear in urls, errors or logs
+	tokens  *tokenPool
+	limiter *tokenBucket
+	retry   retryPolicy
+	breaker *breaker
 
-type cachedResult struct {
-	ts     time.Time
-	result interface{}
+	// boards keeps the boards of the next trains for when the api is unavailable, it can be nil
+	boards BoardStore
 }
 
-func NewClient(token string) Client {
+// NewClient returns a client for the configured navitia api, store persists the api requests count and boards the
+// boards of the next trains each time they are fetched. Both can be nil.
+func NewClient(c *config.Config, store QuotaStore, boards BoardStore) *NavitiaClient {
 	return &NavitiaClient{
-		baseURL: fmt.Sprintf("https://%s@api.sncf.com/v1", token),
+		baseURL: c.Url,
 		httpClient: &http.Client{
 			Timeout: time.Minute,
 		},
-		cache: make(map[string]cachedResult),
+		coverages:     c.Coverages,
+		cache:         newCache(c.Cache.Size, c.Cache.StaleWhileRevalidate),
+		departuresTTL: c.Cache.DeparturesTTL,
+		journeysTTL:   c.Cache.JourneysTTL,
+		stopsTTL:      c.Cache.StopsTTL,
+		tokens:        newTokenPool(c.ApiTokens(), c.TokenSelection, store, c.Quota.DailyBudget),
+		limiter:       newTokenBucket(c.Quota.Rate, c.Quota.Burst, time.Now()),
+		retry: retryPolicy{
+			attempts:       c.Retry.Attempts,
+			initialBackoff: c.Retry.InitialBackoff,
+			maxBackoff:     c.Retry.MaxBackoff,
+		},
+		breaker: newBreaker(c.CircuitBreaker.Threshold, c.CircuitBreaker.Cooldown),
+		boards:  boards,
+	}
+}
+
+// CacheStats returns the counters of the navitia responses cache
+func (c *NavitiaClient) CacheStats() CacheStats {
+	return c.cache.Stats()
+}
+
+// QuotaStats returns the api usage of the tokens
+func (c *NavitiaClient) QuotaStats() QuotaStats {
+	stats := c.tokens.Stats()
+	stats.Rate = c.limiter.rate
+	stats.Burst = int(c.limiter.burst)
+	return stats
+}
+
+// coverage returns the coverage region to query, stops that do not know theirs belong to the default one
+func (c *NavitiaClient) coverage(coverage string) string {
+	if coverage == "" && len(c.coverages) > 0 {
+		return c.coverages[0]
+	}
+	return coverage
+}
+
+// BreakerStats returns the state of the circuit breaker
+func (c *NavitiaClient) BreakerStats() BreakerStats {
+	return c.breaker.Stats()
+}
+
+// get performs a navitia api request and decodes its json response into data, name identifies the request in
+// errors. Transient failures are retried according to the retry policy and feed the circuit breaker.
+func (c *NavitiaClient) get(ctx context.Context, request string, name string, data interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", request, nil)
+	if err != nil {
+		return newHttpClientError("http.NewRequest error", c.redact(err))
+	}
+	if err = c.breaker.allow(); err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		err = c.do(ctx, req, name, data)
+		wait, retry := c.retry.backoff(attempt, err)
+		if err == nil || !retry || sleep(ctx, wait) != nil {
+			break
+		}
+	}
+	if ctx.Err() != nil || errors.As(err, &QuotaExceededError{}) {
+		// the api was not reached or we gave up waiting for it, which tells nothing about its health
+		c.breaker.abort()
+	} else {
+		c.breaker.record(err)
+	}
+	return err
+}
+
+// do performs a single attempt of a navitia api request, failing over to the next token when the api rejects one.
+// It returns a QuotaExceededError when the daily budget of all the tokens is exhausted
+func (c *NavitiaClient) do(ctx context.Context, req *http.Request, name string, data interface{}) (err error) {
+	for _, token := range c.tokens.candidates(ctx) {
+		if err = token.quota.acquire(ctx); err != nil {
+			continue
+		}
+		if wait := c.limiter.reserve(time.Now()); wait > 0 {
+			if err = sleep(ctx, wait); err != nil {
+				return err
+			}
+		}
+		if token.secret != "" {
+			req.Header.Set("Authorization", token.secret)
+		}
+		if err = c.send(req, name, data); !c.tokens.rejected(token, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// send performs an http request and decodes its json response into data
+func (c *NavitiaClient) send(req *http.Request, name string, data interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return newHttpClientError("httpClient.Do error", c.redact(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return newApiError(resp.StatusCode, name, parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()))
+	}
+	if err = json.NewDecoder(resp.Body).Decode(data); err != nil {
+		return newJsonDecodeError(name, err)
+	}
+	return nil
+}
+
+// sleep waits for d unless the context is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return newHttpClientError("context done while waiting to retry", ctx.Err())
 	}
 }
@@ -1,19 +1,32 @@
 package navitia_api_client
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
 )
 
 // package utilities
 func newTestClient(ts *httptest.Server) *NavitiaClient {
 	return &NavitiaClient{
-		baseURL:    fmt.Sprintf(ts.URL),
-		httpClient: ts.Client(),
-		cache:      make(map[string]cachedResult),
+		baseURL:       fmt.Sprintf(ts.URL),
+		httpClient:    ts.Client(),
+		cache:         newCache(0, 0),
+		departuresTTL: time.Minute,
+		journeysTTL:   time.Minute,
+		stopsTTL:      time.Minute,
+		coverages:     []string{"sncf"},
+		tokens:        newTokenPool(nil, "round_robin", nil, 0),
+		limiter:       newTokenBucket(0, 1, time.Now()),
+		retry:         retryPolicy{attempts: 1},
+		breaker:       newBreaker(0, 0),
 	}
 }
 
@@ -52,3 +65,44 @@ func newTestClientFromFilenames(t *testing.T, tcs []testClientCase) (*NavitiaCli
 	}))
 	return newTestClient(ts), ts
 }
+
+func TestClientCancellation(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	client.retry = retryPolicy{attempts: 3, initialBackoff: time.Second, maxBackoff: time.Second}
+	client.breaker = newBreaker(1, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.GetDepartures(ctx, "sncf", "test", BoardOptions{})
+	requireErrorTypeMatch(t, err, HttpClientError{})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), time.Second, "a cancelled request should neither wait for the api nor be retried")
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	require.Equal(t, CircuitClosed, client.BreakerStats().State, "a cancelled request should not open the circuit")
+}
+
+func TestClientCoverages(t *testing.T) {
+	client, ts := newTestClientFromFilenames(t, []testClientCase{
+		testClientCase{"/coverage/sncf/stop_areas/stop_area:SNCF:87723197/departures?", "test_data/normal-crepieux.json"},
+		testClientCase{"/coverage/fr-se/stop_areas/stop_area:TCL:SA:30101/departures?", "test_data/normal-crepieux.json"},
+	})
+	defer ts.Close()
+	client.coverages = []string{"sncf", "fr-se"}
+	_, err := client.GetDepartures(context.Background(), "fr-se", "stop_area:TCL:SA:30101", BoardOptions{})
+	require.NoError(t, err)
+	// stops without a coverage are queried from the default one
+	_, err = client.GetDepartures(context.Background(), "", "stop_area:SNCF:87723197", BoardOptions{})
+	require.NoError(t, err)
+	_, err = client.GetDepartures(context.Background(), "", "stop_area:TCL:SA:30101", BoardOptions{})
+	requireErrorTypeMatch(t, err, ApiError{})
+}
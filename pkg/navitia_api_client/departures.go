@@ -1,89 +1,97 @@
 package navitia_api_client
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"log"
 	"time"
 
 	"git.adyxax.org/adyxax/trains/pkg/model"
 )
 
 type DeparturesResponse struct {
-	Disruptions []interface{} `json:"disruptions"`
+	Pagination  Pagination    `json:"pagination"`
+	Disruptions []Disruption  `json:"disruptions"`
 	Notes       []interface{} `json:"notes"`
-	Departures  []struct {
-		DisplayInformations struct {
-			Direction      string        `json:"direction"`
-			Code           string        `json:"code"`
-			Network        string        `json:"network"`
-			Links          []interface{} `json:"links"`
-			Color          string        `json:"color"`
-			Name           string        `json:"name"`
-			PhysicalMode   string        `json:"physical_mode"`
-			Headsign       string        `json:"headsign"`
-			Label          string        `json:"label"`
-			Equipments     []interface{} `json:"equipments"`
-			TextColor      string        `json:"text_color"`
-			TripShortName  string        `json:"trip_short_name"`
-			CommercialMode string        `json:"commercial_mode"`
-			Description    string        `json:"description"`
-		} `json:"display_informations"`
-		StopDateTime struct {
-			Links                  []interface{} `json:"links"`
-			ArrivalDateTime        string        `json:"arrival_date_time"`
-			AdditionalInformations []interface{} `json:"additional_informations"`
-			DepartureDateTime      string        `json:"departure_date_time"`
-			BaseArrivalDateTime    string        `json:"base_arrival_date_time"`
-			BaseDepartureDateTime  string        `json:"base_departure_date_time"`
-			DataFreshness          string        `json:"data_freshness"`
-		} `json:"stop_date_time"`
-	} `json:"departures"`
-	Context struct {
+	Departures  []Passage     `json:"departures"`
+	Context     struct {
 		Timezone        string `json:"timezone"`
 		CurrentDatetime string `json:"current_datetime"`
 	} `json:"context"`
 }
 
-func (c *NavitiaClient) GetDepartures(stop string) (departures []model.Departure, err error) {
-	request := fmt.Sprintf("%s/coverage/sncf/stop_areas/%s/departures", c.baseURL, stop)
-	start := time.Now()
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	if cachedResult, ok := c.cache[request]; ok {
-		if start.Sub(cachedResult.ts) < 60*1000*1000*1000 {
-			return cachedResult.result.([]model.Departure), nil
+// GetDepartures returns the departures of a stop, following the result pages as needed by the options
+func (c *NavitiaClient) GetDepartures(ctx context.Context, coverage string, stop string, options BoardOptions) (departures []model.Departure, err error) {
+	base := fmt.Sprintf("%s/coverage/%s/stop_areas/%s/departures", c.baseURL, c.coverage(coverage), stop)
+	request := boardRequest(base, options, 0)
+	result, err := c.cache.get(ctx, request, c.departuresTTL, func(ctx context.Context) (interface{}, error) {
+		fetchedAt := time.Now()
+		var departures []model.Departure
+		for page := 0; ; page++ {
+			var data DeparturesResponse
+			if err := c.get(ctx, boardRequest(base, options, page), "GetDepartures "+stop, &data); err != nil {
+				return nil, err
+			}
+			pageOfDepartures, err := data.departures()
+			if err != nil {
+				return nil, err
+			}
+			departures = append(departures, pageOfDepartures...)
+			if !options.more(len(departures), data.Pagination, page) {
+				break
+			}
 		}
-	}
-	req, err := http.NewRequest("GET", request, nil)
+		if options.Count > 0 && len(departures) > options.Count {
+			departures = departures[:options.Count]
+		}
+		if c.boards != nil && options.From.IsZero() {
+			if err := c.boards.SaveDepartures(ctx, stop, departures, fetchedAt); err != nil {
+				log.Printf("Could not save departures of %s : %+v", stop, err)
+			}
+		}
+		return departures, nil
+	})
 	if err != nil {
-		return nil, newHttpClientError("http.NewRequest error", err)
+		return nil, err
 	}
-	resp, err := c.httpClient.Do(req)
+	return result.([]model.Departure), nil
+}
+
+// departures converts the raw navitia response to our model
+func (data *DeparturesResponse) departures() (departures []model.Departure, err error) {
+	loc := responseLocation(data.Context.Timezone)
+	disruptions, err := disruptionsByID(data.Disruptions, loc)
 	if err != nil {
-		return nil, newHttpClientError("httpClient.Do error", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		var data DeparturesResponse
-		if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
-			return nil, newJsonDecodeError("GetDepartures "+stop, err)
+	for i := 0; i < len(data.Departures); i++ {
+		p := &data.Departures[i]
+		t, err := p.times(loc)
+		if err != nil {
+			return nil, err
 		}
-		// TODO test for no json error
-		// TODO handle pagination
-		for i := 0; i < len(data.Departures); i++ {
-			t, err := time.Parse("20060102T150405", data.Departures[i].StopDateTime.ArrivalDateTime)
-			if err != nil {
-				return nil, newDateParsingError(data.Departures[i].StopDateTime.ArrivalDateTime, err)
-			}
-			departures = append(departures, model.Departure{data.Departures[i].DisplayInformations.Direction, t.Format("Mon, 02 Jan 2006 15:04:05")})
+		departure := model.Departure{
+			Direction:      p.DisplayInformations.Direction,
+			TrainNumber:    p.DisplayInformations.TripShortName,
+			CommercialMode: p.DisplayInformations.CommercialMode,
+			Line:           p.line(),
+			LineName:       p.DisplayInformations.Name,
+			VehicleJourney: p.vehicleJourney(),
+			BaseDeparture:  t.baseDeparture,
+			Departure:      t.departure,
+			BaseArrival:    t.baseArrival,
+			Arrival:        t.arrival,
+			Delay:          t.departure.Sub(t.baseDeparture),
+			RealTime:       p.realTime(),
+			Disruptions:    p.disruptions(disruptions),
 		}
-		c.cache[request] = cachedResult{
-			ts:     start,
-			result: departures,
+		for _, d := range departure.Disruptions {
+			// a train is cancelled when a disruption suppresses its whole service or deletes its departure from this stop point
+			if d.NoService() || d.DeletesDepartureFrom(p.StopPoint.ID) {
+				departure.Cancelled = true
+			}
 		}
-	} else {
-		err = newApiError(resp.StatusCode, "GetDepartures "+stop)
+		departures = append(departures, departure)
 	}
 	return
 }
@@ -1,10 +1,13 @@
 package navitia_api_client
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"git.adyxax.org/adyxax/trains/pkg/config"
 	"git.adyxax.org/adyxax/trains/pkg/model"
 	"github.com/stretchr/testify/require"
 )
@@ -23,8 +26,8 @@ func TestGetDepartures(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			client := NewClient(tc.inputNewCLient)
-			valid, err := client.GetDepartures(tc.inputGetDepartures)
+			client := NewClient(&config.Config{Token: tc.inputNewCLient}, nil, nil)
+			valid, err := client.GetDepartures(context.Background(), "sncf", tc.inputGetDepartures, BoardOptions{})
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -45,12 +48,13 @@ func TestGetDepartures(t *testing.T) {
 	}{
 		{"invalid json should fail", "test_data/invalid.json", "test", nil, JsonDecodeError{}},
 		{"invalid date should fail", "test_data/invalid_date.json", "test", nil, DateParsingError{}},
+		{"invalid disruption date should fail", "test_data/invalid_disruption_date.json", "test", nil, DateParsingError{}},
 	}
 	for _, tc := range testCasesFilename {
 		t.Run(tc.name, func(t *testing.T) {
 			client, ts := newTestClientFromFilename(t, tc.inputFilename)
 			defer ts.Close()
-			valid, err := client.GetDepartures(tc.inputGetDepartures)
+			valid, err := client.GetDepartures(context.Background(), "sncf", tc.inputGetDepartures, BoardOptions{})
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -66,14 +70,14 @@ func TestGetDepartures(t *testing.T) {
 		w.WriteHeader(http.StatusNotFound)
 	}))
 	client := newTestClient(ts)
-	_, err := client.GetDepartures("test")
+	_, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
 	if err == nil {
 		t.Fatalf("404 should raise an error")
 	}
 	// normal working request
 	client, ts = newTestClientFromFilename(t, "test_data/normal-crepieux.json")
 	defer ts.Close()
-	departures, err := client.GetDepartures("test")
+	departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
 	if err != nil {
 		t.Fatalf("could not get normal-crepieux departures : %s", err)
 	}
@@ -82,11 +86,176 @@ func TestGetDepartures(t *testing.T) {
 	}
 	// test the cache (assuming the test takes less than 60 seconds (and it really should) it will be accurate)
 	ts.Close()
-	departures, err = client.GetDepartures("test")
+	departures, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
 	if err != nil {
 		t.Fatalf("could not get normal-crepieux departures : %s", err)
 	}
 	if len(departures) != 10 {
 		t.Fatalf("did not decode normal-crepieux departures properly, got %d departures when expected 10", len(departures))
 	}
+	// departures are expressed in the coverage's timezone
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	require.Equal(t, model.Departure{
+		Direction:      "Ambérieu-en-Bugey (Ambérieu-en-Bugey)",
+		TrainNumber:    "886823",
+		CommercialMode: "TER",
+		Line:           "line:OCE:199",
+		LineName:       "St-Etienne - Lyon - Ambérieu",
+		VehicleJourney: "vehicle_journey:OCE:SN886823F29029_dst_1",
+		BaseDeparture:  time.Date(2021, 2, 18, 13, 18, 0, 0, paris),
+		Departure:      time.Date(2021, 2, 18, 13, 18, 0, 0, paris),
+		BaseArrival:    time.Date(2021, 2, 18, 13, 18, 0, 0, paris),
+		Arrival:        time.Date(2021, 2, 18, 13, 18, 0, 0, paris),
+	}, departures[0])
+}
+
+func TestGetDeparturesRealTime(t *testing.T) {
+	client, ts := newTestClientFromFilename(t, "test_data/realtime-crepieux.json")
+	defer ts.Close()
+	departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, departures, 3)
+	// a delayed train
+	require.True(t, departures[0].RealTime)
+	require.Equal(t, 7*time.Minute, departures[0].Delay)
+	require.True(t, departures[0].Delayed())
+	require.Equal(t, 7, departures[0].DelayMinutes())
+	require.Equal(t, "13:18", departures[0].BaseDeparture.Format("15:04"))
+	require.Equal(t, "13:25", departures[0].Departure.Format("15:04"))
+	require.False(t, departures[0].Cancelled)
+	// a cancelled train
+	require.True(t, departures[1].Cancelled)
+	require.False(t, departures[1].Delayed())
+	// disruptions are linked to the departures they affect
+	require.Len(t, departures[0].Disruptions, 1)
+	require.Equal(t, "SIGNIFICANT_DELAYS", departures[0].Disruptions[0].Severity.Effect)
+	require.Equal(t, []string{"Retard de 7 minutes : incident de signalisation"}, departures[0].Disruptions[0].Messages)
+	require.Len(t, departures[0].Disruptions[0].ApplicationPeriods, 1)
+	require.Equal(t, "2021-02-18 23:59", departures[0].Disruptions[0].ApplicationPeriods[0].End.Format("2006-01-02 15:04"))
+	require.Len(t, departures[1].Disruptions, 1)
+	require.Equal(t, "trip", departures[1].Disruptions[0].ImpactedObjects[0].Type)
+	require.Equal(t, "deleted", departures[1].Disruptions[0].ImpactedObjects[0].ImpactedStops[0].DepartureStatus)
+	// a train on time
+	require.Empty(t, departures[2].Disruptions)
+	require.True(t, departures[2].RealTime)
+	require.False(t, departures[2].Delayed())
+	require.False(t, departures[2].Cancelled)
+}
+
+func TestGetDeparturesPagination(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		page := r.URL.Query().Get("start_page")
+		if page == "" {
+			page = "0"
+		}
+		http.ServeFile(w, r, "test_data/crepieux-page-"+page+".json")
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	// without options only the first page is returned
+	departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, departures, 4)
+	require.Equal(t, []string{""}, queries)
+	// pages are followed until enough departures are fetched
+	queries = nil
+	departures, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{Count: 6})
+	require.NoError(t, err)
+	require.Len(t, departures, 6)
+	require.Equal(t, "15:18", departures[4].Departure.Format("15:04"))
+	require.Equal(t, []string{"count=6", "count=6&start_page=1"}, queries)
+	// pages are followed until the end of the time window
+	queries = nil
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	from := time.Date(2021, 2, 18, 13, 0, 0, 0, paris)
+	departures, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{From: from, Duration: 5 * time.Hour})
+	require.NoError(t, err)
+	require.Len(t, departures, 10)
+	require.Equal(t, []string{
+		"count=50&duration=18000&from_datetime=20210218T130000",
+		"count=50&duration=18000&from_datetime=20210218T130000&start_page=1",
+		"count=50&duration=18000&from_datetime=20210218T130000&start_page=2",
+	}, queries)
+	// results are cached per options
+	queries = nil
+	_, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{Count: 6})
+	require.NoError(t, err)
+	require.Empty(t, queries)
+	// a failing page fails the whole request
+	client, ts = newTestClientFromFilenames(t, []testClientCase{
+		testClientCase{"/coverage/sncf/stop_areas/test/departures?count=6", "test_data/crepieux-page-0.json"},
+	})
+	defer ts.Close()
+	_, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{Count: 6})
+	requireErrorTypeMatch(t, err, ApiError{})
+}
+
+func TestBoardOptionsMore(t *testing.T) {
+	middle := Pagination{StartPage: 0, ItemsOnPage: 4, ItemsPerPage: 4, TotalResult: 10}
+	last := Pagination{StartPage: 2, ItemsOnPage: 2, ItemsPerPage: 4, TotalResult: 10}
+	testCases := []struct {
+		name       string
+		options    BoardOptions
+		fetched    int
+		pagination Pagination
+		page       int
+		expected   bool
+	}{
+		{"no options", BoardOptions{}, 4, middle, 0, false},
+		{"not enough trains", BoardOptions{Count: 6}, 4, middle, 0, true},
+		{"enough trains", BoardOptions{Count: 4}, 4, middle, 0, false},
+		{"time window", BoardOptions{Duration: time.Hour}, 4, middle, 0, true},
+		{"last page", BoardOptions{Duration: time.Hour}, 10, last, 2, false},
+		{"empty page", BoardOptions{Count: 6}, 0, Pagination{}, 0, false},
+		{"too many pages", BoardOptions{Duration: time.Hour}, 40, middle, maxBoardPages - 1, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.options.more(tc.fetched, tc.pagination, tc.page))
+		})
+	}
+}
+
+// boardStoreMock records the boards saved by the client
+type boardStoreMock struct {
+	stops      []string
+	departures [][]model.Departure
+	updatedAt  []time.Time
+}
+
+func (s *boardStoreMock) SaveArrivals(ctx context.Context, stop string, arrivals []model.Arrival, updatedAt time.Time) error {
+	return nil
+}
+
+func (s *boardStoreMock) SaveDepartures(ctx context.Context, stop string, departures []model.Departure, updatedAt time.Time) error {
+	s.stops = append(s.stops, stop)
+	s.departures = append(s.departures, departures)
+	s.updatedAt = append(s.updatedAt, updatedAt)
+	return nil
+}
+
+func TestGetDeparturesBoardStore(t *testing.T) {
+	client, ts := newTestClientFromFilename(t, "test_data/normal-crepieux.json")
+	defer ts.Close()
+	store := &boardStoreMock{}
+	client.boards = store
+	before := time.Now()
+	departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"test"}, store.stops)
+	require.Equal(t, [][]model.Departure{departures}, store.departures)
+	require.False(t, store.updatedAt[0].Before(before))
+	require.False(t, store.updatedAt[0].After(time.Now()))
+	// the boards served from the cache are not saved again
+	_, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, store.stops, 1)
+	// neither are the later boards
+	_, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{From: time.Date(2021, 2, 18, 14, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	require.Len(t, store.stops, 1)
 }
@@ -0,0 +1,132 @@
+package navitia_api_client
+
+import (
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// Disruption is a navitia disruption as embedded in the responses of most endpoints
+type Disruption struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Cause    string `json:"cause"`
+	Category string `json:"category"`
+	Severity struct {
+		Name     string `json:"name"`
+		Effect   string `json:"effect"`
+		Color    string `json:"color"`
+		Priority int    `json:"priority"`
+	} `json:"severity"`
+	Messages []struct {
+		Text string `json:"text"`
+	} `json:"messages"`
+	ApplicationPeriods []struct {
+		Begin string `json:"begin"`
+		End   string `json:"end"`
+	} `json:"application_periods"`
+	ImpactedObjects []struct {
+		PtObject struct {
+			ID           string `json:"id"`
+			Name         string `json:"name"`
+			EmbeddedType string `json:"embedded_type"`
+		} `json:"pt_object"`
+		ImpactedStops []struct {
+			StopPoint struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"stop_point"`
+			ArrivalStatus   string `json:"arrival_status"`
+			DepartureStatus string `json:"departure_status"`
+			Cause           string `json:"cause"`
+			// times of day, expressed like 132500
+			BaseArrivalTime      string `json:"base_arrival_time"`
+			AmendedArrivalTime   string `json:"amended_arrival_time"`
+			BaseDepartureTime    string `json:"base_departure_time"`
+			AmendedDepartureTime string `json:"amended_departure_time"`
+		} `json:"impacted_stops"`
+	} `json:"impacted_objects"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// toModel converts the raw navitia disruption to our model
+func (d *Disruption) toModel(loc *time.Location) (disruption model.Disruption, err error) {
+	disruption = model.Disruption{
+		Id:       d.ID,
+		Status:   d.Status,
+		Cause:    d.Cause,
+		Category: d.Category,
+		Severity: model.Severity{
+			Name:     d.Severity.Name,
+			Effect:   d.Severity.Effect,
+			Color:    d.Severity.Color,
+			Priority: d.Severity.Priority,
+		},
+	}
+	for _, m := range d.Messages {
+		disruption.Messages = append(disruption.Messages, m.Text)
+	}
+	for _, p := range d.ApplicationPeriods {
+		var period model.Period
+		if period.Begin, err = parseDateTime(p.Begin, loc); err != nil {
+			return
+		}
+		if period.End, err = parseDateTime(p.End, loc); err != nil {
+			return
+		}
+		disruption.ApplicationPeriods = append(disruption.ApplicationPeriods, period)
+	}
+	for _, o := range d.ImpactedObjects {
+		object := model.ImpactedObject{
+			Id:   o.PtObject.ID,
+			Type: o.PtObject.EmbeddedType,
+			Name: o.PtObject.Name,
+		}
+		for _, s := range o.ImpactedStops {
+			object.ImpactedStops = append(object.ImpactedStops, model.ImpactedStop{
+				StopPointId:     s.StopPoint.ID,
+				Name:            s.StopPoint.Name,
+				ArrivalStatus:   s.ArrivalStatus,
+				DepartureStatus: s.DepartureStatus,
+				Cause:           s.Cause,
+			})
+		}
+		disruption.ImpactedObjects = append(disruption.ImpactedObjects, object)
+	}
+	if d.UpdatedAt != "" {
+		if disruption.UpdatedAt, err = parseDateTime(d.UpdatedAt, loc); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// disruptionsByID converts a response's disruptions and indexes them so that departures can reference them from their links
+func disruptionsByID(disruptions []Disruption, loc *time.Location) (map[string]model.Disruption, error) {
+	result := make(map[string]model.Disruption)
+	for i := range disruptions {
+		d, err := disruptions[i].toModel(loc)
+		if err != nil {
+			return nil, err
+		}
+		result[d.Id] = d
+	}
+	return result, nil
+}
+
+// linkedDisruptions returns the disruptions referenced by a list of links, without duplicates
+func linkedDisruptions(disruptions map[string]model.Disruption, links ...[]Link) (result []model.Disruption) {
+	seen := make(map[string]bool)
+	for _, l := range links {
+		for _, link := range l {
+			if link.Type != "disruption" || seen[link.ID] {
+				continue
+			}
+			if d, ok := disruptions[link.ID]; ok {
+				seen[link.ID] = true
+				result = append(result, d)
+			}
+		}
+	}
+	return
+}
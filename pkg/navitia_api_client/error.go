@@ -1,21 +1,40 @@
 package navitia_api_client
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // navitia api query error
 type ApiError struct {
 	code    int
 	request string
+	// retryAfter is how long the api asked us to wait before retrying, if it did
+	retryAfter time.Duration
 }
 
 func (e ApiError) Error() string {
 	return fmt.Sprintf("Navitia Api error return code %d - %s", e.code, e.request)
 }
 
-func newApiError(code int, request string) error {
+func newApiError(code int, request string, retryAfter time.Duration) error {
 	return ApiError{
-		code:    code,
-		request: request,
+		code:       code,
+		request:    request,
+		retryAfter: retryAfter,
+	}
+}
+
+// navitia object not found error
+type NotFoundError struct {
+	id string
+}
+
+func (e NotFoundError) Error() string { return fmt.Sprintf("Navitia object not found %s", e.id) }
+
+func newNotFoundError(id string) error {
+	return NotFoundError{
+		id: id,
 	}
 }
 
@@ -68,3 +87,33 @@ func newDateParsingError(date string, err error) error {
 		err:  err,
 	}
 }
+
+// daily api budget exhausted error
+type QuotaExceededError struct {
+	budget int
+}
+
+func (e QuotaExceededError) Error() string {
+	return fmt.Sprintf("Navitia daily api budget of %d requests exhausted", e.budget)
+}
+
+func newQuotaExceededError(budget int) error {
+	return QuotaExceededError{
+		budget: budget,
+	}
+}
+
+// circuit breaker open error, the request was not sent to the api
+type CircuitOpenError struct {
+	until time.Time
+}
+
+func (e CircuitOpenError) Error() string {
+	return fmt.Sprintf("Navitia circuit breaker open until %s after repeated api failures", e.until.Format(time.RFC3339))
+}
+
+func newCircuitOpenError(until time.Time) error {
+	return CircuitOpenError{
+		until: until,
+	}
+}
@@ -14,6 +14,8 @@ func requireErrorTypeMatch(t *testing.T, err error, expected error) {
 func TestErrorsCoverage(t *testing.T) {
 	apiErr := ApiError{}
 	_ = apiErr.Error()
+	notFoundErr := NotFoundError{}
+	_ = notFoundErr.Error()
 	httpClientErr := HttpClientError{}
 	_ = httpClientErr.Error()
 	_ = httpClientErr.Unwrap()
@@ -23,4 +25,8 @@ func TestErrorsCoverage(t *testing.T) {
 	dateParsingErr := DateParsingError{}
 	_ = dateParsingErr.Error()
 	_ = dateParsingErr.Unwrap()
+	quotaExceededErr := QuotaExceededError{}
+	_ = quotaExceededErr.Error()
+	circuitOpenErr := CircuitOpenError{}
+	_ = circuitOpenErr.Error()
 }
@@ -0,0 +1,149 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// JourneyOptions tunes a journeys request
+type JourneyOptions struct {
+	// ArrivalBy makes the datetime the latest arrival time instead of the earliest departure time
+	ArrivalBy bool
+	// Count is the minimum number of journeys to return, 0 lets navitia decide
+	Count int
+	// MaxTransfers is the maximum number of transfers in a journey, nil means no limit and 0 only direct trains
+	MaxTransfers *int
+}
+
+type place struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type JourneysResponse struct {
+	Journeys []struct {
+		Duration          int    `json:"duration"`
+		NbTransfers       int    `json:"nb_transfers"`
+		DepartureDateTime string `json:"departure_date_time"`
+		ArrivalDateTime   string `json:"arrival_date_time"`
+		Type              string `json:"type"`
+		Sections          []struct {
+			ID                  string `json:"id"`
+			Type                string `json:"type"`
+			Mode                string `json:"mode"`
+			TransferType        string `json:"transfer_type"`
+			From                place  `json:"from"`
+			To                  place  `json:"to"`
+			DepartureDateTime   string `json:"departure_date_time"`
+			ArrivalDateTime     string `json:"arrival_date_time"`
+			Duration            int    `json:"duration"`
+			DisplayInformations struct {
+				Direction      string `json:"direction"`
+				Label          string `json:"label"`
+				TripShortName  string `json:"trip_short_name"`
+				CommercialMode string `json:"commercial_mode"`
+			} `json:"display_informations"`
+		} `json:"sections"`
+	} `json:"journeys"`
+	Disruptions []Disruption `json:"disruptions"`
+	Context     struct {
+		Timezone        string `json:"timezone"`
+		CurrentDatetime string `json:"current_datetime"`
+	} `json:"context"`
+}
+
+func (c *NavitiaClient) GetJourneys(ctx context.Context, coverage string, from string, to string, datetime time.Time, options JourneyOptions) (journeys []model.Journey, err error) {
+	query := url.Values{}
+	query.Set("from", from)
+	query.Set("to", to)
+	query.Set("datetime", datetime.Format(navitiaDateTimeLayout))
+	if options.ArrivalBy {
+		query.Set("datetime_represents", "arrival")
+	} else {
+		query.Set("datetime_represents", "departure")
+	}
+	if options.Count > 0 {
+		query.Set("count", strconv.Itoa(options.Count))
+	}
+	if options.MaxTransfers != nil && *options.MaxTransfers >= 0 {
+		query.Set("max_nb_transfers", strconv.Itoa(*options.MaxTransfers))
+	}
+	request := fmt.Sprintf("%s/coverage/%s/journeys?%s", c.baseURL, c.coverage(coverage), query.Encode())
+	result, err := c.cache.get(ctx, request, c.journeysTTL, func(ctx context.Context) (interface{}, error) {
+		var data JourneysResponse
+		if err := c.get(ctx, request, "GetJourneys "+from+" "+to, &data); err != nil {
+			return nil, err
+		}
+		return data.journeys()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]model.Journey), nil
+}
+
+// sectionTypes maps the navitia section types to our model, other section types are ignored
+var sectionTypes = map[string]model.SectionType{
+	"public_transport": model.PublicTransportSection,
+	"transfer":         model.TransferSection,
+	"waiting":          model.WaitingSection,
+	"street_network":   model.WalkingSection,
+	"crow_fly":         model.WalkingSection,
+}
+
+// journeys converts the raw navitia response to our model
+func (data *JourneysResponse) journeys() (journeys []model.Journey, err error) {
+	loc := responseLocation(data.Context.Timezone)
+	for i := 0; i < len(data.Journeys); i++ {
+		j := &data.Journeys[i]
+		journey := model.Journey{
+			Duration:    time.Duration(j.Duration) * time.Second,
+			NbTransfers: j.NbTransfers,
+		}
+		if journey.Departure, err = parseDateTime(j.DepartureDateTime, loc); err != nil {
+			return nil, err
+		}
+		if journey.Arrival, err = parseDateTime(j.ArrivalDateTime, loc); err != nil {
+			return nil, err
+		}
+		for k := 0; k < len(j.Sections); k++ {
+			s := &j.Sections[k]
+			sectionType, ok := sectionTypes[s.Type]
+			if !ok {
+				continue
+			}
+			// navitia adds empty crow fly sections to go from a stop area to its stop points
+			if sectionType == model.WalkingSection && s.Duration == 0 {
+				continue
+			}
+			section := model.Section{
+				Type:     sectionType,
+				FromId:   s.From.ID,
+				From:     s.From.Name,
+				ToId:     s.To.ID,
+				To:       s.To.Name,
+				Duration: time.Duration(s.Duration) * time.Second,
+			}
+			if section.Departure, err = parseDateTime(s.DepartureDateTime, loc); err != nil {
+				return nil, err
+			}
+			if section.Arrival, err = parseDateTime(s.ArrivalDateTime, loc); err != nil {
+				return nil, err
+			}
+			if sectionType == model.PublicTransportSection {
+				section.Line = s.DisplayInformations.Label
+				section.Direction = s.DisplayInformations.Direction
+				section.TrainNumber = s.DisplayInformations.TripShortName
+				section.CommercialMode = s.DisplayInformations.CommercialMode
+			}
+			journey.Sections = append(journey.Sections, section)
+		}
+		journeys = append(journeys, journey)
+	}
+	return
+}
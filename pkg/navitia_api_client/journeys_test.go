@@ -0,0 +1,164 @@
+package navitia_api_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetJourneys(t *testing.T) {
+	datetime := time.Date(2021, 2, 18, 13, 0, 0, 0, time.UTC)
+	// Simple Test cases
+	testCases := []struct {
+		name           string
+		inputNewCLient string
+		expected       []model.Journey
+		expectedError  error
+	}{
+		{"invalid characters in token should fail", "}", nil, HttpClientError{}},
+		{"unreachable server should fail", "https://", nil, HttpClientError{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewClient(&config.Config{Token: tc.inputNewCLient}, nil, nil)
+			valid, err := client.GetJourneys(context.Background(), "sncf", "from", "to", datetime, JourneyOptions{})
+			require.Error(t, err)
+			requireErrorTypeMatch(t, err, tc.expectedError)
+			require.Equal(t, tc.expected, valid)
+		})
+	}
+	// Test cases with a filename
+	testCasesFilename := []struct {
+		name          string
+		inputFilename string
+		expected      []model.Journey
+		expectedError error
+	}{
+		{"invalid json should fail", "test_data/invalid.json", nil, JsonDecodeError{}},
+		{"invalid date should fail", "test_data/invalid_journeys_date.json", nil, DateParsingError{}},
+	}
+	for _, tc := range testCasesFilename {
+		t.Run(tc.name, func(t *testing.T) {
+			client, ts := newTestClientFromFilename(t, tc.inputFilename)
+			defer ts.Close()
+			valid, err := client.GetJourneys(context.Background(), "sncf", "from", "to", datetime, JourneyOptions{})
+			require.Error(t, err)
+			requireErrorTypeMatch(t, err, tc.expectedError)
+			require.Equal(t, tc.expected, valid)
+		})
+	}
+	// http error
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	client := newTestClient(ts)
+	_, err := client.GetJourneys(context.Background(), "sncf", "from", "to", datetime, JourneyOptions{})
+	requireErrorTypeMatch(t, err, ApiError{})
+	ts.Close()
+	// query parameters
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/coverage/sncf/journeys", r.URL.Path)
+		query := r.URL.Query()
+		require.Equal(t, "stop_area:OCE:SA:87723502", query.Get("from"))
+		require.Equal(t, "stop_area:OCE:SA:87747006", query.Get("to"))
+		require.Equal(t, "20210218T130000", query.Get("datetime"))
+		require.Equal(t, "arrival", query.Get("datetime_represents"))
+		require.Equal(t, "3", query.Get("count"))
+		require.Equal(t, "1", query.Get("max_nb_transfers"))
+		w.Write([]byte(`{"journeys": []}`))
+	}))
+	client = newTestClient(ts)
+	maxTransfers := 1
+	_, err = client.GetJourneys(context.Background(), "sncf", "stop_area:OCE:SA:87723502", "stop_area:OCE:SA:87747006", datetime, JourneyOptions{ArrivalBy: true, Count: 3, MaxTransfers: &maxTransfers})
+	require.NoError(t, err)
+	ts.Close()
+	// an explicit 0 asks for direct trains only
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "0", r.URL.Query().Get("max_nb_transfers"))
+		w.Write([]byte(`{"journeys": []}`))
+	}))
+	client = newTestClient(ts)
+	maxTransfers = 0
+	_, err = client.GetJourneys(context.Background(), "sncf", "stop_area:OCE:SA:87723502", "stop_area:OCE:SA:87747006", datetime, JourneyOptions{MaxTransfers: &maxTransfers})
+	require.NoError(t, err)
+	ts.Close()
+	// normal working request
+	client, ts = newTestClientFromFilename(t, "test_data/journeys-crepieux-grenoble.json")
+	defer ts.Close()
+	journeys, err := client.GetJourneys(context.Background(), "sncf", "stop_area:OCE:SA:87723502", "stop_area:OCE:SA:87747006", datetime, JourneyOptions{})
+	require.NoError(t, err)
+	require.Len(t, journeys, 2)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	require.Equal(t, model.Journey{
+		Departure:   time.Date(2021, 2, 18, 13, 18, 0, 0, paris),
+		Arrival:     time.Date(2021, 2, 18, 15, 5, 0, 0, paris),
+		Duration:    107 * time.Minute,
+		NbTransfers: 1,
+		Sections: []model.Section{
+			model.Section{
+				Type:           model.PublicTransportSection,
+				FromId:         "stop_point:OCE:SP:TrainTER-87723502",
+				From:           "Crépieux-la-Pape",
+				ToId:           "stop_point:OCE:SP:TrainTER-87723197",
+				To:             "Lyon Part-Dieu",
+				Departure:      time.Date(2021, 2, 18, 13, 18, 0, 0, paris),
+				Arrival:        time.Date(2021, 2, 18, 13, 30, 0, 0, paris),
+				Duration:       12 * time.Minute,
+				Line:           "St-Etienne - Lyon - Ambérieu",
+				Direction:      "Lyon Part-Dieu (Lyon)",
+				TrainNumber:    "886823",
+				CommercialMode: "TER",
+			},
+			model.Section{
+				Type:      model.TransferSection,
+				FromId:    "stop_point:OCE:SP:TrainTER-87723197",
+				From:      "Lyon Part-Dieu",
+				ToId:      "stop_point:OCE:SP:TrainTER-87723197-2",
+				To:        "Lyon Part-Dieu",
+				Departure: time.Date(2021, 2, 18, 13, 30, 0, 0, paris),
+				Arrival:   time.Date(2021, 2, 18, 13, 35, 0, 0, paris),
+				Duration:  5 * time.Minute,
+			},
+			model.Section{
+				Type:      model.WaitingSection,
+				FromId:    "stop_point:OCE:SP:TrainTER-87723197-2",
+				From:      "Lyon Part-Dieu",
+				ToId:      "stop_point:OCE:SP:TrainTER-87723197-2",
+				To:        "Lyon Part-Dieu",
+				Departure: time.Date(2021, 2, 18, 13, 35, 0, 0, paris),
+				Arrival:   time.Date(2021, 2, 18, 13, 42, 0, 0, paris),
+				Duration:  7 * time.Minute,
+			},
+			model.Section{
+				Type:           model.PublicTransportSection,
+				FromId:         "stop_point:OCE:SP:TrainTER-87723197-2",
+				From:           "Lyon Part-Dieu",
+				ToId:           "stop_point:OCE:SP:TrainTER-87747006",
+				To:             "Grenoble",
+				Departure:      time.Date(2021, 2, 18, 13, 42, 0, 0, paris),
+				Arrival:        time.Date(2021, 2, 18, 15, 5, 0, 0, paris),
+				Duration:       83 * time.Minute,
+				Line:           "Lyon - Grenoble",
+				Direction:      "Grenoble (Grenoble)",
+				TrainNumber:    "17563",
+				CommercialMode: "TER",
+			},
+		},
+	}, journeys[0])
+	// the empty crow fly section is skipped but not the final walk
+	require.Len(t, journeys[1].Sections, 2)
+	require.Equal(t, model.WalkingSection, journeys[1].Sections[1].Type)
+	require.Equal(t, 4*time.Minute, journeys[1].Sections[1].Duration)
+	// test the cache
+	ts.Close()
+	journeys, err = client.GetJourneys(context.Background(), "sncf", "stop_area:OCE:SA:87723502", "stop_area:OCE:SA:87747006", datetime, JourneyOptions{})
+	require.NoError(t, err)
+	require.Len(t, journeys, 2)
+}
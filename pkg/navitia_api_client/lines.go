@@ -0,0 +1,142 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+type LinesResponse struct {
+	Pagination Pagination `json:"pagination"`
+	Lines      []struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Code      string `json:"code"`
+		Color     string `json:"color"`
+		TextColor string `json:"text_color"`
+		Network   struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"network"`
+		CommercialMode struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"commercial_mode"`
+	} `json:"lines"`
+}
+
+type RouteSchedulesResponse struct {
+	RouteSchedules []struct {
+		DisplayInformations struct {
+			Direction      string `json:"direction"`
+			Code           string `json:"code"`
+			Network        string `json:"network"`
+			Links          []Link `json:"links"`
+			Color          string `json:"color"`
+			Name           string `json:"name"`
+			Label          string `json:"label"`
+			TextColor      string `json:"text_color"`
+			CommercialMode string `json:"commercial_mode"`
+		} `json:"display_informations"`
+		Table struct {
+			Rows []struct {
+				StopPoint struct {
+					ID       string `json:"id"`
+					Name     string `json:"name"`
+					StopArea struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"stop_area"`
+				} `json:"stop_point"`
+			} `json:"rows"`
+		} `json:"table"`
+	} `json:"route_schedules"`
+}
+
+// GetLines returns the lines serving a stop
+func (c *NavitiaClient) GetLines(ctx context.Context, coverage string, stop string) (lines []model.Line, err error) {
+	request := fmt.Sprintf("%s/coverage/%s/stop_areas/%s/lines?count=%d", c.baseURL, c.coverage(coverage), stop, boardPageSize)
+	result, err := c.cache.get(ctx, request, c.stopsTTL, func(ctx context.Context) (interface{}, error) {
+		var data LinesResponse
+		if err := c.get(ctx, request, "GetLines "+stop, &data); err != nil {
+			return nil, err
+		}
+		var lines []model.Line
+		for _, l := range data.Lines {
+			lines = append(lines, model.Line{
+				Id:             l.ID,
+				Name:           l.Name,
+				Code:           l.Code,
+				Color:          l.Color,
+				TextColor:      l.TextColor,
+				Network:        l.Network.Name,
+				CommercialMode: l.CommercialMode.Name,
+			})
+		}
+		return lines, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]model.Line), nil
+}
+
+// GetRoutes returns the routes of a line with their ordered stops. They come from the route schedules, the only
+// navitia endpoint listing the stops of a route in order, so only the routes running in the next 24 hours are known.
+func (c *NavitiaClient) GetRoutes(ctx context.Context, coverage string, line string) (routes []model.Route, err error) {
+	query := url.Values{}
+	query.Set("data_freshness", "base_schedule")
+	query.Set("items_per_schedule", "1")
+	request := fmt.Sprintf("%s/coverage/%s/lines/%s/route_schedules?%s", c.baseURL, c.coverage(coverage), line, query.Encode())
+	result, err := c.cache.get(ctx, request, c.stopsTTL, func(ctx context.Context) (interface{}, error) {
+		var data RouteSchedulesResponse
+		if err := c.get(ctx, request, "GetRoutes "+line, &data); err != nil {
+			return nil, err
+		}
+		var routes []model.Route
+		for _, rs := range data.RouteSchedules {
+			di := &rs.DisplayInformations
+			route := model.Route{
+				Direction: di.Direction,
+				Line: model.Line{
+					Name:           di.Label,
+					Code:           di.Code,
+					Color:          di.Color,
+					TextColor:      di.TextColor,
+					Network:        di.Network,
+					CommercialMode: di.CommercialMode,
+				},
+			}
+			if route.Line.Name == "" {
+				route.Line.Name = di.Name
+			}
+			for _, link := range di.Links {
+				switch link.Type {
+				case "line":
+					route.Line.Id = link.ID
+				case "route":
+					route.Id = link.ID
+				}
+			}
+			for _, row := range rs.Table.Rows {
+				stop := model.Stop{Id: row.StopPoint.StopArea.ID, Name: row.StopPoint.StopArea.Name, Coverage: c.coverage(coverage)}
+				if stop.Name == "" {
+					stop.Name = row.StopPoint.Name
+				}
+				// consecutive rows can be different stop points of the same stop area
+				if n := len(route.Stops); n > 0 && route.Stops[n-1].Id == stop.Id {
+					continue
+				}
+				route.Stops = append(route.Stops, stop)
+			}
+			routes = append(routes, route)
+		}
+		return routes, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]model.Route), nil
+}
@@ -0,0 +1,75 @@
+package navitia_api_client
+
+import (
+	"context"
+	"testing"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLines(t *testing.T) {
+	client, ts := newTestClientFromFilenames(t, []testClientCase{
+		testClientCase{"/coverage/sncf/stop_areas/stop_area:OCE:SA:87723502/lines?count=50", "test_data/lines-crepieux.json"},
+		testClientCase{"/coverage/sncf/stop_areas/invalid/lines?count=50", "test_data/invalid.json"},
+	})
+	defer ts.Close()
+	lines, err := client.GetLines(context.Background(), "", "stop_area:OCE:SA:87723502")
+	require.NoError(t, err)
+	require.Equal(t, []model.Line{
+		model.Line{
+			Id:             "line:OCE:199",
+			Name:           "St-Etienne - Lyon - Ambérieu",
+			Color:          "000000",
+			TextColor:      "FFFFFF",
+			Network:        "SNCF",
+			CommercialMode: "TER",
+		},
+		model.Line{
+			Id:             "line:OCE:200",
+			Name:           "Lyon - Bourg-en-Bresse",
+			Code:           "L30",
+			Color:          "FFB612",
+			TextColor:      "000000",
+			Network:        "SNCF",
+			CommercialMode: "TER",
+		},
+	}, lines)
+	_, err = client.GetLines(context.Background(), "", "invalid")
+	requireErrorTypeMatch(t, err, JsonDecodeError{})
+	_, err = client.GetLines(context.Background(), "", "unknown")
+	requireErrorTypeMatch(t, err, ApiError{})
+}
+
+func TestGetRoutes(t *testing.T) {
+	client, ts := newTestClientFromFilenames(t, []testClientCase{
+		testClientCase{"/coverage/sncf/lines/line:OCE:199/route_schedules?data_freshness=base_schedule&items_per_schedule=1", "test_data/route-schedules-line-199.json"},
+		testClientCase{"/coverage/sncf/lines/invalid/route_schedules?data_freshness=base_schedule&items_per_schedule=1", "test_data/invalid.json"},
+	})
+	defer ts.Close()
+	routes, err := client.GetRoutes(context.Background(), "sncf", "line:OCE:199")
+	require.NoError(t, err)
+	require.Len(t, routes, 2)
+	require.Equal(t, "route:OCE:199-TrainTER-87726000-87743716", routes[0].Id)
+	require.Equal(t, "Ambérieu-en-Bugey (Ambérieu-en-Bugey)", routes[0].Direction)
+	require.Equal(t, model.Line{
+		Id:             "line:OCE:199",
+		Name:           "St-Etienne - Lyon - Ambérieu",
+		Color:          "000000",
+		TextColor:      "FFFFFF",
+		Network:        "SNCF",
+		CommercialMode: "TER",
+	}, routes[0].Line)
+	// stops are ordered, and listed once even when the route calls at several stop points of a stop area
+	require.Equal(t, []model.Stop{
+		model.Stop{Id: "stop_area:OCE:SA:87726000", Name: "St-Etienne-Châteaucreux", Coverage: "sncf"},
+		model.Stop{Id: "stop_area:OCE:SA:87723197", Name: "Lyon Part-Dieu", Coverage: "sncf"},
+		model.Stop{Id: "stop_area:OCE:SA:87723502", Name: "Crépieux-la-Pape", Coverage: "sncf"},
+		model.Stop{Id: "stop_area:OCE:SA:87743716", Name: "Ambérieu-en-Bugey", Coverage: "sncf"},
+	}, routes[0].Stops)
+	require.Equal(t, "St-Etienne-Châteaucreux", routes[1].Stops[3].Name)
+	_, err = client.GetRoutes(context.Background(), "sncf", "invalid")
+	requireErrorTypeMatch(t, err, JsonDecodeError{})
+	_, err = client.GetRoutes(context.Background(), "sncf", "unknown")
+	requireErrorTypeMatch(t, err, ApiError{})
+}
@@ -0,0 +1,226 @@
+package navitia_api_client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+// maxBoardPages bounds the number of requests made to fill a single departures or arrivals board
+const maxBoardPages = 10
+
+// boardPageSize is the number of trains requested per page when filling a time window
+const boardPageSize = 50
+
+// BoardStore keeps the last boards of the next trains fetched from the api, so that they can be served when it is
+// unavailable. They are saved with the time they were fetched at, never when they are served from the cache.
+type BoardStore interface {
+	SaveArrivals(ctx context.Context, stop string, arrivals []model.Arrival, updatedAt time.Time) error
+	SaveDepartures(ctx context.Context, stop string, departures []model.Departure, updatedAt time.Time) error
+}
+
+// BoardOptions tunes a departures or arrivals request
+type BoardOptions struct {
+	// Count is the maximum number of trains to return, 0 lets navitia decide unless a Duration is set
+	Count int
+	// From is the datetime of the first train, expressed in the timezone of the coverage. The zero value means now.
+	From time.Time
+	// Duration is the time window after From to return every train in, 0 means no window
+	Duration time.Duration
+}
+
+// query returns the query string parameters of the options, for a given page
+func (o BoardOptions) query(page int) url.Values {
+	query := url.Values{}
+	if o.Count > 0 {
+		query.Set("count", strconv.Itoa(o.Count))
+	} else if o.Duration > 0 {
+		query.Set("count", strconv.Itoa(boardPageSize))
+	}
+	if !o.From.IsZero() {
+		query.Set("from_datetime", o.From.Format(navitiaDateTimeLayout))
+	}
+	if o.Duration > 0 {
+		query.Set("duration", strconv.Itoa(int(o.Duration/time.Second)))
+	}
+	if page > 0 {
+		query.Set("start_page", strconv.Itoa(page))
+	}
+	return query
+}
+
+// more returns true when another page is needed to fulfill the options, given the number of trains fetched so far
+func (o BoardOptions) more(fetched int, pagination Pagination, page int) bool {
+	if page+1 >= maxBoardPages || pagination.last() {
+		return false
+	}
+	if o.Count > 0 {
+		return fetched < o.Count
+	}
+	return o.Duration > 0
+}
+
+// boardRequest returns the url of a page of a departures or arrivals request
+func boardRequest(base string, options BoardOptions, page int) string {
+	if query := options.query(page); len(query) > 0 {
+		return base + "?" + query.Encode()
+	}
+	return base
+}
+
+// Pagination describes which part of the results a navitia response holds
+type Pagination struct {
+	StartPage    int `json:"start_page"`
+	ItemsOnPage  int `json:"items_on_page"`
+	ItemsPerPage int `json:"items_per_page"`
+	TotalResult  int `json:"total_result"`
+}
+
+// last returns true when there are no more results after this page
+func (p Pagination) last() bool {
+	return p.ItemsOnPage == 0 || p.ItemsOnPage+p.ItemsPerPage*p.StartPage >= p.TotalResult
+}
+
+// Link is a reference to another navitia object
+type Link struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// Passage is a train calling at a stop, as returned by both the departures and arrivals endpoints
+type Passage struct {
+	DisplayInformations struct {
+		Direction      string        `json:"direction"`
+		Code           string        `json:"code"`
+		Network        string        `json:"network"`
+		Links          []Link        `json:"links"`
+		Color          string        `json:"color"`
+		Name           string        `json:"name"`
+		PhysicalMode   string        `json:"physical_mode"`
+		Headsign       string        `json:"headsign"`
+		Label          string        `json:"label"`
+		Equipments     []interface{} `json:"equipments"`
+		TextColor      string        `json:"text_color"`
+		TripShortName  string        `json:"trip_short_name"`
+		CommercialMode string        `json:"commercial_mode"`
+		Description    string        `json:"description"`
+	} `json:"display_informations"`
+	StopPoint struct {
+		ID    string `json:"id"`
+		Links []Link `json:"links"`
+	} `json:"stop_point"`
+	Route struct {
+		Name string `json:"name"`
+	} `json:"route"`
+	Links        []Link `json:"links"`
+	StopDateTime struct {
+		Links                  []Link        `json:"links"`
+		ArrivalDateTime        string        `json:"arrival_date_time"`
+		AdditionalInformations []interface{} `json:"additional_informations"`
+		DepartureDateTime      string        `json:"departure_date_time"`
+		BaseArrivalDateTime    string        `json:"base_arrival_date_time"`
+		BaseDepartureDateTime  string        `json:"base_departure_date_time"`
+		DataFreshness          string        `json:"data_freshness"`
+	} `json:"stop_date_time"`
+}
+
+// routeNameSeparator separates the origin from the destination in the route names
+const routeNameSeparator = " vers "
+
+// navitia dates are expressed in the local time of the coverage, without any offset information
+const navitiaDateTimeLayout = "20060102T150405"
+
+func parseDateTime(s string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation(navitiaDateTimeLayout, s, loc)
+	if err != nil {
+		return t, newDateParsingError(s, err)
+	}
+	return t, nil
+}
+
+// responseLocation returns the timezone navitia used to express a response's dates
+func responseLocation(timezone string) *time.Location {
+	if timezone != "" {
+		if loc, err := time.LoadLocation(timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+type passageTimes struct {
+	baseArrival   time.Time
+	arrival       time.Time
+	baseDeparture time.Time
+	departure     time.Time
+}
+
+// times parses the passage's dates, base times default to the real-time ones when missing
+func (p *Passage) times(loc *time.Location) (t passageTimes, err error) {
+	sdt := &p.StopDateTime
+	for _, field := range []struct {
+		raw    string
+		parsed *time.Time
+	}{
+		{sdt.ArrivalDateTime, &t.arrival},
+		{sdt.DepartureDateTime, &t.departure},
+		{sdt.BaseArrivalDateTime, &t.baseArrival},
+		{sdt.BaseDepartureDateTime, &t.baseDeparture},
+	} {
+		if field.raw == "" {
+			continue
+		}
+		if *field.parsed, err = parseDateTime(field.raw, loc); err != nil {
+			return
+		}
+	}
+	if t.baseDeparture.IsZero() {
+		t.baseDeparture = t.departure
+	}
+	if t.baseArrival.IsZero() {
+		t.baseArrival = t.arrival
+	}
+	return
+}
+
+// disruptions returns the disruptions referenced by the passage
+func (p *Passage) disruptions(all map[string]model.Disruption) []model.Disruption {
+	return linkedDisruptions(all, p.DisplayInformations.Links, p.StopPoint.Links, p.StopDateTime.Links)
+}
+
+// vehicleJourney returns the id of the train calling at the stop
+func (p *Passage) vehicleJourney() string {
+	return p.link("vehicle_journey")
+}
+
+// origin returns the first stop of the route of the train calling at the stop, which navitia names like
+// "St-Etienne-Châteaucreux vers Ambérieu-en-Bugey (Train TER)". It is empty when the route is not named that way.
+func (p *Passage) origin() string {
+	if i := strings.Index(p.Route.Name, routeNameSeparator); i > 0 {
+		return p.Route.Name[:i]
+	}
+	return ""
+}
+
+// line returns the id of the line of the train calling at the stop
+func (p *Passage) line() string {
+	return p.link("line")
+}
+
+// link returns the id of the first object of a type the passage links to
+func (p *Passage) link(linkType string) string {
+	for _, link := range p.Links {
+		if link.Type == linkType {
+			return link.ID
+		}
+	}
+	return ""
+}
+
+func (p *Passage) realTime() bool {
+	return p.StopDateTime.DataFreshness == "realtime"
+}
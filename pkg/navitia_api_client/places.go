@@ -0,0 +1,58 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+type PlacesResponse struct {
+	Places []struct {
+		ID           string `json:"id"`
+		Name         string `json:"name"`
+		Quality      int    `json:"quality"`
+		EmbeddedType string `json:"embedded_type"`
+		StopArea     struct {
+			ID    string `json:"id"`
+			Name  string `json:"name"`
+			Label string `json:"label"`
+		} `json:"stop_area"`
+	} `json:"places"`
+	Links          []interface{} `json:"links"`
+	FeedPublishers []interface{} `json:"feed_publishers"`
+	Context        interface{}   `json:"context"`
+}
+
+// GetPlaces searches the stop areas matching a query in a coverage, ranked by navitia. The empty coverage is the
+// default one.
+func (c *NavitiaClient) GetPlaces(ctx context.Context, coverage string, q string) (stops []model.Stop, err error) {
+	coverage = c.coverage(coverage)
+	query := url.Values{}
+	query.Set("q", q)
+	query.Set("type[]", "stop_area")
+	request := fmt.Sprintf("%s/coverage/%s/places?%s", c.baseURL, coverage, query.Encode())
+	result, err := c.cache.get(ctx, request, c.stopsTTL, func(ctx context.Context) (interface{}, error) {
+		var data PlacesResponse
+		if err := c.get(ctx, request, "GetPlaces "+q, &data); err != nil {
+			return nil, err
+		}
+		var stops []model.Stop
+		for _, place := range data.Places {
+			if place.EmbeddedType != "stop_area" {
+				continue
+			}
+			name := place.StopArea.Label
+			if name == "" {
+				name = place.Name
+			}
+			stops = append(stops, model.Stop{Id: place.StopArea.ID, Name: name, Coverage: coverage})
+		}
+		return stops, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]model.Stop), nil
+}
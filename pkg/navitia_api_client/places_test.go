@@ -0,0 +1,37 @@
+package navitia_api_client
+
+import (
+	"context"
+	"testing"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetPlaces(t *testing.T) {
+	// invalid json
+	client, ts := newTestClientFromFilename(t, "test_data/invalid.json")
+	_, err := client.GetPlaces(context.Background(), "", "saint etienne")
+	requireErrorTypeMatch(t, err, JsonDecodeError{})
+	ts.Close()
+	// normal working request in the default coverage, only stop areas are kept
+	client, ts = newTestClientFromFilenames(t, []testClientCase{
+		testClientCase{"/coverage/sncf/places?q=saint+etienne&type%5B%5D=stop_area", "test_data/places-saint-etienne.json"},
+	})
+	defer ts.Close()
+	client.coverages = []string{"sncf", "fr-se"}
+	stops, err := client.GetPlaces(context.Background(), "", "saint etienne")
+	require.NoError(t, err)
+	require.Equal(t, []model.Stop{
+		model.Stop{Id: "stop_area:SNCF:87726000", Name: "Saint-Étienne Châteaucreux (Saint-Étienne)", Coverage: "sncf"},
+		model.Stop{Id: "stop_area:SNCF:87726802", Name: "Saint-Étienne Bellevue (Saint-Étienne)", Coverage: "sncf"},
+	}, stops)
+	// other coverages are only searched when asked for
+	_, err = client.GetPlaces(context.Background(), "fr-se", "saint etienne")
+	require.Error(t, err)
+	// results are cached
+	ts.Close()
+	stops, err = client.GetPlaces(context.Background(), "", "saint etienne")
+	require.NoError(t, err)
+	require.Len(t, stops, 2)
+}
@@ -0,0 +1,172 @@
+package navitia_api_client
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// QuotaStore persists the daily count of api requests of each token so that the quota survives restarts. Tokens are
+// identified by a fingerprint, never by their secret value
+type QuotaStore interface {
+	GetApiRequests(ctx context.Context, token string, day string) (int, error)
+	IncrementApiRequests(ctx context.Context, token string, day string) error
+}
+
+// QuotaStats is a snapshot of the api usage, summed up over all the tokens
+type QuotaStats struct {
+	Day         string
+	Requests    int
+	DailyBudget int
+	// Refused counts the requests refused because the daily budget was exhausted, since startup
+	Refused uint64
+	Rate    float64
+	Burst   int
+	// Tokens details the usage of each token
+	Tokens []TokenStats
+}
+
+// Remaining returns the number of api requests left for the day
+func (s QuotaStats) Remaining() int {
+	if s.Requests > s.DailyBudget {
+		return 0
+	}
+	return s.DailyBudget - s.Requests
+}
+
+// quota counts the upstream api requests of a token against a daily budget
+type quota struct {
+	// store may be nil, requests are then only counted in memory
+	store       QuotaStore
+	token       string
+	dailyBudget int
+	now         func() time.Time
+
+	mutex    sync.Mutex
+	day      string
+	requests int
+	refused  uint64
+}
+
+func newQuota(store QuotaStore, token string, dailyBudget int) *quota {
+	return &quota{
+		store:       store,
+		token:       token,
+		dailyBudget: dailyBudget,
+		now:         time.Now,
+	}
+}
+
+const quotaDayLayout = "2006-01-02"
+
+// acquire records an upstream request, it fails if the daily budget is exhausted
+func (q *quota) acquire(ctx context.Context) error {
+	q.mutex.Lock()
+	q.rollover(ctx, q.now())
+	if q.dailyBudget > 0 && q.requests >= q.dailyBudget {
+		q.refused++
+		q.mutex.Unlock()
+		return newQuotaExceededError(q.dailyBudget)
+	}
+	q.requests++
+	day := q.day
+	q.mutex.Unlock()
+	if q.store != nil {
+		if err := q.store.IncrementApiRequests(ctx, q.token, day); err != nil {
+			log.Printf("failed to persist the navitia api requests count: %+v", err)
+		}
+	}
+	return nil
+}
+
+// remaining returns the number of requests left for the day, or -1 when there is no limit
+func (q *quota) remaining(ctx context.Context) int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover(ctx, q.now())
+	if q.dailyBudget <= 0 {
+		return -1
+	}
+	if q.requests > q.dailyBudget {
+		return 0
+	}
+	return q.dailyBudget - q.requests
+}
+
+// rollover resets the counters when the day changes, loading the count persisted by a previous run if any. The
+// mutex must be held
+func (q *quota) rollover(ctx context.Context, now time.Time) {
+	day := now.Format(quotaDayLayout)
+	if day == q.day {
+		return
+	}
+	q.day = day
+	q.requests = 0
+	if q.store != nil {
+		requests, err := q.store.GetApiRequests(ctx, q.token, day)
+		if err != nil {
+			log.Printf("failed to load the navitia api requests count: %+v", err)
+			return
+		}
+		q.requests = requests
+	}
+}
+
+// Stats returns a snapshot of the token usage
+func (q *quota) Stats() QuotaStats {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.rollover(context.Background(), q.now())
+	return QuotaStats{
+		Day:         q.day,
+		Requests:    q.requests,
+		DailyBudget: q.dailyBudget,
+		Refused:     q.refused,
+	}
+}
+
+// tokenBucket is a rate limiter: tokens accumulate at rate per second up to burst, and each request consumes one
+type tokenBucket struct {
+	// rate is the number of tokens per second, 0 means no limit
+	rate  float64
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// reserve consumes a token and returns how long the caller must wait before using it. The tokens can go negative:
+// callers then queue up, each one waiting for the token it borrowed to be refilled
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
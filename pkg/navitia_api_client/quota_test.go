@@ -0,0 +1,117 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// quotaMockStore counts the requests by token and day, the keys are the token and the day separated by a space
+type quotaMockStore struct {
+	requests map[string]int
+	err      error
+}
+
+func (s *quotaMockStore) GetApiRequests(ctx context.Context, token string, day string) (int, error) {
+	return s.requests[token+" "+day], s.err
+}
+
+func (s *quotaMockStore) IncrementApiRequests(ctx context.Context, token string, day string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.requests[token+" "+day]++
+	return nil
+}
+
+func TestQuotaBudget(t *testing.T) {
+	store := &quotaMockStore{requests: map[string]int{"token 2021-05-03": 3}}
+	q := newQuota(store, "token", 5)
+	now := time.Date(2021, 5, 3, 23, 59, 0, 0, time.Local)
+	q.now = func() time.Time { return now }
+	// the count persisted by a previous run is taken into account
+	require.NoError(t, q.acquire(context.Background()))
+	require.NoError(t, q.acquire(context.Background()))
+	err := q.acquire(context.Background())
+	require.Error(t, err)
+	requireErrorTypeMatch(t, err, QuotaExceededError{})
+	require.Equal(t, QuotaStats{Day: "2021-05-03", Requests: 5, DailyBudget: 5, Refused: 1}, q.Stats())
+	require.Equal(t, 0, q.Stats().Remaining())
+	require.Equal(t, 0, q.remaining(context.Background()))
+	require.Equal(t, 5, store.requests["token 2021-05-03"])
+	// the budget is reset the next day
+	now = now.Add(time.Hour)
+	require.NoError(t, q.acquire(context.Background()))
+	require.Equal(t, 1, store.requests["token 2021-05-04"])
+	require.Equal(t, 4, q.Stats().Remaining())
+	require.Equal(t, 4, q.remaining(context.Background()))
+	// a failing store does not prevent requests
+	store.err = fmt.Errorf("database error")
+	now = now.Add(24 * time.Hour)
+	require.NoError(t, q.acquire(context.Background()))
+	require.Equal(t, 1, q.Stats().Requests)
+	// no store and no budget means no limit
+	q = newQuota(nil, "", 0)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, q.acquire(context.Background()))
+	}
+	require.Equal(t, 10, q.Stats().Requests)
+	require.Equal(t, -1, q.remaining(context.Background()))
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(2, 3, now)
+	// a full bucket allows a burst
+	for i := 0; i < 3; i++ {
+		require.Equal(t, time.Duration(0), b.reserve(now))
+	}
+	// then requests are spaced according to the rate
+	require.Equal(t, 500*time.Millisecond, b.reserve(now))
+	require.Equal(t, time.Second, b.reserve(now))
+	// the bucket refills over time but never above its burst
+	require.Equal(t, time.Duration(0), b.reserve(now.Add(time.Second+500*time.Millisecond)))
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, time.Duration(0), b.reserve(now))
+	}
+	require.Equal(t, 500*time.Millisecond, b.reserve(now))
+	// a zero rate means no limit
+	b = newTokenBucket(0, 1, now)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, time.Duration(0), b.reserve(now))
+	}
+}
+
+func TestQuotaExceededServesFromCache(t *testing.T) {
+	page, err := ioutil.ReadFile("test_data/normal-crepieux.json")
+	require.NoError(t, err)
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(page)
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	client.tokens = newTokenPool(nil, "round_robin", nil, 1)
+	client.departuresTTL = time.Millisecond
+	departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, departures, 10)
+	time.Sleep(2 * time.Millisecond)
+	// the budget is exhausted so the expired departures are served
+	departures, err = client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, departures, 10)
+	// but there is nothing to serve for an unknown stop
+	_, err = client.GetDepartures(context.Background(), "sncf", "other", BoardOptions{})
+	requireErrorTypeMatch(t, err, QuotaExceededError{})
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
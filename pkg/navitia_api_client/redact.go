@@ -0,0 +1,65 @@
+package navitia_api_client
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces the secrets in urls and error messages
+const redacted = "REDACTED"
+
+// sensitiveQueryParameters are the query parameters some navitia implementations accept credentials in
+var sensitiveQueryParameters = []string{"key", "token", "apikey"}
+
+// redactURL removes the credentials from an url so that it can be logged or returned in an error
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// we cannot tell which part is sensitive
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	query := u.Query()
+	changed := false
+	for _, k := range sensitiveQueryParameters {
+		if _, ok := query[k]; ok {
+			query.Set(k, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// redactedError hides secrets from the message of an error while preserving its chain
+type redactedError struct {
+	err     error
+	secrets []string
+}
+
+func (e redactedError) Error() string {
+	msg := e.err.Error()
+	for _, secret := range e.secrets {
+		msg = strings.ReplaceAll(msg, secret, redacted)
+	}
+	return msg
+}
+func (e redactedError) Unwrap() error { return e.err }
+
+// redact makes sure an error coming from the http client never exposes the api tokens
+func (c *NavitiaClient) redact(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactURL(urlErr.URL)
+	}
+	secrets := c.tokens.secrets()
+	if len(secrets) == 0 {
+		return err
+	}
+	return redactedError{err: err, secrets: secrets}
+}
@@ -0,0 +1,91 @@
+package navitia_api_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"git.adyxax.org/adyxax/trains/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "12345678-9abc-def0-1234-56789abcdef0"
+
+// requireNoToken checks every message in an error chain
+func requireNoToken(t *testing.T, err error) {
+	require.Error(t, err)
+	for ; err != nil; err = errors.Unwrap(err) {
+		require.NotContains(t, err.Error(), testToken)
+		require.NotContains(t, fmt.Sprintf("%+v", err), testToken)
+	}
+}
+
+func TestRedactURL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"an url without credentials should be unchanged", "https://api.sncf.com/v1/coverage/sncf/stop_areas?count=1000", "https://api.sncf.com/v1/coverage/sncf/stop_areas?count=1000"},
+		{"userinfo should be redacted", "https://" + testToken + "@api.sncf.com/v1", "https://REDACTED@api.sncf.com/v1"},
+		{"credentials in the query should be redacted", "https://navitia.example.com/v1?count=10&key=" + testToken, "https://navitia.example.com/v1?count=10&key=REDACTED"},
+		{"an unparsable url should be redacted entirely", "https://" + testToken + "}@api.sncf.com/%zz", "REDACTED"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, redactURL(tc.input))
+		})
+	}
+}
+
+func TestTokenIsSentInHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != testToken || r.URL.User != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"stop_areas": []}`))
+	}))
+	defer ts.Close()
+	client := NewClient(&config.Config{Token: testToken, Url: ts.URL, Coverages: []string{"sncf"}}, nil, nil)
+	_, err := client.GetStops(context.Background())
+	require.NoError(t, err)
+	require.NotContains(t, client.baseURL, testToken)
+}
+
+func TestTokenNeverInErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/coverage/sncf/stop_areas/error/departures":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.Write([]byte(`invalid json ` + r.Header.Get("Authorization")))
+		}
+	}))
+	defer ts.Close()
+	client := NewClient(&config.Config{Token: testToken, Url: ts.URL, Coverages: []string{"sncf"}}, nil, nil)
+	// api errors
+	_, err := client.GetDepartures(context.Background(), "sncf", "error", BoardOptions{})
+	requireErrorTypeMatch(t, err, ApiError{})
+	requireNoToken(t, err)
+	// json errors
+	_, err = client.GetDepartures(context.Background(), "sncf", "json", BoardOptions{})
+	requireErrorTypeMatch(t, err, JsonDecodeError{})
+	requireNoToken(t, err)
+	// http client errors, even when the token ended up in the url
+	ts.Close()
+	_, err = client.GetArrivals(context.Background(), "sncf", "unreachable", BoardOptions{})
+	requireErrorTypeMatch(t, err, HttpClientError{})
+	requireNoToken(t, err)
+	client.baseURL = "http://" + testToken + "@127.0.0.1:1/v1"
+	_, err = client.GetArrivals(context.Background(), "sncf", "unreachable", BoardOptions{})
+	requireErrorTypeMatch(t, err, HttpClientError{})
+	requireNoToken(t, err)
+	client.baseURL = "http://" + testToken + "}@127.0.0.1:1/v1"
+	_, err = client.GetArrivals(context.Background(), "sncf", "invalid", BoardOptions{})
+	requireErrorTypeMatch(t, err, HttpClientError{})
+	requireNoToken(t, err)
+}
@@ -0,0 +1,66 @@
+package navitia_api_client
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryPolicy decides whether and when a failed api request is attempted again
+type retryPolicy struct {
+	// attempts is the maximum number of attempts of a request, 1 disables retries
+	attempts       int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// backoff returns how long to wait before the attempt following the given one, the second return is false when the
+// request should not be retried: either because the error is not transient or because the api asked us to wait
+// longer than we are willing to
+func (p retryPolicy) backoff(attempt int, err error) (time.Duration, bool) {
+	if attempt+1 >= p.attempts || !transient(err) {
+		return 0, false
+	}
+	var apiErr ApiError
+	if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+		return apiErr.retryAfter, apiErr.retryAfter <= p.maxBackoff
+	}
+	d := p.initialBackoff << uint(attempt)
+	if d > p.maxBackoff || d <= 0 {
+		d = p.maxBackoff
+	}
+	// jitter between half and the whole backoff so that clients failing together do not retry together
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+// transient returns true for the errors that are worth retrying: connection failures, throttling and server errors
+func transient(err error) bool {
+	var httpErr HttpClientError
+	if errors.As(err, &httpErr) {
+		return true
+	}
+	var apiErr ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.code == http.StatusTooManyRequests || apiErr.code >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header, expressed either in seconds or as an http date
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := retryPolicy{attempts: 4, initialBackoff: 100 * time.Millisecond, maxBackoff: 300 * time.Millisecond}
+	serverErr := newApiError(http.StatusServiceUnavailable, "test", 0)
+	testCases := []struct {
+		name    string
+		attempt int
+		err     error
+		min     time.Duration
+		max     time.Duration
+		retry   bool
+	}{
+		{"a server error should be retried", 0, serverErr, 50 * time.Millisecond, 100 * time.Millisecond, true},
+		{"the backoff should double", 1, serverErr, 100 * time.Millisecond, 200 * time.Millisecond, true},
+		{"the backoff should be capped", 2, serverErr, 150 * time.Millisecond, 300 * time.Millisecond, true},
+		{"the last attempt should not be retried", 3, serverErr, 0, 0, false},
+		{"a connection error should be retried", 0, newHttpClientError("test", fmt.Errorf("connection reset")), 50 * time.Millisecond, 100 * time.Millisecond, true},
+		{"a not found error should not be retried", 0, newApiError(http.StatusNotFound, "test", 0), 0, 0, false},
+		{"a json error should not be retried", 0, newJsonDecodeError("test", fmt.Errorf("invalid")), 0, 0, false},
+		{"an exhausted quota should not be retried", 0, newQuotaExceededError(1), 0, 0, false},
+		{"a throttled request should wait as asked", 0, newApiError(http.StatusTooManyRequests, "test", 250*time.Millisecond), 250 * time.Millisecond, 250 * time.Millisecond, true},
+		{"a throttled request should not wait longer than the max backoff", 0, newApiError(http.StatusTooManyRequests, "test", time.Hour), time.Hour, time.Hour, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 10; i++ {
+				d, retry := p.backoff(tc.attempt, tc.err)
+				require.Equal(t, tc.retry, retry)
+				require.GreaterOrEqual(t, d, tc.min)
+				require.LessOrEqual(t, d, tc.max)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 5, 3, 12, 0, 0, 0, time.UTC)
+	require.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	require.Equal(t, 120*time.Second, parseRetryAfter("120", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	require.Equal(t, 30*time.Second, parseRetryAfter("Mon, 03 May 2021 12:00:30 GMT", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("Mon, 03 May 2021 11:00:00 GMT", now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestClientRetries(t *testing.T) {
+	page, err := ioutil.ReadFile("test_data/normal-crepieux.json")
+	require.NoError(t, err)
+	var requests int32
+	var failures int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&requests, 1)
+		switch {
+		case r.URL.Path == "/coverage/sncf/stop_areas/missing/departures":
+			w.WriteHeader(http.StatusNotFound)
+		case n <= atomic.LoadInt32(&failures) && n%2 == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case n <= atomic.LoadInt32(&failures):
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write(page)
+		}
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	client.retry = retryPolicy{attempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	// transient failures are retried
+	atomic.StoreInt32(&failures, 2)
+	departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, departures, 10)
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	// until we run out of attempts
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&failures, 3)
+	_, err = client.GetDepartures(context.Background(), "sncf", "other", BoardOptions{})
+	requireErrorTypeMatch(t, err, ApiError{})
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	// other errors are not retried
+	atomic.StoreInt32(&requests, 0)
+	atomic.StoreInt32(&failures, 0)
+	_, err = client.GetDepartures(context.Background(), "sncf", "missing", BoardOptions{})
+	requireErrorTypeMatch(t, err, ApiError{})
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
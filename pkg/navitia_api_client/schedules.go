@@ -0,0 +1,121 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+type StopSchedulesResponse struct {
+	Pagination    Pagination `json:"pagination"`
+	StopSchedules []struct {
+		DisplayInformations struct {
+			Direction      string `json:"direction"`
+			Label          string `json:"label"`
+			Name           string `json:"name"`
+			CommercialMode string `json:"commercial_mode"`
+		} `json:"display_informations"`
+		Route struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"route"`
+		StopPoint struct {
+			ID string `json:"id"`
+		} `json:"stop_point"`
+		DateTimes []struct {
+			DateTime      string `json:"date_time"`
+			BaseDateTime  string `json:"base_date_time"`
+			DataFreshness string `json:"data_freshness"`
+		} `json:"date_times"`
+		AdditionalInformations string `json:"additional_informations"`
+	} `json:"stop_schedules"`
+	Context struct {
+		Timezone        string `json:"timezone"`
+		CurrentDatetime string `json:"current_datetime"`
+	} `json:"context"`
+}
+
+// GetStopSchedules returns the planned timetable of a stop for a whole day, grouped by route and direction. The date
+// is expressed in the timezone of the coverage.
+func (c *NavitiaClient) GetStopSchedules(ctx context.Context, coverage string, stop string, date time.Time) (schedules []model.Schedule, err error) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	query := url.Values{}
+	query.Set("from_datetime", day.Format(navitiaDateTimeLayout))
+	query.Set("duration", strconv.Itoa(int(24*time.Hour/time.Second)))
+	query.Set("data_freshness", "base_schedule")
+	query.Set("count", strconv.Itoa(boardPageSize))
+	base := fmt.Sprintf("%s/coverage/%s/stop_areas/%s/stop_schedules?%s", c.baseURL, c.coverage(coverage), stop, query.Encode())
+	// theoretical timetables change about as often as stops
+	result, err := c.cache.get(ctx, base, c.stopsTTL, func(ctx context.Context) (interface{}, error) {
+		var schedules []model.Schedule
+		for page := 0; page < maxBoardPages; page++ {
+			request := base
+			if page > 0 {
+				request += "&start_page=" + strconv.Itoa(page)
+			}
+			var data StopSchedulesResponse
+			if err := c.get(ctx, request, "GetStopSchedules "+stop, &data); err != nil {
+				return nil, err
+			}
+			var err error
+			if schedules, err = data.schedules(schedules); err != nil {
+				return nil, err
+			}
+			if data.Pagination.last() {
+				break
+			}
+		}
+		for _, s := range schedules {
+			sort.Slice(s.Departures, func(i, j int) bool { return s.Departures[i].Before(s.Departures[j]) })
+		}
+		return schedules, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.([]model.Schedule), nil
+}
+
+// schedules converts the raw navitia response to our model and merges it into the schedules already known: navitia
+// returns a schedule per stop point of the stop area, the trains of a route can call at several of them
+func (data *StopSchedulesResponse) schedules(schedules []model.Schedule) ([]model.Schedule, error) {
+	loc := responseLocation(data.Context.Timezone)
+	for _, s := range data.StopSchedules {
+		if len(s.DateTimes) == 0 {
+			continue
+		}
+		i := 0
+		for i < len(schedules) && schedules[i].Route != s.Route.ID {
+			i++
+		}
+		if i == len(schedules) {
+			line := s.DisplayInformations.Label
+			if line == "" {
+				line = s.DisplayInformations.Name
+			}
+			schedules = append(schedules, model.Schedule{
+				Route:          s.Route.ID,
+				Line:           line,
+				CommercialMode: s.DisplayInformations.CommercialMode,
+				Direction:      s.DisplayInformations.Direction,
+			})
+		}
+		for _, dt := range s.DateTimes {
+			raw := dt.BaseDateTime
+			if raw == "" {
+				raw = dt.DateTime
+			}
+			t, err := parseDateTime(raw, loc)
+			if err != nil {
+				return nil, err
+			}
+			schedules[i].Departures = append(schedules[i].Departures, t)
+		}
+	}
+	return schedules, nil
+}
@@ -0,0 +1,75 @@
+package navitia_api_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStopSchedules(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+		page := r.URL.Query().Get("start_page")
+		if page == "" {
+			page = "0"
+		}
+		http.ServeFile(w, r, "test_data/stop-schedules-crepieux-page-"+page+".json")
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	// the whole day is requested whatever the time, and schedules of the same route are merged
+	schedules, err := client.GetStopSchedules(context.Background(), "", "test", time.Date(2021, 5, 3, 14, 30, 0, 0, paris))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/coverage/sncf/stop_areas/test/stop_schedules?count=50&data_freshness=base_schedule&duration=86400&from_datetime=20210503T000000",
+		"/coverage/sncf/stop_areas/test/stop_schedules?count=50&data_freshness=base_schedule&duration=86400&from_datetime=20210503T000000&start_page=1",
+	}, queries)
+	require.Equal(t, []model.Schedule{
+		model.Schedule{
+			Route:          "route:OCE:TER-87726000-87743716",
+			Line:           "St-Etienne - Lyon - Ambérieu",
+			CommercialMode: "TER",
+			Direction:      "Ambérieu-en-Bugey (Ambérieu-en-Bugey)",
+			Departures: []time.Time{
+				time.Date(2021, 5, 3, 5, 42, 0, 0, paris),
+				time.Date(2021, 5, 3, 6, 15, 0, 0, paris),
+				time.Date(2021, 5, 3, 6, 42, 0, 0, paris),
+				time.Date(2021, 5, 3, 18, 12, 0, 0, paris),
+			},
+		},
+		model.Schedule{
+			Route:          "route:OCE:TER-87743716-87723197",
+			Line:           "St-Etienne - Lyon - Ambérieu",
+			CommercialMode: "TER",
+			Direction:      "Lyon Part-Dieu (Lyon)",
+			Departures: []time.Time{
+				time.Date(2021, 5, 3, 6, 5, 0, 0, paris),
+				time.Date(2021, 5, 3, 7, 5, 0, 0, paris),
+			},
+		},
+	}, schedules)
+	// timetables are cached per day
+	queries = nil
+	_, err = client.GetStopSchedules(context.Background(), "", "test", time.Date(2021, 5, 3, 20, 0, 0, 0, paris))
+	require.NoError(t, err)
+	require.Empty(t, queries)
+	// invalid responses should fail
+	client, ts = newTestClientFromFilename(t, "test_data/invalid.json")
+	defer ts.Close()
+	_, err = client.GetStopSchedules(context.Background(), "sncf", "test", time.Date(2021, 5, 3, 0, 0, 0, 0, paris))
+	requireErrorTypeMatch(t, err, JsonDecodeError{})
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"stop_schedules": [{"route": {"id": "test"}, "date_times": [{"date_time": "20210503T25"}]}]}`))
+	}))
+	defer ts.Close()
+	_, err = newTestClient(ts).GetStopSchedules(context.Background(), "sncf", "test", time.Date(2021, 5, 3, 0, 0, 0, 0, paris))
+	requireErrorTypeMatch(t, err, DateParsingError{})
+}
@@ -1,9 +1,8 @@
 package navitia_api_client
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 
 	"git.adyxax.org/adyxax/trains/pkg/model"
 )
@@ -16,14 +15,26 @@ type StopsResponse struct {
 		TotalResult  int `json:"total_result"`
 	} `json:"pagination"`
 	StopAreas []struct {
-		Name                 string        `json:"name"`
-		ID                   string        `json:"id"`
-		Codes                []interface{} `json:"codes"`
-		Links                []interface{} `json:"links"`
-		Coord                interface{}   `json:"coord"`
-		Label                string        `json:"label"`
-		Timezone             interface{}   `json:"timezone"`
-		AdministrativeRegion interface{}   `json:"administrative_regions"`
+		Name  string `json:"name"`
+		ID    string `json:"id"`
+		Codes []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"codes"`
+		Links []interface{} `json:"links"`
+		Coord struct {
+			Lat string `json:"lat"`
+			Lon string `json:"lon"`
+		} `json:"coord"`
+		Label                 string `json:"label"`
+		Timezone              string `json:"timezone"`
+		AdministrativeRegions []struct {
+			ID      string `json:"id"`
+			Name    string `json:"name"`
+			Label   string `json:"label"`
+			Level   int    `json:"level"`
+			ZipCode string `json:"zip_code"`
+		} `json:"administrative_regions"`
 	} `json:"stop_areas"`
 	Links          []interface{} `json:"links"`
 	Disruptions    []interface{} `json:"disruptions"`
@@ -31,40 +42,83 @@ type StopsResponse struct {
 	Context        interface{}   `json:"context"`
 }
 
-func (c *NavitiaClient) GetStops() (stops []model.Stop, err error) {
-	return getStopsPage(c, 0)
-}
-
-func getStopsPage(c *NavitiaClient, i int) (stops []model.Stop, err error) {
-	request := fmt.Sprintf("%s/coverage/sncf/stop_areas?count=1000&start_page=%d", c.baseURL, i)
-	req, err := http.NewRequest("GET", request, nil)
+func (c *NavitiaClient) GetStops(ctx context.Context) (stops []model.Stop, err error) {
+	result, err := c.cache.get(ctx, "GetStops", c.stopsTTL, func(ctx context.Context) (interface{}, error) {
+		var stops []model.Stop
+		// a stop can belong to several coverages, the first configured one wins
+		seen := make(map[string]bool)
+		for _, coverage := range c.coverages {
+			coverageStops, err := getStopsPage(ctx, c, coverage, 0)
+			if err != nil {
+				return nil, err
+			}
+			for _, stop := range coverageStops {
+				if !seen[stop.Id] {
+					seen[stop.Id] = true
+					stops = append(stops, stop)
+				}
+			}
+		}
+		return stops, nil
+	})
 	if err != nil {
-		return nil, newHttpClientError("http.NewRequest error", err)
+		return nil, err
 	}
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, newHttpClientError("httpClient.Do error", err)
+	return result.([]model.Stop), nil
+}
+
+func getStopsPage(ctx context.Context, c *NavitiaClient, coverage string, i int) (stops []model.Stop, err error) {
+	request := fmt.Sprintf("%s/coverage/%s/stop_areas?count=1000&start_page=%d", c.baseURL, coverage, i)
+	var data StopsResponse
+	if err = c.get(ctx, request, "GetStops", &data); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		var data StopsResponse
-		if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
-			return nil, newJsonDecodeError("GetStops ", err)
+	for i := 0; i < len(data.StopAreas); i++ {
+		stopArea := &data.StopAreas[i]
+		if stopArea.Label == "" {
+			continue
+		}
+		stop := model.Stop{
+			Id:       stopArea.ID,
+			Name:     stopArea.Label,
+			Coverage: coverage,
+			Timezone: stopArea.Timezone,
+			Coord:    parseCoord(stopArea.Coord.Lat, stopArea.Coord.Lon),
 		}
-		for i := 0; i < len(data.StopAreas); i++ {
-			if data.StopAreas[i].Label != "" {
-				stops = append(stops, model.Stop{data.StopAreas[i].ID, data.StopAreas[i].Label})
+		for _, code := range stopArea.Codes {
+			if code.Type == "uic" {
+				stop.Uic = code.Value
+				break
 			}
 		}
-		if data.Pagination.ItemsOnPage+data.Pagination.ItemsPerPage*data.Pagination.StartPage < data.Pagination.TotalResult {
-			tss, err := getStopsPage(c, i+1)
-			if err != nil {
-				return nil, err
+		// the most detailed administrative region is the city, its label tells apart the towns sharing a name
+		level := -1
+		for _, region := range stopArea.AdministrativeRegions {
+			if region.Level > level {
+				level = region.Level
+				stop.City = region.Label
+				if stop.City == "" {
+					stop.City = region.Name
+				}
 			}
-			stops = append(stops, tss...)
 		}
-	} else {
-		err = newApiError(resp.StatusCode, "GetStops")
+		stops = append(stops, stop)
+	}
+	if data.Pagination.ItemsOnPage+data.Pagination.ItemsPerPage*data.Pagination.StartPage < data.Pagination.TotalResult {
+		tss, err := getStopsPage(ctx, c, coverage, i+1)
+		if err != nil {
+			return nil, err
+		}
+		stops = append(stops, tss...)
 	}
 	return
 }
+
+// parseCoord returns nil for missing or invalid coordinates, navitia reports unknown ones as 0
+func parseCoord(lat string, lon string) *model.Coord {
+	coord, err := model.ParseCoord(lat, lon)
+	if err != nil || coord.Lat == 0 && coord.Lon == 0 {
+		return nil
+	}
+	return coord
+}
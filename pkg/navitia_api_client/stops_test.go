@@ -1,10 +1,12 @@
 package navitia_api_client
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"git.adyxax.org/adyxax/trains/pkg/config"
 	"git.adyxax.org/adyxax/trains/pkg/model"
 	"github.com/stretchr/testify/require"
 )
@@ -22,8 +24,8 @@ func TestGetStops(t *testing.T) {
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			client := NewClient(tc.inputNewCLient)
-			valid, err := client.GetStops()
+			client := NewClient(&config.Config{Token: tc.inputNewCLient, Coverages: []string{"sncf"}}, nil, nil)
+			valid, err := client.GetStops(context.Background())
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -47,7 +49,7 @@ func TestGetStops(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			client, ts := newTestClientFromFilename(t, tc.inputFilename)
 			defer ts.Close()
-			valid, err := client.GetStops()
+			valid, err := client.GetStops(context.Background())
 			if tc.expectedError != nil {
 				require.Error(t, err)
 				requireErrorTypeMatch(t, err, tc.expectedError)
@@ -63,14 +65,14 @@ func TestGetStops(t *testing.T) {
 		w.WriteHeader(http.StatusNotFound)
 	}))
 	client := newTestClient(ts)
-	_, err := client.GetStops()
+	_, err := client.GetStops(context.Background())
 	if err == nil {
 		t.Fatalf("404 should raise an error")
 	}
 	// normal working request
 	client, ts = newTestClientFromFilename(t, "test_data/4-train-stops.json")
 	defer ts.Close()
-	stops, err := client.GetStops()
+	stops, err := client.GetStops(context.Background())
 	if err != nil {
 		t.Fatalf("could not get train stops : %s", err)
 	}
@@ -85,7 +87,7 @@ func TestGetStops(t *testing.T) {
 		testClientCase{"/coverage/sncf/stop_areas?count=1000&start_page=2", "test_data/4-train-stops-page-2.json"},
 	})
 	defer ts.Close()
-	stops, err = client.GetStops()
+	stops, err = client.GetStops(context.Background())
 	if err != nil {
 		t.Fatalf("could not get train stops : %+v", err)
 	}
@@ -99,8 +101,47 @@ func TestGetStops(t *testing.T) {
 		testClientCase{"/coverage/sncf/stop_areas?count=1000&start_page=1", "test_data/4-train-stops-page-1.json"},
 	})
 	defer ts.Close()
-	stops, err = client.GetStops()
+	stops, err = client.GetStops(context.Background())
 	if err == nil {
 		t.Fatalf("should not be able to get train stops : %+v", stops)
 	}
+	// several coverages
+	client, ts = newTestClientFromFilenames(t, []testClientCase{
+		testClientCase{"/coverage/sncf/stop_areas?count=1000&start_page=0", "test_data/4-train-stops.json"},
+		testClientCase{"/coverage/fr-se/stop_areas?count=1000&start_page=0", "test_data/fr-se-stops.json"},
+	})
+	defer ts.Close()
+	client.coverages = []string{"sncf", "fr-se"}
+	stops, err = client.GetStops(context.Background())
+	require.NoError(t, err)
+	// the stop shared by both coverages belongs to the first one
+	require.Equal(t, []model.Stop{
+		model.Stop{Id: "stop_area:SNCF:87313759", Name: "Abancourt (Abancourt)", Coverage: "sncf", Uic: "87313759", City: "Abancourt (60220)", Timezone: "Europe/Paris", Coord: &model.Coord{Lat: 49.685602, Lon: 1.774351}},
+		model.Stop{Id: "stop_area:SNCF:87481614", Name: "Abbaretz (Abbaretz)", Coverage: "sncf", Uic: "87481614", City: "Abbaretz (44170)", Timezone: "Europe/Paris", Coord: &model.Coord{Lat: 47.555241, Lon: -1.524289}},
+		model.Stop{Id: "stop_area:SNCF:87317362", Name: "Abbeville (Abbeville)", Coverage: "sncf", Uic: "87317362", City: "Abbeville (80100)", Timezone: "Europe/Paris", Coord: &model.Coord{Lat: 50.102216, Lon: 1.824487}},
+		model.Stop{Id: "stop_area:TCL:SA:30101", Name: "Part-Dieu (Lyon)", Coverage: "fr-se", City: "Lyon", Timezone: "Europe/Paris"},
+	}, stops)
+}
+
+func TestParseCoord(t *testing.T) {
+	testCases := []struct {
+		name     string
+		lat      string
+		lon      string
+		expected *model.Coord
+	}{
+		{"valid", "45.760593", "4.859666", &model.Coord{Lat: 45.760593, Lon: 4.859666}},
+		{"missing", "", "", nil},
+		{"unknown", "0", "0", nil},
+		{"invalid latitude", "x", "4.859666", nil},
+		{"invalid longitude", "45.760593", "x", nil},
+		{"out of range", "91", "4.859666", nil},
+		{"not a number", "NaN", "4.859666", nil},
+		{"infinite", "45.760593", "Inf", nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, parseCoord(tc.lat, tc.lon))
+		})
+	}
 }
@@ -0,0 +1,185 @@
+package navitia_api_client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How long a token rejected by the api is avoided, a throttled one is avoided for as long as the api asks if it does
+const (
+	rejectedTokenCooldown  = time.Hour
+	throttledTokenCooldown = time.Minute
+)
+
+// TokenStats is a snapshot of the usage and health of an api token
+type TokenStats struct {
+	// Id is a fingerprint of the token, safe to display
+	Id          string
+	Requests    int
+	DailyBudget int
+	Refused     uint64
+	// Healthy is false when the api rejected the token recently, it is then avoided until UnhealthyUntil
+	Healthy        bool
+	UnhealthyUntil time.Time
+	// LastStatus is the http status code of the last rejection of the token
+	LastStatus int
+	// Rejections counts the requests the api rejected because of the token, since startup
+	Rejections uint64
+}
+
+// Remaining returns the number of api requests left for the day with this token
+func (s TokenStats) Remaining() int {
+	if s.Requests > s.DailyBudget {
+		return 0
+	}
+	return s.DailyBudget - s.Requests
+}
+
+type apiToken struct {
+	secret string
+	id     string
+	quota  *quota
+	// the following fields are protected by the pool mutex
+	unhealthyUntil time.Time
+	lastStatus     int
+	rejections     uint64
+}
+
+// tokenPool spreads the api requests among several tokens and fails over to the next one when a token is rejected
+type tokenPool struct {
+	// selection is either round_robin or budget, which prefers the token with the most requests left for the day
+	selection string
+	tokens    []*apiToken
+	now       func() time.Time
+
+	mutex sync.Mutex
+	next  int
+}
+
+// newTokenPool returns a pool of the given secrets, without any secret requests are sent without credentials which
+// suits self hosted navitia instances
+func newTokenPool(secrets []string, selection string, store QuotaStore, dailyBudget int) *tokenPool {
+	if len(secrets) == 0 {
+		secrets = []string{""}
+	}
+	p := &tokenPool{
+		selection: selection,
+		now:       time.Now,
+	}
+	for _, secret := range secrets {
+		id := tokenFingerprint(secret)
+		p.tokens = append(p.tokens, &apiToken{
+			secret: secret,
+			id:     id,
+			quota:  newQuota(store, id, dailyBudget),
+		})
+	}
+	return p
+}
+
+// tokenFingerprint identifies a token without revealing it
+func tokenFingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:4])
+}
+
+// candidates returns the tokens in the order they should be tried: the healthy ones first according to the
+// selection strategy, then the unhealthy ones starting with the soonest to recover
+func (p *tokenPool) candidates(ctx context.Context) []*apiToken {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := p.now()
+	var healthy, unhealthy []*apiToken
+	for i := 0; i < len(p.tokens); i++ {
+		t := p.tokens[(p.next+i)%len(p.tokens)]
+		if now.Before(t.unhealthyUntil) {
+			unhealthy = append(unhealthy, t)
+		} else {
+			healthy = append(healthy, t)
+		}
+	}
+	p.next = (p.next + 1) % len(p.tokens)
+	if p.selection == "budget" {
+		remaining := make(map[*apiToken]int)
+		for _, t := range healthy {
+			remaining[t] = t.quota.remaining(ctx)
+			if remaining[t] < 0 {
+				// no limit
+				remaining[t] = int(^uint(0) >> 1)
+			}
+		}
+		sort.SliceStable(healthy, func(i, j int) bool { return remaining[healthy[i]] > remaining[healthy[j]] })
+	}
+	sort.SliceStable(unhealthy, func(i, j int) bool { return unhealthy[i].unhealthyUntil.Before(unhealthy[j].unhealthyUntil) })
+	return append(healthy, unhealthy...)
+}
+
+// rejected marks a token unhealthy if the api refused the request because of it, in which case the request should be
+// sent again with another token
+func (p *tokenPool) rejected(t *apiToken, err error) bool {
+	var apiErr ApiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	cooldown := rejectedTokenCooldown
+	switch apiErr.code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+	case http.StatusTooManyRequests:
+		cooldown = throttledTokenCooldown
+		if apiErr.retryAfter > 0 {
+			cooldown = apiErr.retryAfter
+		}
+	default:
+		return false
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	t.unhealthyUntil = p.now().Add(cooldown)
+	t.lastStatus = apiErr.code
+	t.rejections++
+	return true
+}
+
+// secrets returns the values of the tokens, to redact them
+func (p *tokenPool) secrets() (secrets []string) {
+	for _, t := range p.tokens {
+		if t.secret != "" {
+			secrets = append(secrets, t.secret)
+		}
+	}
+	return
+}
+
+// Stats returns a snapshot of the usage of all the tokens
+func (p *tokenPool) Stats() (stats QuotaStats) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	now := p.now()
+	for _, t := range p.tokens {
+		q := t.quota.Stats()
+		stats.Day = q.Day
+		stats.Requests += q.Requests
+		stats.DailyBudget += q.DailyBudget
+		stats.Refused += q.Refused
+		stats.Tokens = append(stats.Tokens, TokenStats{
+			Id:             t.id,
+			Requests:       q.Requests,
+			DailyBudget:    q.DailyBudget,
+			Refused:        q.Refused,
+			Healthy:        !now.Before(t.unhealthyUntil),
+			UnhealthyUntil: t.unhealthyUntil,
+			LastStatus:     t.lastStatus,
+			Rejections:     t.rejections,
+		})
+	}
+	return
+}
@@ -0,0 +1,136 @@
+package navitia_api_client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenPoolRoundRobin(t *testing.T) {
+	p := newTokenPool([]string{"a", "b", "c"}, "round_robin", nil, 0)
+	var firsts []string
+	for i := 0; i < 4; i++ {
+		firsts = append(firsts, p.candidates(context.Background())[0].secret)
+	}
+	require.Equal(t, []string{"a", "b", "c", "a"}, firsts)
+	// every token is a candidate
+	require.Len(t, p.candidates(context.Background()), 3)
+}
+
+func TestTokenPoolBudget(t *testing.T) {
+	p := newTokenPool([]string{"a", "b", "c"}, "budget", nil, 10)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, p.tokens[0].quota.acquire(context.Background()))
+	}
+	require.NoError(t, p.tokens[2].quota.acquire(context.Background()))
+	for i := 0; i < 3; i++ {
+		candidates := p.candidates(context.Background())
+		require.Equal(t, "b", candidates[0].secret)
+		require.Equal(t, "c", candidates[1].secret)
+		require.Equal(t, "a", candidates[2].secret)
+	}
+}
+
+func TestTokenPoolRejections(t *testing.T) {
+	p := newTokenPool([]string{"a", "b", "c"}, "round_robin", nil, 0)
+	now := time.Date(2021, 5, 3, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	a, b, c := p.tokens[0], p.tokens[1], p.tokens[2]
+	// only rejections because of the token count
+	require.False(t, p.rejected(a, nil))
+	require.False(t, p.rejected(a, newApiError(http.StatusInternalServerError, "test", 0)))
+	require.False(t, p.rejected(a, newApiError(http.StatusNotFound, "test", 0)))
+	require.True(t, p.rejected(a, newApiError(http.StatusUnauthorized, "test", 0)))
+	require.True(t, p.rejected(b, newApiError(http.StatusTooManyRequests, "test", 10*time.Second)))
+	// unhealthy tokens are tried last, the soonest to recover first
+	require.Equal(t, []*apiToken{c, b, a}, p.candidates(context.Background()))
+	now = now.Add(10 * time.Second)
+	require.Equal(t, []*apiToken{b, c, a}, p.candidates(context.Background()))
+	stats := p.Stats()
+	require.Len(t, stats.Tokens, 3)
+	require.Equal(t, TokenStats{Id: a.id, UnhealthyUntil: now.Add(time.Hour - 10*time.Second), LastStatus: http.StatusUnauthorized, Rejections: 1}, stats.Tokens[0])
+	require.True(t, stats.Tokens[1].Healthy)
+	require.True(t, stats.Tokens[2].Healthy)
+	// fingerprints do not reveal the tokens
+	require.Len(t, a.id, 8)
+	require.NotEqual(t, a.id, b.id)
+	require.Equal(t, []string{"a", "b", "c"}, p.secrets())
+}
+
+func TestClientTokenFailover(t *testing.T) {
+	page, err := ioutil.ReadFile("test_data/normal-crepieux.json")
+	require.NoError(t, err)
+	var mutex sync.Mutex
+	seen := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		mutex.Lock()
+		seen[token]++
+		mutex.Unlock()
+		switch token {
+		case "revoked":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "throttled":
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write(page)
+		}
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	client.tokens = newTokenPool([]string{"revoked", "throttled", "valid"}, "round_robin", nil, 0)
+	departures, err := client.GetDepartures(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Len(t, departures, 10)
+	require.Equal(t, map[string]int{"revoked": 1, "throttled": 1, "valid": 1}, seen)
+	// the rejected tokens are avoided afterwards
+	_, err = client.GetArrivals(context.Background(), "sncf", "test", BoardOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"revoked": 1, "throttled": 1, "valid": 2}, seen)
+	stats := client.QuotaStats()
+	require.Equal(t, 4, stats.Requests)
+	require.False(t, stats.Tokens[0].Healthy)
+	require.Equal(t, http.StatusUnauthorized, stats.Tokens[0].LastStatus)
+	require.False(t, stats.Tokens[1].Healthy)
+	require.Equal(t, http.StatusTooManyRequests, stats.Tokens[1].LastStatus)
+	require.True(t, stats.Tokens[2].Healthy)
+	require.Equal(t, 2, stats.Tokens[2].Requests)
+	// when every token is rejected the last rejection is returned
+	client.tokens = newTokenPool([]string{"revoked", "throttled"}, "round_robin", nil, 0)
+	_, err = client.GetJourneys(context.Background(), "sncf", "a", "b", time.Now(), JourneyOptions{})
+	requireErrorTypeMatch(t, err, ApiError{})
+}
+
+func TestClientTokensExhausted(t *testing.T) {
+	page, err := ioutil.ReadFile("test_data/normal-crepieux.json")
+	require.NoError(t, err)
+	var mutex sync.Mutex
+	seen := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		seen[r.Header.Get("Authorization")]++
+		mutex.Unlock()
+		w.Write(page)
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	client.tokens = newTokenPool([]string{"a", "b"}, "round_robin", nil, 1)
+	for _, stop := range []string{"1", "2"} {
+		_, err = client.GetDepartures(context.Background(), "sncf", stop, BoardOptions{})
+		require.NoError(t, err)
+	}
+	require.Equal(t, map[string]int{"a": 1, "b": 1}, seen)
+	_, err = client.GetDepartures(context.Background(), "sncf", "3", BoardOptions{})
+	requireErrorTypeMatch(t, err, QuotaExceededError{})
+	stats := client.QuotaStats()
+	require.Equal(t, 2, stats.Requests)
+	require.Equal(t, 2, stats.DailyBudget)
+	require.Equal(t, 0, stats.Remaining())
+	require.Equal(t, uint64(2), stats.Refused)
+}
@@ -0,0 +1,196 @@
+package navitia_api_client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+)
+
+type VehicleJourneysResponse struct {
+	VehicleJourneys []struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Headsign  string `json:"headsign"`
+		StopTimes []struct {
+			// times of day, expressed like 131800
+			ArrivalTime   string `json:"arrival_time"`
+			DepartureTime string `json:"departure_time"`
+			StopPoint     struct {
+				ID       string `json:"id"`
+				Name     string `json:"name"`
+				Label    string `json:"label"`
+				StopArea struct {
+					ID   string `json:"id"`
+					Name string `json:"name"`
+				} `json:"stop_area"`
+			} `json:"stop_point"`
+			SkippedStop bool `json:"skipped_stop"`
+		} `json:"stop_times"`
+		Disruptions []Link `json:"disruptions"`
+	} `json:"vehicle_journeys"`
+	Disruptions []Disruption `json:"disruptions"`
+	Context     struct {
+		Timezone        string `json:"timezone"`
+		CurrentDatetime string `json:"current_datetime"`
+	} `json:"context"`
+}
+
+// GetVehicleJourney returns a train with every stop it calls at. Navitia only gives the times of day of a vehicle
+// journey, the date is the day the train leaves its origin in the timezone of the coverage.
+func (c *NavitiaClient) GetVehicleJourney(ctx context.Context, coverage string, id string, date time.Time) (vj *model.VehicleJourney, err error) {
+	data, err := c.rawVehicleJourney(ctx, coverage, id, c.departuresTTL)
+	if err != nil {
+		return nil, err
+	}
+	return data.vehicleJourney(id, date)
+}
+
+// rawVehicleJourney returns the raw navitia response of a vehicle journey. It is cached since it does not depend on
+// the date, the lookups which do not need its real-time disruptions can accept an older entry with a longer ttl.
+func (c *NavitiaClient) rawVehicleJourney(ctx context.Context, coverage string, id string, ttl time.Duration) (*VehicleJourneysResponse, error) {
+	request := fmt.Sprintf("%s/coverage/%s/vehicle_journeys/%s", c.baseURL, c.coverage(coverage), id)
+	result, err := c.cache.get(ctx, request, ttl, func(ctx context.Context) (interface{}, error) {
+		var data VehicleJourneysResponse
+		if err := c.get(ctx, request, "GetVehicleJourney "+id, &data); err != nil {
+			return nil, err
+		}
+		return &data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*VehicleJourneysResponse), nil
+}
+
+// origin returns the name of the first stop of a vehicle journey
+func (c *NavitiaClient) origin(ctx context.Context, coverage string, id string) (string, error) {
+	data, err := c.rawVehicleJourney(ctx, coverage, id, c.stopsTTL)
+	if err != nil {
+		return "", err
+	}
+	if len(data.VehicleJourneys) == 0 || len(data.VehicleJourneys[0].StopTimes) == 0 {
+		return "", newNotFoundError(id)
+	}
+	sp := data.VehicleJourneys[0].StopTimes[0].StopPoint
+	if sp.StopArea.Name != "" {
+		return sp.StopArea.Name, nil
+	}
+	return sp.Name, nil
+}
+
+// vehicleJourney converts the raw navitia response to our model, real-time times come from the disruptions
+func (data *VehicleJourneysResponse) vehicleJourney(id string, date time.Time) (*model.VehicleJourney, error) {
+	if len(data.VehicleJourneys) == 0 {
+		return nil, newNotFoundError(id)
+	}
+	raw := &data.VehicleJourneys[0]
+	loc := responseLocation(data.Context.Timezone)
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, loc)
+	vj := model.VehicleJourney{
+		Id:          raw.ID,
+		TrainNumber: raw.Name,
+	}
+	// only the disruptions of that day are applied
+	disruptions, err := disruptionsByID(data.Disruptions, loc)
+	if err != nil {
+		return nil, err
+	}
+	var applied []*Disruption
+	for _, d := range linkedDisruptions(disruptions, raw.Disruptions) {
+		if !appliesOn(d, day) {
+			continue
+		}
+		vj.Disruptions = append(vj.Disruptions, d)
+		for i := range data.Disruptions {
+			if data.Disruptions[i].ID == d.Id {
+				applied = append(applied, &data.Disruptions[i])
+			}
+		}
+	}
+	var previous time.Time
+	for _, st := range raw.StopTimes {
+		s := model.StopTime{
+			StopPointId: st.StopPoint.ID,
+			StopAreaId:  st.StopPoint.StopArea.ID,
+			Name:        st.StopPoint.StopArea.Name,
+			Cancelled:   st.SkippedStop,
+		}
+		if s.Name == "" {
+			s.Name = st.StopPoint.Name
+		}
+		// trains running past midnight go on the next day
+		if s.BaseArrival, err = parseTimeOfDay(st.ArrivalTime, day, previous); err != nil {
+			return nil, err
+		}
+		if s.BaseDeparture, err = parseTimeOfDay(st.DepartureTime, day, s.BaseArrival); err != nil {
+			return nil, err
+		}
+		previous = s.BaseDeparture
+		s.Arrival = s.BaseArrival
+		s.Departure = s.BaseDeparture
+		for _, d := range applied {
+			if d.Severity.Effect == "NO_SERVICE" {
+				s.Cancelled = true
+			}
+			for _, o := range d.ImpactedObjects {
+				for _, is := range o.ImpactedStops {
+					if is.StopPoint.ID != s.StopPointId {
+						continue
+					}
+					if is.ArrivalStatus == "deleted" && is.DepartureStatus == "deleted" {
+						s.Cancelled = true
+					}
+					if is.AmendedArrivalTime != "" {
+						if s.Arrival, err = parseTimeOfDay(is.AmendedArrivalTime, day, s.BaseArrival.Add(-12*time.Hour)); err != nil {
+							return nil, err
+						}
+					}
+					if is.AmendedDepartureTime != "" {
+						if s.Departure, err = parseTimeOfDay(is.AmendedDepartureTime, day, s.BaseDeparture.Add(-12*time.Hour)); err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
+		}
+		vj.StopTimes = append(vj.StopTimes, s)
+	}
+	return &vj, nil
+}
+
+// appliesOn returns true if a disruption applies to some part of a day
+func appliesOn(d model.Disruption, day time.Time) bool {
+	if len(d.ApplicationPeriods) == 0 {
+		return true
+	}
+	end := day.AddDate(0, 0, 1)
+	for _, p := range d.ApplicationPeriods {
+		if p.Begin.Before(end) && p.End.After(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTimeOfDay parses a navitia time of day like 131800 as the first such time of a day that is not before after
+func parseTimeOfDay(s string, day time.Time, after time.Time) (time.Time, error) {
+	if len(s) != 6 {
+		return time.Time{}, newDateParsingError(s, nil)
+	}
+	var parts [3]int
+	for i := range parts {
+		n, err := strconv.Atoi(s[2*i : 2*i+2])
+		if err != nil {
+			return time.Time{}, newDateParsingError(s, err)
+		}
+		parts[i] = n
+	}
+	t := time.Date(day.Year(), day.Month(), day.Day(), parts[0], parts[1], parts[2], 0, day.Location())
+	for t.Before(after) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
@@ -0,0 +1,112 @@
+package navitia_api_client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.adyxax.org/adyxax/trains/pkg/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetVehicleJourney(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		http.ServeFile(w, r, "test_data/vehicle-journey-886823.json")
+	}))
+	defer ts.Close()
+	client := newTestClient(ts)
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	vj, err := client.GetVehicleJourney(context.Background(), "", "vehicle_journey:OCE:SN886823F29029_dst_1", time.Date(2021, 2, 18, 13, 0, 0, 0, paris))
+	require.NoError(t, err)
+	require.Equal(t, []string{"/coverage/sncf/vehicle_journeys/vehicle_journey:OCE:SN886823F29029_dst_1"}, requests)
+	require.Equal(t, "vehicle_journey:OCE:SN886823F29029_dst_1", vj.Id)
+	require.Equal(t, "886823", vj.TrainNumber)
+	require.Len(t, vj.StopTimes, 5)
+	require.Equal(t, model.StopTime{
+		StopPointId:   "stop_point:OCE:SP:TrainTER-87723197",
+		StopAreaId:    "stop_area:OCE:SA:87723197",
+		Name:          "Lyon Part-Dieu",
+		BaseArrival:   time.Date(2021, 2, 18, 13, 5, 0, 0, paris),
+		Arrival:       time.Date(2021, 2, 18, 13, 5, 0, 0, paris),
+		BaseDeparture: time.Date(2021, 2, 18, 13, 8, 0, 0, paris),
+		Departure:     time.Date(2021, 2, 18, 13, 8, 0, 0, paris),
+	}, vj.StopTimes[1])
+	// real-time times come from the disruptions of the day
+	require.Len(t, vj.Disruptions, 1)
+	require.Equal(t, "SIGNIFICANT_DELAYS", vj.Disruptions[0].Severity.Effect)
+	require.True(t, vj.StopTimes[2].Delayed())
+	require.Equal(t, time.Date(2021, 2, 18, 13, 25, 0, 0, paris), vj.StopTimes[2].Departure)
+	require.True(t, vj.StopTimes[3].Cancelled)
+	require.False(t, vj.StopTimes[4].Cancelled)
+	require.Equal(t, time.Date(2021, 2, 18, 13, 52, 0, 0, paris), vj.StopTimes[4].Arrival)
+	// the train of another day is only affected by the disruptions of that day, and the response is cached
+	requests = nil
+	vj, err = client.GetVehicleJourney(context.Background(), "", "vehicle_journey:OCE:SN886823F29029_dst_1", time.Date(2021, 2, 17, 0, 0, 0, 0, paris))
+	require.NoError(t, err)
+	require.Empty(t, requests)
+	require.Len(t, vj.Disruptions, 1)
+	require.Equal(t, "NO_SERVICE", vj.Disruptions[0].Severity.Effect)
+	for _, s := range vj.StopTimes {
+		require.True(t, s.Cancelled)
+		require.False(t, s.Delayed())
+	}
+	// the train position is computed from its real-time times
+	vj, err = client.GetVehicleJourney(context.Background(), "", "vehicle_journey:OCE:SN886823F29029_dst_1", time.Date(2021, 2, 18, 0, 0, 0, 0, paris))
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		now      time.Time
+		stop     int
+		standing bool
+	}{
+		{time.Date(2021, 2, 18, 12, 0, 0, 0, paris), -1, false},
+		{time.Date(2021, 2, 18, 13, 6, 0, 0, paris), 1, true},
+		{time.Date(2021, 2, 18, 13, 20, 0, 0, paris), 1, false},
+		{time.Date(2021, 2, 18, 13, 40, 0, 0, paris), 2, false},
+		{time.Date(2021, 2, 18, 14, 0, 0, 0, paris), 4, false},
+	} {
+		stop, standing := vj.Position(tc.now)
+		require.Equal(t, tc.stop, stop, tc.now)
+		require.Equal(t, tc.standing, standing, tc.now)
+	}
+	// errors
+	client, ts = newTestClientFromFilename(t, "test_data/invalid.json")
+	defer ts.Close()
+	_, err = client.GetVehicleJourney(context.Background(), "sncf", "test", time.Now())
+	requireErrorTypeMatch(t, err, JsonDecodeError{})
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/coverage/sncf/vehicle_journeys/empty":
+			w.Write([]byte(`{"vehicle_journeys": []}`))
+		default:
+			w.Write([]byte(`{"vehicle_journeys": [{"stop_times": [{"arrival_time": "1318"}]}]}`))
+		}
+	}))
+	defer ts.Close()
+	client = newTestClient(ts)
+	_, err = client.GetVehicleJourney(context.Background(), "sncf", "empty", time.Now())
+	requireErrorTypeMatch(t, err, NotFoundError{})
+	_, err = client.GetVehicleJourney(context.Background(), "sncf", "invalid", time.Now())
+	requireErrorTypeMatch(t, err, DateParsingError{})
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	require.NoError(t, err)
+	day := time.Date(2021, 2, 18, 0, 0, 0, 0, paris)
+	parsed, err := parseTimeOfDay("235000", day, time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2021, 2, 18, 23, 50, 0, 0, paris), parsed)
+	// times of trains running past midnight are on the next day
+	parsed, err = parseTimeOfDay("001500", day, parsed)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2021, 2, 19, 0, 15, 0, 0, paris), parsed)
+	_, err = parseTimeOfDay("00h15", day, parsed)
+	requireErrorTypeMatch(t, err, DateParsingError{})
+	_, err = parseTimeOfDay("", day, parsed)
+	requireErrorTypeMatch(t, err, DateParsingError{})
+}